@@ -2,11 +2,14 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Synternet/swapscope/publisher/internal/analytics/ethereum"
 	"github.com/joho/godotenv"
 )
 
@@ -19,6 +22,21 @@ const (
 	CoinGeckoApiUrl              = "COINGECKO_API_URL"
 	ApiFetchTimeout              = "API_FETCH_TIMEOUT"
 	ApiRateLimit                 = "API_RATE_LIMIT"
+	PublishFilterFile            = "PUBLISH_FILTER_FILE"
+	PublishFilterReload          = "PUBLISH_FILTER_RELOAD"
+	ChainsName                   = "CHAINS"
+	ChainSubjectsName            = "CHAIN_SUBJECTS"
+	ChainNodesName               = "CHAIN_NODES"
+	CandleIntervalsName          = "CANDLE_INTERVALS"
+	StatsIntervalName            = "STATS_INTERVAL"
+	DepthIntervalName            = "DEPTH_INTERVAL"
+	LeaderboardIntervalName      = "LEADERBOARD_INTERVAL"
+	LeaderboardSizeName          = "LEADERBOARD_SIZE"
+	RebalanceWindowName          = "REBALANCE_WINDOW"
+	ProtocolsName                = "PROTOCOLS"
+	AlertRulesFile               = "ALERT_RULES_FILE"
+	AlertRulesReload             = "ALERT_RULES_RELOAD"
+	WebhooksFile                 = "WEBHOOKS_FILE"
 )
 
 type ServiceConfig struct {
@@ -43,6 +61,21 @@ type ServiceConfig struct {
 	coinGeckoApiUrl          *string
 	apiFetchTimeout          *time.Duration
 	apiRateLimit             *int
+	publishFilterFile        *string
+	publishFilterReload      *time.Duration
+	chains                   *string
+	chainSubjects            *string
+	chainNodes               *string
+	candleIntervals          *string
+	statsInterval            *time.Duration
+	depthInterval            *time.Duration
+	leaderboardInterval      *time.Duration
+	leaderboardSize          *int
+	rebalanceWindow          *int
+	protocols                *string
+	alertRulesFile           *string
+	alertRulesReload         *time.Duration
+	webhooksFile             *string
 }
 
 func setupDefaults() {
@@ -54,6 +87,15 @@ func setupDefaults() {
 	setEnvDefaults(ApiFetchTimeout, "2m")
 	setEnvDefaults(ApiRateLimit, "12")
 	setEnvDefaults(CoinGeckoApiUrl, "https://api.coingecko.com/api/v3")
+	setEnvDefaults(PublishFilterReload, "30s")
+	setEnvDefaults(ChainsName, "ethereum")
+	setEnvDefaults(CandleIntervalsName, "1m,5m,1h,1d")
+	setEnvDefaults(StatsIntervalName, "1m")
+	setEnvDefaults(DepthIntervalName, "5m")
+	setEnvDefaults(LeaderboardIntervalName, "5m")
+	setEnvDefaults(LeaderboardSizeName, "10")
+	setEnvDefaults(RebalanceWindowName, "10")
+	setEnvDefaults(AlertRulesReload, "30s")
 }
 
 func setEnvDefaults(field string, value string) {
@@ -91,6 +133,21 @@ func newServiceConfig() *ServiceConfig {
 		coinGeckoApiUrl:          flag.String("coingecko-api", os.Getenv(CoinGeckoApiUrl), "CoinGecko API url"),
 		apiFetchTimeout:          flag.Duration("api-timeout", stringToDuration(os.Getenv(ApiFetchTimeout)), "API fetch timeout"),
 		apiRateLimit:             flag.Int("api-ratelimit", stringToInt(os.Getenv(ApiRateLimit)), "Conservative API Rate Limit(e.g. 10-30 calls per minute)"),
+		publishFilterFile:        flag.String("publish-filter", os.Getenv(PublishFilterFile), "Publish filter rules file (JSON)"),
+		publishFilterReload:      flag.Duration("publish-filter-reload", stringToDuration(os.Getenv(PublishFilterReload)), "Publish filter rules file reload check interval"),
+		chains:                   flag.String("chains", os.Getenv(ChainsName), "Chains to process (separated by comma): ethereum, arbitrum, optimism, polygon, base"),
+		chainSubjects:            flag.String("chain-subjects", os.Getenv(ChainSubjectsName), "Input subject overrides (separated by comma), e.g. arbitrum=synternet.arbitrum.log-event"),
+		chainNodes:               flag.String("chain-nodes", os.Getenv(ChainNodesName), "Full node addresses of other chains (separated by comma), e.g. arbitrum=https://arb1.example.org"),
+		candleIntervals:          flag.String("candle-intervals", os.Getenv(CandleIntervalsName), "Swap candle intervals (separated by comma), e.g. 1m,5m,1h,1d"),
+		statsInterval:            flag.Duration("stats-interval", stringToDuration(os.Getenv(StatsIntervalName)), "Pool stats snapshot publish interval"),
+		depthInterval:            flag.Duration("depth-interval", stringToDuration(os.Getenv(DepthIntervalName)), "Pool liquidity depth snapshot publish interval"),
+		leaderboardInterval:      flag.Duration("leaderboard-interval", stringToDuration(os.Getenv(LeaderboardIntervalName)), "Wallet leaderboards publish interval"),
+		leaderboardSize:          flag.Int("leaderboard-size", stringToInt(os.Getenv(LeaderboardSizeName)), "Number of top wallets in a leaderboard"),
+		rebalanceWindow:          flag.Int("rebalance-window", stringToInt(os.Getenv(RebalanceWindowName)), "Blocks after a liquidity removal within which an addition of the same owner and pool is a rebalance"),
+		protocols:                flag.String("protocols", os.Getenv(ProtocolsName), "DEX protocols to process (separated by comma): uniswap-v3, sushiswap-v3, pancakeswap-v3, curve, balancer-v2. All if empty"),
+		alertRulesFile:           flag.String("alert-rules", os.Getenv(AlertRulesFile), "Alert rules file (JSON)"),
+		alertRulesReload:         flag.Duration("alert-rules-reload", stringToDuration(os.Getenv(AlertRulesReload)), "Alert rules file reload check interval"),
+		webhooksFile:             flag.String("webhooks", os.Getenv(WebhooksFile), "Webhook endpoints file (JSON)"),
 	}
 
 	flag.Parse()
@@ -98,6 +155,87 @@ func newServiceConfig() *ServiceConfig {
 	return cfg
 }
 
+// parseChains resolves chain profiles by name and applies input subject overrides.
+func parseChains(names string, subjects string) ([]ethereum.Chain, error) {
+	overrides, err := parseChainValues(subjects)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain subject overrides: %w", err)
+	}
+
+	var chains []ethereum.Chain
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		chain, found := ethereum.Chains[name]
+		if !found {
+			return nil, fmt.Errorf("unknown chain %q", name)
+		}
+		if subject, found := overrides[name]; found {
+			chain.Subject = subject
+		}
+		chains = append(chains, chain)
+	}
+	if len(chains) == 0 {
+		return nil, fmt.Errorf("at least one chain must be configured")
+	}
+	return chains, nil
+}
+
+// parseNames parses comma separated names, e.g. protocols.
+func parseNames(values string) []string {
+	var res []string
+	for _, name := range strings.Split(values, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// parseChainValues parses comma separated name=value pairs of chain settings.
+func parseChainValues(values string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, pair := range strings.Split(values, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("%q is not name=value", pair)
+		}
+		res[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return res, nil
+}
+
+// parseIntervals parses comma separated durations. Days are supported in addition to time.ParseDuration units, e.g. 1d.
+func parseIntervals(values string) ([]time.Duration, error) {
+	var res []time.Duration
+	for _, value := range strings.Split(values, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if days, found := strings.CutSuffix(value, "d"); found {
+			n, err := strconv.Atoi(days)
+			if err != nil {
+				return nil, fmt.Errorf("invalid interval %q: %w", value, err)
+			}
+			res = append(res, time.Duration(n)*24*time.Hour)
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %w", value, err)
+		}
+		res = append(res, duration)
+	}
+	return res, nil
+}
+
 func stringToDuration(stringDur string) time.Duration {
 	duration, err := time.ParseDuration(stringDur)
 	if err != nil && stringDur != "" {
@@ -2,16 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"time"
 
 	svcnats "github.com/Synternet/pubsub-go/pubsub"
+	"github.com/Synternet/swapscope/publisher/internal/alert"
 	"github.com/Synternet/swapscope/publisher/internal/analytics/ethereum"
 	"github.com/Synternet/swapscope/publisher/internal/fetcher"
+	"github.com/Synternet/swapscope/publisher/internal/filter"
 	"github.com/Synternet/swapscope/publisher/internal/repository/db"
 	"github.com/Synternet/swapscope/publisher/internal/service"
+	"github.com/Synternet/swapscope/publisher/internal/webhook"
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
 	"github.com/nats-io/nats.go"
 )
 
@@ -68,20 +73,102 @@ func main() {
 	// 	panic(err)
 	// }
 
-	a, err := ethereum.New(ctx, db,
-		ethereum.WithEventLogCache(*cfg.logCacheExpirationTime, *cfg.logCachePurgeTime),
-		ethereum.WithTokenPriceFetcher(cgFetcher),
-		ethereum.WithTokenFetcher(cgFetcher),
-	)
+	chainNodes, err := parseChainValues(*cfg.chainNodes)
+	if err != nil {
+		panic(fmt.Errorf("invalid chain nodes: %w", err))
+	}
+	if _, found := chainNodes[ethereum.Ethereum.Name]; !found && *cfg.ethNodeAddress != "" {
+		chainNodes[ethereum.Ethereum.Name] = *cfg.ethNodeAddress
+	}
+
+	candleIntervals, err := parseIntervals(*cfg.candleIntervals)
+	if err != nil {
+		panic(fmt.Errorf("invalid candle intervals: %w", err))
+	}
+	if *cfg.rebalanceWindow < 0 {
+		panic(fmt.Errorf("invalid rebalance window: %d blocks", *cfg.rebalanceWindow))
+	}
+
+	publishFilter := filter.Default()
+	if *cfg.publishFilterFile != "" {
+		publishFilter, err = filter.Load(*cfg.publishFilterFile)
+		if err != nil {
+			panic(err)
+		}
+		go publishFilter.Watch(ctx, *cfg.publishFilterReload)
+	}
+
+	var alertEngine *alert.Engine
+	if *cfg.alertRulesFile != "" {
+		alertEngine, err = alert.Load(*cfg.alertRulesFile)
+		if err != nil {
+			panic(err)
+		}
+		go alertEngine.Watch(ctx, *cfg.alertRulesReload)
+	}
+
+	chains, err := parseChains(*cfg.chains, *cfg.chainSubjects)
 	if err != nil {
 		panic(err)
 	}
 
-	s, err := service.New(ctx,
+	var modules []analytics.Analytics
+	for _, chain := range chains {
+		chainDB := db.WithChain(chain.ID)
+		chainFetcher := cgFetcher.ForPlatform(chainDB, chain.CoingeckoPlatform)
+
+		var nodeFetcher *fetcher.EthereumFetcher
+		if nodeAddress, found := chainNodes[chain.Name]; found { // Full node is used to fetch pool fee tiers and check tokens
+			nodeFetcher, err = fetcher.NewEthereumFetcher(ctx, nodeAddress, chainDB)
+			if err != nil {
+				panic(err)
+			}
+		}
+		wellKnown := append(append([]string{}, chain.Native...), chain.Stable...)
+		tokenFetcher := fetcher.NewReputationFetcher(chainDB, chainFetcher, nodeFetcher, wellKnown...)
+
+		opts := []ethereum.Option{
+			ethereum.WithChain(chain),
+			ethereum.WithEventLogCache(*cfg.logCacheExpirationTime, *cfg.logCachePurgeTime),
+			ethereum.WithTokenPriceFetcher(chainFetcher),
+			ethereum.WithTokenFetcher(tokenFetcher),
+			ethereum.WithPublishFilter(publishFilter),
+			ethereum.WithCandleIntervals(candleIntervals...),
+			ethereum.WithStatsInterval(*cfg.statsInterval),
+			ethereum.WithDepthInterval(*cfg.depthInterval),
+			ethereum.WithLeaderboard(*cfg.leaderboardInterval, *cfg.leaderboardSize),
+			ethereum.WithRebalanceWindow(uint64(*cfg.rebalanceWindow)),
+			ethereum.WithProtocols(parseNames(*cfg.protocols)...),
+		}
+		if alertEngine != nil {
+			opts = append(opts, ethereum.WithAlertEngine(alertEngine))
+		}
+		if nodeFetcher != nil {
+			opts = append(opts, ethereum.WithPoolFeeFetcher(nodeFetcher))
+		}
+
+		a, err := ethereum.New(ctx, chainDB, opts...)
+		if err != nil {
+			panic(err)
+		}
+		modules = append(modules, a)
+		log.Printf("Processing %s (chain ID %d) events from %s", chain.Name, chain.ID, chain.Subject)
+	}
+
+	serviceOpts := []service.Option{
 		service.WithNATS(svcnSub, svcnPub),
-		service.WithAnalytics(a),
+		service.WithAnalytics(modules...),
 		service.WithPrefix(*cfg.publisherPrefix),
-	)
+	}
+	if *cfg.webhooksFile != "" {
+		webhooks, err := webhook.Load(*cfg.webhooksFile)
+		if err != nil {
+			panic(err)
+		}
+		serviceOpts = append(serviceOpts, service.WithWebhooks(webhooks))
+	}
+
+	s, err := service.New(ctx, serviceOpts...)
 	if err != nil {
 		panic(err)
 	}
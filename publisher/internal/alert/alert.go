@@ -0,0 +1,215 @@
+// Package alert evaluates alerting rules against processed operations.
+//
+// Rules are declared in a JSON file. Every rule whose `when` expression matches an operation fires an alert.
+// Rules with `threshold` fire only when that many matching operations with the same `groupBy` field value
+// (counting distinct values of the `distinct` field, if set) happen within `window`:
+//
+//	{
+//	  "rules": [
+//	    {"name": "whale-removal", "when": "operation == 'remove' && valueUSD > 1000000 && token0.symbol == 'WETH' && token1.symbol == 'USDC'"},
+//	    {"name": "price-impact", "when": "operation == 'swap' && priceImpactBps > 200"},
+//	    {"name": "busy-lp", "when": "operation == 'add' && owner != ''", "groupBy": "owner", "distinct": "pool", "threshold": 5, "window": "10m"}
+//	  ]
+//	}
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/internal/config"
+	"github.com/Synternet/swapscope/publisher/internal/expr"
+)
+
+var ruleNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`) // Rule name is a part of the published subject
+
+type Rule struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	When        string          `json:"when"`
+	GroupBy     string          `json:"groupBy"`
+	Distinct    string          `json:"distinct"`
+	Threshold   int             `json:"threshold"`
+	Window      config.Duration `json:"window"`
+
+	expression *expr.Expression
+}
+
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Alert is a fired rule.
+type Alert struct {
+	Rule        string
+	Description string
+	Group       string // Value of the groupBy field, empty for rules without threshold
+	Count       int    // Number of matching operations (or distinct values) within the window
+}
+
+type Engine struct {
+	config atomic.Pointer[Config]
+	file   *config.File[Config] // Set if rules are loaded from file
+
+	mu        sync.Mutex
+	events    map[string]map[string][]event // Matched operations of threshold rules by rule name and group
+	lastPrune time.Time
+}
+
+type event struct {
+	timestamp time.Time
+	distinct  string
+}
+
+// New creates alert engine from given config.
+func New(cfg Config) (*Engine, error) {
+	ret := &Engine{events: make(map[string]map[string][]event)}
+	if err := ret.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Load creates alert engine from rules file. The file can be reloaded later with Reload or Watch.
+func Load(path string) (*Engine, error) {
+	ret := &Engine{events: make(map[string]map[string][]event)}
+	ret.file = config.NewFile(path, "alert rules", ret.setConfig)
+	if err := ret.Reload(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (e *Engine) setConfig(cfg Config) error {
+	names := make(map[string]bool)
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if !ruleNamePattern.MatchString(rule.Name) {
+			return fmt.Errorf("rule %q: name must consist of letters, digits, '-' and '_'", rule.Name)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule %q: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Threshold > 0 && (rule.GroupBy == "" || rule.Window <= 0) {
+			return fmt.Errorf("rule %q: threshold requires groupBy and window", rule.Name)
+		}
+		expression, err := expr.Compile(rule.When)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		rule.expression = expression
+	}
+	e.config.Store(&cfg)
+
+	e.mu.Lock()
+	e.events = make(map[string]map[string][]event) // Windows of changed rules would not be valid
+	e.mu.Unlock()
+	return nil
+}
+
+// Reload re-reads the rules file. Currently active rules are kept if the new file is invalid.
+func (e *Engine) Reload() error {
+	if e.file == nil {
+		return nil
+	}
+	return e.file.Reload()
+}
+
+// Watch polls the rules file every interval and reloads it when it changes.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	if e.file == nil {
+		return
+	}
+	e.file.Watch(ctx, interval)
+}
+
+// Evaluate matches the rules against operation facts and returns fired alerts.
+func (e *Engine) Evaluate(facts expr.Env, timestamp time.Time) []Alert {
+	cfg := e.config.Load()
+	var alerts []Alert
+	for _, rule := range cfg.Rules {
+		matched, err := rule.expression.Bool(facts)
+		if err != nil {
+			log.Printf("Alert rule %q failed: %s", rule.Name, err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if rule.Threshold <= 0 {
+			alerts = append(alerts, Alert{Rule: rule.Name, Description: rule.Description, Count: 1})
+			continue
+		}
+		if alert, fired := e.count(rule, facts, timestamp); fired {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// count records matched operation in the window of its group. Window is reset when the rule fires.
+func (e *Engine) count(rule Rule, facts expr.Env, timestamp time.Time) (Alert, bool) {
+	group := fmt.Sprint(facts[rule.GroupBy])
+	distinct := ""
+	if rule.Distinct != "" {
+		distinct = fmt.Sprint(facts[rule.Distinct])
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.prune(timestamp)
+	groups, found := e.events[rule.Name]
+	if !found {
+		groups = make(map[string][]event)
+		e.events[rule.Name] = groups
+	}
+	var events []event
+	for _, ev := range groups[group] {
+		if timestamp.Sub(ev.timestamp) < time.Duration(rule.Window) {
+			events = append(events, ev)
+		}
+	}
+	events = append(events, event{timestamp: timestamp, distinct: distinct})
+
+	count := len(events)
+	if rule.Distinct != "" {
+		values := make(map[string]bool)
+		for _, ev := range events {
+			values[ev.distinct] = true
+		}
+		count = len(values)
+	}
+	if count < rule.Threshold {
+		groups[group] = events
+		return Alert{}, false
+	}
+	delete(groups, group)
+	return Alert{Rule: rule.Name, Description: rule.Description, Group: group, Count: count}, true
+}
+
+// prune drops groups whose events are all outside the window of their rule. It runs at most once a minute.
+func (e *Engine) prune(now time.Time) {
+	if now.Sub(e.lastPrune) < time.Minute {
+		return
+	}
+	e.lastPrune = now
+
+	windows := make(map[string]time.Duration)
+	for _, rule := range e.config.Load().Rules {
+		windows[rule.Name] = time.Duration(rule.Window)
+	}
+	for name, groups := range e.events {
+		for group, events := range groups {
+			if len(events) == 0 || now.Sub(events[len(events)-1].timestamp) >= windows[name] {
+				delete(groups, group)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/internal/config"
+	"github.com/Synternet/swapscope/publisher/internal/expr"
+)
+
+func Test_EvaluateRules(t *testing.T) {
+	cfg := Config{Rules: []Rule{
+		{Name: "whale-removal", When: "operation == 'remove' && valueUSD > 1000000"},
+		{Name: "price-impact", When: "operation == 'swap' && priceImpactBps > 200"},
+	}}
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New(%v) failed: %s", cfg, err)
+	}
+
+	tests := []struct {
+		name     string
+		facts    expr.Env
+		expected []string
+	}{
+		{"whale removal", expr.Env{"operation": "remove", "valueUSD": 2_000_000.0}, []string{"whale-removal"}},
+		{"small removal", expr.Env{"operation": "remove", "valueUSD": 2_000.0}, nil},
+		{"high impact swap", expr.Env{"operation": "swap", "priceImpactBps": 250.0}, []string{"price-impact"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alerts := e.Evaluate(test.facts, time.Now())
+			if len(alerts) != len(test.expected) {
+				t.Fatalf("Evaluate(%v) = (%v); expected (%v)", test.facts, alerts, test.expected)
+			}
+			for i, alert := range alerts {
+				if alert.Rule != test.expected[i] {
+					t.Errorf("Evaluate(%v) = (%v); expected (%v)", test.facts, alerts, test.expected)
+				}
+			}
+		})
+	}
+}
+
+func Test_EvaluateThresholdRule(t *testing.T) {
+	cfg := Config{Rules: []Rule{
+		{Name: "busy-lp", When: "operation == 'add'", GroupBy: "owner", Distinct: "pool", Threshold: 3, Window: config.Duration(10 * time.Minute)},
+	}}
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New(%v) failed: %s", cfg, err)
+	}
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		owner    string
+		pool     string
+		offset   time.Duration
+		expected int // Count of fired alert, 0 if not fired
+	}{
+		{"0xa", "0x1", 0, 0},
+		{"0xa", "0x1", time.Minute, 0}, // Same pool is counted once
+		{"0xb", "0x2", 2 * time.Minute, 0},
+		{"0xa", "0x2", 3 * time.Minute, 0},
+		{"0xa", "0x3", 4 * time.Minute, 3},
+		{"0xa", "0x4", 5 * time.Minute, 0},  // Window is reset after alert
+		{"0xb", "0x3", 13 * time.Minute, 0}, // 0x2 of 0xb is outside of the window
+		{"0xb", "0x4", 14 * time.Minute, 0},
+	}
+	for _, test := range tests {
+		alerts := e.Evaluate(expr.Env{"operation": "add", "owner": test.owner, "pool": test.pool}, start.Add(test.offset))
+		count := 0
+		if len(alerts) > 0 {
+			count = alerts[0].Count
+		}
+		if count != test.expected {
+			t.Errorf("Evaluate(%s adds to %s at %v) fired count (%d); expected (%d)", test.owner, test.pool, test.offset, count, test.expected)
+		}
+	}
+}
+
+func Test_NewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"invalid name", Config{Rules: []Rule{{Name: "a.b", When: "true"}}}},
+		{"duplicate name", Config{Rules: []Rule{{Name: "r", When: "true"}, {Name: "r", When: "false"}}}},
+		{"threshold without window", Config{Rules: []Rule{{Name: "r", When: "true", GroupBy: "owner", Threshold: 2}}}},
+		{"invalid expression", Config{Rules: []Rule{{Name: "r", When: "valueUSD >"}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := New(test.cfg); err == nil {
+				t.Errorf("New(%v) expected error", test.cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package ethereum
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	uniswapV3Protocol     = "uniswap-v3"
+	sushiswapV3Protocol   = "sushiswap-v3"
+	pancakeswapV3Protocol = "pancakeswap-v3"
+	uniswapV4Protocol     = "uniswap-v4"
+	curveProtocol         = "curve"
+	balancerV2Protocol    = "balancer-v2"
+)
+
+// protocolAdapter plugs a DEX protocol into the analytics. It registers handlers of the protocol events
+// that turn its logs into operations (Addition, Removal, FeeCollection, Swap) published with the protocol name.
+type protocolAdapter interface {
+	Protocol() string
+	// Supports reports whether the protocol is deployed on the chain.
+	Supports(chain Chain) bool
+	// Register registers handlers of the protocol events. Registry stamps the handlers with the protocol.
+	Register(a *Analytics, events *eventRegistry)
+}
+
+// protocolAdapters are supported protocols in registration order.
+// Handlers of events shared by several protocols belong to the first protocol that registers them.
+var protocolAdapters = []protocolAdapter{
+	concentratedLiquidityAdapter{protocol: uniswapV3Protocol, swapABI: &uniswapLiqPoolsABI},
+	concentratedLiquidityAdapter{protocol: sushiswapV3Protocol, swapABI: &uniswapLiqPoolsABI, positionsManagers: map[int64]string{
+		Ethereum.ID: "0x2214A42d8e2A1d20635c2cb0664422c528B6A432",
+	}},
+	concentratedLiquidityAdapter{protocol: pancakeswapV3Protocol, swapABI: &pancakeSwapPoolABI, positionsManagers: map[int64]string{
+		Ethereum.ID: "0x46A15B0b27311cedF172AB29E4f4766fbE7F4364",
+	}},
+	uniswapV4Adapter{},
+	curveAdapter{},
+	balancerAdapter{vault: "0xBA12222222228d8Ba445958a75a0704d566BF2C8"},
+}
+
+// isKnownProtocol checks if there is an adapter of the protocol.
+func isKnownProtocol(protocol string) bool {
+	return slices.ContainsFunc(protocolAdapters, func(adapter protocolAdapter) bool {
+		return adapter.Protocol() == protocol
+	})
+}
+
+// concentratedLiquidityAdapter plugs in Uniswap V3 and its forks. Forks share pool events and positions manager
+// ABI with Uniswap V3 and differ by positions manager deployments (PancakeSwap also by the pool Swap event).
+type concentratedLiquidityAdapter struct {
+	protocol          string
+	swapABI           *abi.ABI         // Pool ABI with the Swap event
+	positionsManagers map[int64]string // By chain ID, chain's Uniswap V3 positions manager if not set
+}
+
+func (ad concentratedLiquidityAdapter) Protocol() string {
+	return ad.protocol
+}
+
+func (ad concentratedLiquidityAdapter) Supports(chain Chain) bool {
+	return ad.positionsManager(chain) != ""
+}
+
+func (ad concentratedLiquidityAdapter) positionsManager(chain Chain) string {
+	if ad.positionsManagers == nil {
+		return chain.PositionsManager
+	}
+	return ad.positionsManagers[chain.ID]
+}
+
+func (ad concentratedLiquidityAdapter) Register(a *Analytics, events *eventRegistry) {
+	manager := ad.positionsManager(a.chain)
+	a.positionsManagers = append(a.positionsManagers, manager)
+
+	positionsManager := fromContract(manager)
+	events.Register(positionTransferEvent, uniswapPositionsManagerABI.Events[transferEvent], positionsManager, withTopics(4)) // ERC721 Transfer has tokenId indexed
+	events.Register(increaseLiquidityEvent, uniswapPositionsManagerABI.Events[increaseLiquidityEvent], positionsManager,
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return &Addition{OperationBase: opBase}, "add"
+		}))
+	events.Register(decreaseLiquidityEvent, uniswapPositionsManagerABI.Events[decreaseLiquidityEvent], positionsManager)
+	events.Register(positionCollectEvent, uniswapPositionsManagerABI.Events[collectEvent], positionsManager,
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			poolCollectLog, found := findPoolLogOfPosition(a.eventLogCache, eLog, collectEvent)
+			if !found {
+				return nil, ""
+			}
+			args, err := decodePositionsManagerLog(collectEvent, eLog)
+			if err != nil {
+				return nil, ""
+			}
+			return a.collectOperation(poolCollectLog, a.chain.positionTokenID(eLog.Address, args.BigInt("tokenId")), opBase)
+		}))
+
+	events.Register(mintEvent, uniswapLiqPoolsABI.Events[mintEvent]) // Addition is processed on positions manager IncreaseLiquidity that follows
+	events.Register(burnEvent, uniswapLiqPoolsABI.Events[burnEvent])
+	events.Register(collectEvent, uniswapLiqPoolsABI.Events[collectEvent],
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			args, err := decodePoolLog(collectEvent, eLog)
+			if err != nil || a.isPositionsManager(args.Address("owner")) { // Positions manager Collect that follows is processed instead
+				return nil, ""
+			}
+			return a.collectOperation(eLog, "", opBase)
+		}))
+	events.Register(flashEvent, uniswapLiqPoolsABI.Events[flashEvent],
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return &Flash{OperationBase: opBase}, "flash"
+		}))
+	events.Register(swapEvent, ad.swapABI.Events[swapEvent],
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return &Swap{OperationBase: opBase}, "swap"
+		}))
+}
+
+// uniswapV4Adapter plugs in Uniswap V4. All pools live in the chain's PoolManager singleton and are
+// identified by PoolId - hash of the pool key (currencies, fee, tick spacing and hooks) - instead of an address.
+type uniswapV4Adapter struct{}
+
+func (ad uniswapV4Adapter) Protocol() string {
+	return uniswapV4Protocol
+}
+
+func (ad uniswapV4Adapter) Supports(chain Chain) bool {
+	return chain.PoolManager != ""
+}
+
+func (ad uniswapV4Adapter) Register(a *Analytics, events *eventRegistry) {
+	poolManager := fromContract(a.chain.PoolManager)
+	events.Register(initializeEvent, uniswapPoolManagerABI.Events[initializeEvent], poolManager) // Pool is recorded by poolManagerTracker
+	events.Register(modifyLiquidityEvent, uniswapPoolManagerABI.Events[modifyLiquidityEvent], poolManager,
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			args, err := decodePoolManagerLog(modifyLiquidityEvent, eLog)
+			if err != nil {
+				return nil, ""
+			}
+			switch args.BigInt("liquidityDelta").Sign() {
+			case 1:
+				return &Addition{OperationBase: opBase}, "add"
+			case -1:
+				return &Removal{OperationBase: opBase}, "remove"
+			}
+			return nil, "" // Zero delta only settles accrued fees, which the event does not carry
+		}))
+	events.Register(v4SwapEvent, uniswapPoolManagerABI.Events[swapEvent], poolManager,
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return &Swap{OperationBase: opBase}, "swap"
+		}))
+	if a.chain.V4PositionManager != "" { // Owners of PositionManager positions are the owners of its NFTs
+		events.Register(positionTransferEvent, uniswapPositionsManagerABI.Events[transferEvent], fromContract(a.chain.V4PositionManager), withTopics(4))
+	}
+}
+
+// curveAdapter plugs in Curve StableSwap pools. Pools are not registered anywhere on chain, so events of any
+// contract are handled. Only two coin pools are supported for liquidity changes.
+type curveAdapter struct{}
+
+func (ad curveAdapter) Protocol() string {
+	return curveProtocol
+}
+
+func (ad curveAdapter) Supports(chain Chain) bool {
+	return true
+}
+
+func (ad curveAdapter) Register(a *Analytics, events *eventRegistry) {
+	events.Register(curveExchangeEvent, curveStableSwapABI.Events[curveExchangeEvent],
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return &Swap{OperationBase: opBase}, "swap"
+		}))
+	events.Register(curveAddLiquidityEvent, curveStableSwapABI.Events[curveAddLiquidityEvent],
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return &Addition{OperationBase: opBase}, "add"
+		}))
+	events.Register(curveRemoveLiquidityEvent, curveStableSwapABI.Events[curveRemoveLiquidityEvent],
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return &Removal{OperationBase: opBase}, "remove"
+		}))
+}
+
+// balancerAdapter plugs in Balancer V2. All pools hold their tokens in the Vault that emits the events.
+type balancerAdapter struct {
+	vault string
+}
+
+func (ad balancerAdapter) Protocol() string {
+	return balancerV2Protocol
+}
+
+func (ad balancerAdapter) Supports(chain Chain) bool {
+	return true // Vault has the same address on all supported chains
+}
+
+func (ad balancerAdapter) Register(a *Analytics, events *eventRegistry) {
+	vault := fromContract(ad.vault)
+	events.Register(vaultSwapEvent, balancerVaultABI.Events[swapEvent], vault,
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return &Swap{OperationBase: opBase}, "swap"
+		}))
+	events.Register(poolBalanceChangedEvent, balancerVaultABI.Events[poolBalanceChangedEvent], vault,
+		withOperation(func(eLog EventLog, opBase OperationBase) (Operation, string) {
+			return poolBalanceChangedOperation(eLog, opBase)
+		}))
+}
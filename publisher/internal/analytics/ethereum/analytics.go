@@ -4,8 +4,13 @@ import (
 	"context"
 	_ "embed"
 	"errors"
+	"log"
+	"math"
+	"math/big"
 	"strings"
+	"time"
 
+	"github.com/Synternet/swapscope/publisher/internal/filter"
 	"github.com/Synternet/swapscope/publisher/pkg/analytics"
 	"github.com/Synternet/swapscope/publisher/pkg/repository"
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -21,21 +26,50 @@ var (
 	ethereumErc20TokenABIJson string
 	ethereumErc20TokenABI     abi.ABI
 
-	stableCoins []string
-	nativeCoins []string
+	//go:embed Uniswap_Positions_Manager_contract.json
+	uniswapPositionsManagerABIJson string
+	uniswapPositionsManagerABI     abi.ABI
+
+	//go:embed PancakeSwap_V3_Pool_contract.json
+	pancakeSwapPoolABIJson string
+	pancakeSwapPoolABI     abi.ABI
+
+	//go:embed Curve_StableSwap_contract.json
+	curveStableSwapABIJson string
+	curveStableSwapABI     abi.ABI
+
+	//go:embed Balancer_V2_Vault_contract.json
+	balancerVaultABIJson string
+	balancerVaultABI     abi.ABI
+
+	//go:embed Uniswap_V4_PoolManager_contract.json
+	uniswapPoolManagerABIJson string
+	uniswapPoolManagerABI     abi.ABI
 )
 
 const (
-	subSubject            = "synternet.ethereum.log-event"
-	uniswapPositionsOwner = "0xC36442b4a4522E871399CD717aBDD847Ab11FE88"
-	mintEvent             = "Mint" // Has to match Event's name in respective ABI
-	transferEvent         = "Transfer"
-	burnEvent             = "Burn"
-	collectEvent          = "Collect"
-	swapEvent             = "Swap"
-	addressWETH           = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2" // https://etherscan.io/token/0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2
-	addressUSDT           = "0xdAC17F958D2ee523a2206206994597C13D831ec7" // https://etherscan.io/token/0xdac17f958d2ee523a2206206994597c13d831ec7
-	addressUSDC           = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48" // https://etherscan.io/token/0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48
+	mintEvent     = "Mint" // Has to match Event's name in respective ABI
+	transferEvent = "Transfer"
+	burnEvent     = "Burn"
+	collectEvent  = "Collect"
+	swapEvent     = "Swap"
+	flashEvent    = "Flash"
+
+	increaseLiquidityEvent = "IncreaseLiquidity" // Positions manager events
+	decreaseLiquidityEvent = "DecreaseLiquidity"
+	positionCollectEvent   = "PositionCollect"  // Positions manager Collect, named apart from pool's Collect in logs cache
+	positionTransferEvent  = "PositionTransfer" // Position NFT (ERC721) Transfer, same signature as ERC20 Transfer
+
+	curveExchangeEvent        = "TokenExchange" // Curve StableSwap pool events
+	curveAddLiquidityEvent    = "AddLiquidity"
+	curveRemoveLiquidityEvent = "RemoveLiquidity"
+
+	vaultSwapEvent          = "VaultSwap" // Balancer V2 Vault Swap, named apart from pool's Swap in logs cache
+	poolBalanceChangedEvent = "PoolBalanceChanged"
+
+	initializeEvent      = "Initialize" // Uniswap V4 PoolManager events
+	modifyLiquidityEvent = "ModifyLiquidity"
+	v4SwapEvent          = "V4Swap" // PoolManager Swap, named apart from pool's Swap in logs cache
 )
 
 type Analytics struct {
@@ -44,8 +78,20 @@ type Analytics struct {
 	ctx context.Context
 
 	eventLogCache *EventLogCache
+	positions     positionTracker
+	lifecycle     positionLifecycle
+	ranges        *rangeMonitor
+	poolPrices    *poolPriceCache
+	blocks        *blockBuffer
+	candles       *candleAggregator
+	stats         *statsAggregator
+	depth         *depthMap
+	leaderboard   *leaderboard
+	rebalances    *rebalanceDetector
+	v4Pools       poolManagerTracker
 
-	eventSignature map[string]string
+	events            *eventRegistry
+	positionsManagers []string // Of the enabled protocols
 }
 
 type (
@@ -55,16 +101,12 @@ type (
 	}
 )
 
-func init() {
-	stableCoins = []string{strings.ToLower(addressUSDT), strings.ToLower(addressUSDC)}
-	nativeCoins = []string{strings.ToLower(addressWETH)}
-}
-
 func New(ctx context.Context, db repository.Repository, opts ...Option) (*Analytics, error) {
 	ret := &Analytics{
 		ctx: ctx,
 		db:  db,
 	}
+	ret.Options.SetDefaults()
 	if err := ret.Options.ParseOptions(opts...); err != nil {
 		return nil, err
 	}
@@ -75,23 +117,174 @@ func New(ctx context.Context, db repository.Repository, opts ...Option) (*Analyt
 	if ret.tokenFetcher == nil {
 		return nil, errors.New("token fetcher must be set")
 	}
+	if ret.publishFilter == nil {
+		ret.publishFilter = filter.Default()
+	}
+
+	if ret.poolFeeFetcher == nil {
+		log.Println("Pool fee fetcher is not set (no full node of the chain): fees and fee APR of pools other than Uniswap V4 are 0")
+	}
 
 	ret.eventLogCache = &EventLogCache{cache.New(ret.Options.eventLogCacheExpirationTime, ret.Options.eventLogCachePurgeTime)}
 
 	uniswapLiqPoolsABI = parseJsonToAbi(uniswapLiqPoolsABIJson)
 	ethereumErc20TokenABI = parseJsonToAbi(ethereumErc20TokenABIJson)
-	ret.eventSignature = make(map[string]string)
-	ret.eventSignature[mintEvent] = convertToEventSignature(uniswapLiqPoolsABI.Events[mintEvent].Sig)
-	ret.eventSignature[burnEvent] = convertToEventSignature(uniswapLiqPoolsABI.Events[burnEvent].Sig)
-	ret.eventSignature[swapEvent] = convertToEventSignature(uniswapLiqPoolsABI.Events[swapEvent].Sig)
-	ret.eventSignature[collectEvent] = convertToEventSignature(uniswapLiqPoolsABI.Events[collectEvent].Sig)
-	ret.eventSignature[transferEvent] = convertToEventSignature(ethereumErc20TokenABI.Events[transferEvent].Sig)
+	uniswapPositionsManagerABI = parseJsonToAbi(uniswapPositionsManagerABIJson)
+	pancakeSwapPoolABI = parseJsonToAbi(pancakeSwapPoolABIJson)
+	curveStableSwapABI = parseJsonToAbi(curveStableSwapABIJson)
+	balancerVaultABI = parseJsonToAbi(balancerVaultABIJson)
+	uniswapPoolManagerABI = parseJsonToAbi(uniswapPoolManagerABIJson)
+	ret.events = newEventRegistry()
+	ret.registerEvents()
+
+	ret.poolPrices = newPoolPriceCache()
+	ret.candles = newCandleAggregator(ret.candleIntervals)
+	ret.stats = newStatsAggregator(defaultStatsWindows)
+	ret.leaderboard = newLeaderboard(db, defaultLeaderboardWindows)
+	ret.leaderboard.Rebuild(time.Now())
+	ret.rebalances = newRebalanceDetector(ret.chain, ret.rebalanceWindow)
+	ret.depth = newDepthMap(db)
+	ret.depth.Rebuild()
+	ret.blocks = newBlockBuffer(
+		jitDetector{chain: ret.chain}.Detect, // Marks operations before they are published
+		sandwichDetector{chain: ret.chain}.Detect,
+		flashDetector{}.Detect, // Marks operations funded by flash loans
+		routeDetector{chain: ret.chain}.Detect,
+		ret.publishBlock,
+	)
+	ret.ranges = newRangeMonitor(db, ret.chain)
+	ret.positions = positionTracker{db: db, cache: ret.eventLogCache, ranges: ret.ranges, chain: ret.chain, isPositionsManager: ret.isPositionsManager}
+	ret.lifecycle = positionLifecycle{db: db, chain: ret.chain}
+	ret.v4Pools = poolManagerTracker{db: db, tokenFetcher: ret.tokenFetcher, poolPrices: ret.poolPrices, chain: ret.chain}
 
 	return ret, nil
 }
 
 func (a *Analytics) Handlers() map[string]analytics.Handler {
 	return map[string]analytics.Handler{
-		subSubject: a.ProcessMessage,
+		a.chain.Subject: a.ProcessMessage,
+	}
+}
+
+// Run closes aggregates (e.g. swap candles) and publishes snapshots (e.g. pool stats) on schedule until context is done.
+func (a *Analytics) Run(ctx context.Context, send analytics.Sender) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	statsTicker := time.NewTicker(a.statsInterval)
+	defer statsTicker.Stop()
+	depthTicker := time.NewTicker(a.depthInterval)
+	defer depthTicker.Stop()
+	leaderboardTicker := time.NewTicker(a.leaderboardInterval)
+	defer leaderboardTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := a.blocks.Flush(a.chainSender(send)); err != nil { // Operations of the last block are not lost
+				log.Println("Failed to analyse last block: ", err.Error())
+			}
+			return nil
+		case now := <-ticker.C:
+			a.publishCandles(a.candles.CloseDue(now), a.chainSender(send))
+			if err := a.blocks.FlushDue(now, a.chainSender(send)); err != nil {
+				log.Println("Failed to analyse delayed block: ", err.Error())
+			}
+		case now := <-statsTicker.C:
+			a.publishStats(now, a.chainSender(send))
+		case now := <-depthTicker.C:
+			a.publishDepth(now, a.chainSender(send))
+		case now := <-leaderboardTicker.C:
+			a.publishLeaderboards(now, a.chainSender(send))
+		}
+	}
+}
+
+func (a *Analytics) publishCandles(candles []repository.Candle, send analytics.Sender) {
+	for _, c := range candles {
+		if err := a.db.SaveCandle(c); err != nil {
+			log.Println("Failed to save candle: ", err.Error())
+		}
+		if err := send(newCandleMessage(c, a.chain.ID), "candles", c.Interval, c.LPoolAddress); err != nil {
+			log.Println("Failed to publish candle: ", err.Error())
+		}
+	}
+}
+
+func (a *Analytics) publishStats(now time.Time, send analytics.Sender) {
+	for pool, stats := range a.stats.Snapshot(now) {
+		for _, s := range stats {
+			if s.Window != feeAPRWindow || s.FeeAPR == 0 {
+				continue
+			}
+			if err := a.db.SavePoolFeeAPR(pool, s.FeeAPR); err != nil {
+				log.Println("Failed to save pool fee APR: ", err.Error())
+			}
+		}
+		if err := send(newPoolStatsMessage(pool, stats, a.stats.InRangeLiquidity(pool), a.chain.ID, now), "stats", pool); err != nil {
+			log.Println("Failed to publish pool stats: ", err.Error())
+		}
+	}
+}
+
+// inRangeLiquidityValue values active liquidity of the swapped pool (Swap event liquidity at the price after the swap)
+// between neighbouring initialized ticks of the depth map at swap token prices.
+func (a *Analytics) inRangeLiquidityValue(sw *Swap) (float64, bool) {
+	if sw.state.liquidity == nil || sw.state.sqrtPriceX96 == nil || sw.state.liquidity.Sign() == 0 {
+		return 0, false
+	}
+	lowerTick, upperTick, found := a.depth.ActiveRange(sw.Address, sw.state.tick)
+	if !found {
+		return 0, false
+	}
+	liquidity, _ := new(big.Float).SetInt(sw.state.liquidity).Float64()
+	sqrtPrice, _ := new(big.Float).Quo(new(big.Float).SetInt(sw.state.sqrtPriceX96), new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96))).Float64()
+	amount0, amount1 := positionAmounts(liquidity, sqrtPrice, lowerTick, upperTick)
+
+	token0, token1 := sw.Token0, sw.Token1
+	if strings.ToLower(token0.Address) > strings.ToLower(token1.Address) { // Pool tokens are sorted by address
+		token0, token1 = token1, token0
+	}
+	value0 := amount0 / math.Pow(10, float64(token0.Decimals)) * token0.Price
+	value1 := amount1 / math.Pow(10, float64(token1.Decimals)) * token1.Price
+	return value0 + value1, true
+}
+
+func (a *Analytics) publishDepth(now time.Time, send analytics.Sender) {
+	for pool, ranges := range a.depth.Snapshot() {
+		addr0, addr1, found := a.db.GetPoolPairAddresses(pool)
+		if !found {
+			continue
+		}
+		token0, found0 := a.db.GetToken(addr0)
+		token1, found1 := a.db.GetToken(addr1)
+		if !found0 || !found1 {
+			continue
+		}
+		if err := send(newDepthMessage(pool, ranges, token0, token1, a.chain.ID, now), "depth", pool); err != nil {
+			log.Println("Failed to publish pool depth: ", err.Error())
+		}
+	}
+}
+
+// publishLeaderboards saves stats of active wallets and publishes top wallets of every metric.
+func (a *Analytics) publishLeaderboards(now time.Time, send analytics.Sender) {
+	stats := a.leaderboard.Snapshot(now)
+	var rows []repository.WalletStats
+	for _, windowStats := range stats {
+		for _, ws := range windowStats {
+			rows = append(rows, newWalletStats(ws, now))
+		}
+	}
+	if err := a.db.SaveWalletStats(rows); err != nil {
+		log.Println("Failed to save wallet stats: ", err.Error())
+	}
+	if len(rows) == 0 {
+		return
+	}
+	for _, metric := range leaderboardMetrics {
+		msg := newLeaderboardMessage(metric, defaultLeaderboardWindows, stats, a.leaderboardSize, a.chain.ID, now)
+		if err := send(msg, "leaderboard", metric); err != nil {
+			log.Println("Failed to publish leaderboard: ", err.Error())
+		}
 	}
 }
@@ -0,0 +1,168 @@
+package ethereum
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// poolBalanceChange is PoolBalanceChanged of a two token Balancer pool - a join (deposit) or an exit (withdrawal).
+type poolBalanceChange struct {
+	pool     string
+	provider string
+	tokens   [2]string
+	deltas   [2]*big.Int // Changes of pool balances
+}
+
+// decodePoolBalanceChange decodes PoolBalanceChanged Vault event. Pool's own token (BPT of composable pools) is skipped.
+func decodePoolBalanceChange(eLog EventLog) (poolBalanceChange, error) {
+	args, err := decodeVaultLog(poolBalanceChangedEvent, eLog)
+	if err != nil {
+		return poolBalanceChange{}, err
+	}
+	change := poolBalanceChange{
+		pool:     convertPoolIDToAddress(eLog.Topics[1]),
+		provider: args.Address("liquidityProvider"),
+	}
+	tokens, deltas := args.Addresses("tokens"), args.BigInts("deltas")
+	if len(tokens) != len(deltas) {
+		return poolBalanceChange{}, fmt.Errorf("pool %s has %d tokens and %d balance changes", change.pool, len(tokens), len(deltas))
+	}
+	n := 0
+	for i, token := range tokens {
+		if token == change.pool {
+			continue
+		}
+		if n == len(change.tokens) {
+			return poolBalanceChange{}, fmt.Errorf("not a two token pool %s", change.pool)
+		}
+		change.tokens[n], change.deltas[n] = token, deltas[i]
+		n++
+	}
+	if n != len(change.tokens) {
+		return poolBalanceChange{}, fmt.Errorf("not a two token pool %s", change.pool)
+	}
+	return change, nil
+}
+
+// direction returns 1 if tokens were only deposited, -1 if they were only withdrawn and 0 otherwise.
+func (c poolBalanceChange) direction() int {
+	sign0, sign1 := c.deltas[0].Sign(), c.deltas[1].Sign()
+	switch {
+	case sign0 >= 0 && sign1 >= 0 && sign0+sign1 > 0:
+		return 1
+	case sign0 <= 0 && sign1 <= 0 && sign0+sign1 < 0:
+		return -1
+	}
+	return 0
+}
+
+// amounts returns deposited (or withdrawn) token amounts in pool token order.
+func (c poolBalanceChange) amounts(ob OperationBase) (TokenTransaction, TokenTransaction, error) {
+	var res [2]TokenTransaction
+	for i, address := range c.tokens {
+		t, err := ob.lookupToken(address)
+		if err != nil {
+			return TokenTransaction{}, TokenTransaction{}, err
+		}
+		res[i] = TokenTransaction{Token: t, Amount: convertAmount(new(big.Int).Abs(c.deltas[i]), t.Decimals)}
+	}
+	return res[0], res[1], nil
+}
+
+// poolBalanceChangedOperation turns join of a two token pool into an addition and exit into a removal.
+func poolBalanceChangedOperation(eLog EventLog, opBase OperationBase) (Operation, string) {
+	change, err := decodePoolBalanceChange(eLog)
+	if err != nil {
+		return nil, ""
+	}
+	switch change.direction() {
+	case 1:
+		return &Addition{OperationBase: opBase}, "add"
+	case -1:
+		return &Removal{OperationBase: opBase}, "remove"
+	}
+	return nil, ""
+}
+
+// processPoolBalanceChanged handles join of a Balancer pool.
+func (add *Addition) processPoolBalanceChanged(join WrappedEventLog) error {
+	change, err := decodePoolBalanceChange(join.Log)
+	if err != nil {
+		return err
+	}
+
+	add.Position = newPosition(join, add.OperationBase.chain)
+	add.Address = change.pool
+	add.Protocol, add.FullRange = add.protocol, true
+	add.Owner, add.Sender = change.provider, change.provider
+	add.Token0, add.Token1, err = change.amounts(add.OperationBase)
+	if err != nil {
+		return err
+	}
+
+	add.valueLiquidity(&add.Position, true)
+	return nil
+}
+
+// processPoolBalanceChanged handles exit of a Balancer pool.
+func (rem *Removal) processPoolBalanceChanged(exit WrappedEventLog) error {
+	change, err := decodePoolBalanceChange(exit.Log)
+	if err != nil {
+		return err
+	}
+
+	rem.Position = newPosition(exit, rem.OperationBase.chain)
+	rem.Address = change.pool
+	rem.Protocol, rem.FullRange = rem.protocol, true
+	rem.Owner, rem.Recipient = change.provider, change.provider
+	rem.Token0, rem.Token1, err = change.amounts(rem.OperationBase)
+	if err != nil {
+		return err
+	}
+
+	rem.valueLiquidity(&rem.Position, false)
+	return nil
+}
+
+// processVaultSwap handles Balancer Vault Swap. Vault keeps pool tokens sorted by address, the lower one is pool token0.
+// Swapper is known only if tokens were transferred to and from the Vault (not swapped within internal balances).
+func (sw *Swap) processVaultSwap(swap WrappedEventLog) error {
+	args, err := decodeVaultLog(swapEvent, swap.Log)
+	if err != nil {
+		return err
+	}
+	tokenIn, err := sw.lookupToken(args.Address("tokenIn"))
+	if err != nil {
+		return err
+	}
+	tokenOut, err := sw.lookupToken(args.Address("tokenOut"))
+	if err != nil {
+		return err
+	}
+	amountIn, amountOut := args.BigInt("amountIn"), args.BigInt("amountOut")
+
+	sw.Position = newPosition(swap, sw.OperationBase.chain)
+	sw.Address = convertPoolIDToAddress(swap.Log.Topics[1])
+	sw.Protocol = sw.protocol
+	if transferLogs, err := sw.cache.GetByTxHashAndLogType(swap.Log.TransactionHash, transferEvent); err == nil {
+		if transferLog, found := findTransfer(transferLogs, swap.Log.Address, true, tokenIn.Address, amountIn); found {
+			sw.Sender = transferCounterparty(transferLog, true)
+		}
+		if transferLog, found := findTransfer(transferLogs, swap.Log.Address, false, tokenOut.Address, amountOut); found {
+			sw.Recipient = transferCounterparty(transferLog, false)
+		}
+	}
+
+	in := TokenTransaction{Token: tokenIn, Amount: convertAmount(amountIn, tokenIn.Decimals)} // Pool deltas
+	out := TokenTransaction{Token: tokenOut, Amount: -convertAmount(amountOut, tokenOut.Decimals)}
+	sw.Token0, sw.Token1 = in, out
+	if strings.ToLower(tokenIn.Address) > strings.ToLower(tokenOut.Address) {
+		sw.Token0, sw.Token1 = out, in
+	}
+	if sw.Token0.Amount != 0 {
+		sw.ExecutionPrice = math.Abs(sw.Token1.Amount / sw.Token0.Amount) // Pool price is not reported
+	}
+	return sw.settle(sw.Token0.Address)
+}
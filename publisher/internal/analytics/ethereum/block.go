@@ -0,0 +1,126 @@
+package ethereum
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+)
+
+// blockOperation is a processed operation together with its position in the block.
+type blockOperation struct {
+	Operation
+	Log       EventLog
+	PublishTo string
+	Timestamp time.Time
+
+	txIndex  uint64
+	logIndex uint64
+}
+
+// blockDetector analyses all operations of a finished block.
+type blockDetector func(block uint64, ops []blockOperation, send analytics.Sender) error
+
+// maxBlockDelay bounds how long operations of a block are held when event logs of the next block do not arrive.
+const maxBlockDelay = 15 * time.Second
+
+// blockBuffer collects processed operations of the current block. When event log of the next block arrives,
+// or the block is open for longer than maxBlockDelay, operations of the block are passed (ordered by transaction
+// and log index) to the detectors.
+type blockBuffer struct {
+	mu        sync.Mutex
+	block     uint64
+	opened    time.Time // When the first event log of the block arrived
+	ops       []blockOperation
+	detectors []blockDetector
+}
+
+func newBlockBuffer(detectors ...blockDetector) *blockBuffer {
+	return &blockBuffer{detectors: detectors}
+}
+
+func newBlockOperation(op Operation, wel WrappedEventLog, timestamp time.Time) blockOperation {
+	return blockOperation{
+		Operation: op,
+		Log:       wel.Log,
+		PublishTo: wel.Instructions.PublishTo,
+		Timestamp: timestamp,
+		txIndex:   convertHexToUint64(wel.Log.TransactionIndex),
+		logIndex:  convertHexToUint64(wel.Log.LogIndex),
+	}
+}
+
+// Next flushes the buffer if the event log belongs to a newer block.
+func (b *blockBuffer) Next(eLog EventLog, timestamp time.Time, send analytics.Sender) error {
+	block := convertHexToUint64(eLog.BlockNumber)
+
+	b.mu.Lock()
+	if block <= b.block {
+		b.mu.Unlock()
+		return nil
+	}
+	finished, ops := b.block, b.ops
+	b.block, b.opened, b.ops = block, timestamp, nil
+	b.mu.Unlock()
+
+	return b.detect(finished, ops, send)
+}
+
+// FlushDue flushes operations of the current block if it was opened more than maxBlockDelay ago.
+// Operations of the block that arrive later are buffered and flushed again.
+func (b *blockBuffer) FlushDue(now time.Time, send analytics.Sender) error {
+	b.mu.Lock()
+	if len(b.ops) == 0 || now.Sub(b.opened) < maxBlockDelay {
+		b.mu.Unlock()
+		return nil
+	}
+	block, ops := b.block, b.ops
+	b.opened, b.ops = now, nil
+	b.mu.Unlock()
+
+	return b.detect(block, ops, send)
+}
+
+// Flush flushes operations of the current block, e.g. on shutdown.
+func (b *blockBuffer) Flush(send analytics.Sender) error {
+	b.mu.Lock()
+	block, ops := b.block, b.ops
+	b.ops = nil
+	b.mu.Unlock()
+
+	return b.detect(block, ops, send)
+}
+
+func (b *blockBuffer) detect(block uint64, ops []blockOperation, send analytics.Sender) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		if ops[i].txIndex != ops[j].txIndex {
+			return ops[i].txIndex < ops[j].txIndex
+		}
+		return ops[i].logIndex < ops[j].logIndex
+	})
+
+	var err error
+	for _, detect := range b.detectors {
+		if detectErr := detect(block, ops, send); detectErr != nil {
+			err = detectErr
+		}
+	}
+	return err
+}
+
+// Add puts processed operation of the current block into the buffer. Operations of already finished blocks
+// (late or replayed event logs) are not buffered, false is returned and they are expected to be published as is.
+func (b *blockBuffer) Add(op Operation, wel WrappedEventLog, timestamp time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if convertHexToUint64(wel.Log.BlockNumber) != b.block {
+		return false
+	}
+	b.ops = append(b.ops, newBlockOperation(op, wel, timestamp))
+	return true
+}
@@ -0,0 +1,132 @@
+package ethereum
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+var defaultCandleIntervals = []time.Duration{time.Minute, 5 * time.Minute, time.Hour, 24 * time.Hour}
+
+// candleAggregator builds OHLCV candles of every pool for configured intervals from processed swaps.
+// Prices are of the base token (Token0 of the swap) in the quote token.
+// Candles are closed by the analytics runner once their interval is over - intervals without swaps have no candles.
+type candleAggregator struct {
+	mu        sync.Mutex
+	intervals []time.Duration
+	candles   map[time.Duration]map[string]*repository.Candle
+}
+
+func newCandleAggregator(intervals []time.Duration) *candleAggregator {
+	ca := &candleAggregator{
+		intervals: intervals,
+		candles:   make(map[time.Duration]map[string]*repository.Candle),
+	}
+	for _, interval := range intervals {
+		ca.candles[interval] = make(map[string]*repository.Candle)
+	}
+	return ca
+}
+
+// Add accounts swap into candles of its pool. Candles of previous intervals are closed and returned.
+func (ca *candleAggregator) Add(sw *Swap, timestamp time.Time) []repository.Candle {
+	price := sw.PriceAfter
+	if price == 0 {
+		price = sw.ExecutionPrice
+	}
+	if price == 0 || math.IsInf(price, 0) {
+		return nil
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	var closed []repository.Candle
+	pool := strings.ToLower(sw.Address)
+	for _, interval := range ca.intervals {
+		openTime := timestamp.UTC().Truncate(interval)
+		c, found := ca.candles[interval][pool]
+		if found && !c.OpenTime.Equal(openTime) {
+			closed = append(closed, *c)
+			found = false
+		}
+		if !found {
+			c = &repository.Candle{
+				LPoolAddress: sw.Address,
+				Interval:     intervalName(interval),
+				OpenTime:     openTime,
+				CloseTime:    openTime.Add(interval),
+				BaseSymbol:   sw.Token0.Symbol,
+				QuoteSymbol:  sw.Token1.Symbol,
+				Open:         price,
+				High:         price,
+				Low:          price,
+			}
+			ca.candles[interval][pool] = c
+		}
+		c.High = math.Max(c.High, price)
+		c.Low = math.Min(c.Low, price)
+		c.Close = price
+		c.VolumeBase += math.Abs(sw.Token0.Amount)
+		c.VolumeQuote += math.Abs(sw.Token1.Amount)
+		c.VolumeUSD += sw.TotalValue
+		c.Trades++
+	}
+	return closed
+}
+
+// CloseDue closes and returns candles whose interval is over at the given time.
+func (ca *candleAggregator) CloseDue(now time.Time) []repository.Candle {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	var closed []repository.Candle
+	for _, interval := range ca.intervals {
+		for pool, c := range ca.candles[interval] {
+			if now.Before(c.CloseTime) {
+				continue
+			}
+			closed = append(closed, *c)
+			delete(ca.candles[interval], pool)
+		}
+	}
+	return closed
+}
+
+// intervalName formats candle interval as used in published subjects, e.g. 1m, 5m, 1h, 1d.
+func intervalName(interval time.Duration) string {
+	switch {
+	case interval%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", interval/(24*time.Hour))
+	case interval%time.Hour == 0:
+		return fmt.Sprintf("%dh", interval/time.Hour)
+	case interval%time.Minute == 0:
+		return fmt.Sprintf("%dm", interval/time.Minute)
+	}
+	return fmt.Sprintf("%ds", interval/time.Second)
+}
+
+func newCandleMessage(c repository.Candle, chainID int64) types.CandleMessage {
+	return types.CandleMessage{
+		ChainID:     chainID,
+		Address:     c.LPoolAddress,
+		Interval:    c.Interval,
+		OpenTime:    c.OpenTime,
+		CloseTime:   c.CloseTime,
+		Base:        c.BaseSymbol,
+		Quote:       c.QuoteSymbol,
+		Open:        c.Open,
+		High:        c.High,
+		Low:         c.Low,
+		Close:       c.Close,
+		VolumeBase:  c.VolumeBase,
+		VolumeQuote: c.VolumeQuote,
+		VolumeUSD:   c.VolumeUSD,
+		Trades:      c.Trades,
+	}
+}
@@ -0,0 +1,176 @@
+package ethereum
+
+import (
+	"math/big"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Chain describes an EVM chain the analytics module can process.
+// Addresses are kept checksummed for readability and compared case-insensitively.
+type Chain struct {
+	Name              string   // Used as published subject token
+	ID                int64    // EIP-155 chain ID, stored with every DB row
+	Subject           string   // Input event log stream subject
+	CoingeckoPlatform string   // CoinGecko asset platform ID
+	PositionsManager  string   // Uniswap V3 NonfungiblePositionManager
+	Factory           string   // Uniswap V3 Factory
+	PoolManager       string   // Uniswap V4 PoolManager singleton, holds all V4 pools
+	V4PositionManager string   // Uniswap V4 PositionManager, salts its PoolManager positions with NFT tokenId
+	SwapRouters       []string // Uniswap Universal Router, swaps in V4 pools on behalf of swappers
+	Native            []string // Wrapped native currency first
+	Stable            []string
+}
+
+var (
+	Ethereum = Chain{
+		Name:              "ethereum",
+		ID:                1,
+		Subject:           "synternet.ethereum.log-event",
+		CoingeckoPlatform: "ethereum",
+		PositionsManager:  "0xC36442b4a4522E871399CD717aBDD847Ab11FE88",
+		Factory:           "0x1F98431c8aD98523631AE4a59f267346ea31F984",
+		PoolManager:       "0x000000000004444c5dc75cB358380D2e3dE08A90",
+		V4PositionManager: "0xbD216513d74C8cf14cf4747E6AaA6420FF64ee9e",
+		SwapRouters:       []string{"0x66a9893cc07d91d95644aedd05d03f95e1dba8af"},
+		Native: []string{
+			"0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", // WETH https://etherscan.io/token/0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2
+		},
+		Stable: []string{
+			"0xdAC17F958D2ee523a2206206994597C13D831ec7", // USDT https://etherscan.io/token/0xdac17f958d2ee523a2206206994597c13d831ec7
+			"0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", // USDC https://etherscan.io/token/0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48
+		},
+	}
+	Arbitrum = Chain{
+		Name:              "arbitrum",
+		ID:                42161,
+		Subject:           "synternet.arbitrum.log-event",
+		CoingeckoPlatform: "arbitrum-one",
+		PositionsManager:  "0xC36442b4a4522E871399CD717aBDD847Ab11FE88",
+		Factory:           "0x1F98431c8aD98523631AE4a59f267346ea31F984",
+		PoolManager:       "0x360E68faCcca8cA495c1B759Fd9EEe466db9FB32",
+		V4PositionManager: "0xd88F38F930b7952f2DB2432Cb002E7abbF3dD869",
+		SwapRouters:       []string{"0xa51afafe0263b40edaef0df8781ea9aa03e381a3"},
+		Native: []string{
+			"0x82aF49447D8a07e3bd95BD0d56f35241523fBab1", // WETH
+		},
+		Stable: []string{
+			"0xFd086bC7CD5C481DCC9C85ebE478A1C0b69FCbb9", // USDT
+			"0xaf88d065e77c8cC2239327C5EDb3A432268e5831", // USDC
+			"0xFF970A61A04b1cA14834A43f5dE4533eBDDB5CC8", // USDC.e
+		},
+	}
+	Optimism = Chain{
+		Name:              "optimism",
+		ID:                10,
+		Subject:           "synternet.optimism.log-event",
+		CoingeckoPlatform: "optimistic-ethereum",
+		PositionsManager:  "0xC36442b4a4522E871399CD717aBDD847Ab11FE88",
+		Factory:           "0x1F98431c8aD98523631AE4a59f267346ea31F984",
+		PoolManager:       "0x9a13F98Cb987694C9F086b1F5eB990EeA8264Ec3",
+		V4PositionManager: "0x3C3Ea4B57a46241e54610e5f022E5c45859A1017",
+		SwapRouters:       []string{"0x851116d9223fabed8e56c0e6b8ad0c31d98b3507"},
+		Native: []string{
+			"0x4200000000000000000000000000000000000006", // WETH
+		},
+		Stable: []string{
+			"0x94b008aA00579c1307B0EF2c499aD98a8ce58e58", // USDT
+			"0x0b2C639c533813f4Aa9D7837CAf62653d097Ff85", // USDC
+			"0x7F5c764cBc14f9669B88837ca1490cCa17c31607", // USDC.e
+		},
+	}
+	Polygon = Chain{
+		Name:              "polygon",
+		ID:                137,
+		Subject:           "synternet.polygon.log-event",
+		CoingeckoPlatform: "polygon-pos",
+		PositionsManager:  "0xC36442b4a4522E871399CD717aBDD847Ab11FE88",
+		Factory:           "0x1F98431c8aD98523631AE4a59f267346ea31F984",
+		PoolManager:       "0x67366782805870060151383F4BbFF9daB53e5cD6",
+		V4PositionManager: "0x1Ec2eBf4F37E7363FDfe3551602425af0B3ceef9",
+		SwapRouters:       []string{"0x1095692a6237d83c6a72f3f5efedb9a670c49223"},
+		Native: []string{
+			"0x0d500B1d8E8eF31E21C99d1Db9A6444d3ADf1270", // WMATIC
+			"0x7ceB23fD6bC0adD59E62ac25578270cFf1b9f619", // WETH
+		},
+		Stable: []string{
+			"0xc2132D05D31c914a87C6611C10748AEb04B58e8F", // USDT
+			"0x3c499c542cEF5E3811e1192ce70d8cC03d5c3359", // USDC
+			"0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174", // USDC.e
+		},
+	}
+	Base = Chain{
+		Name:              "base",
+		ID:                8453,
+		Subject:           "synternet.base.log-event",
+		CoingeckoPlatform: "base",
+		PositionsManager:  "0x03a520b32C04BF3bEEf7BEb72E919cf822Ed34f1",
+		Factory:           "0x33128a8fC17869897dcE68Ed026d694621f6FDfD",
+		PoolManager:       "0x498581fF718922c3f8e6A244956aF099B2652b2b",
+		V4PositionManager: "0x7C5f5A4bBd8fD63184577525326123B519429bDc",
+		SwapRouters:       []string{"0x6ff5693b99212da76ad316178a184ab56d299b43"},
+		Native: []string{
+			"0x4200000000000000000000000000000000000006", // WETH
+		},
+		Stable: []string{
+			"0xfde4C96c8593536E31F229EA8f37b2ADa2699bb2", // USDT
+			"0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913", // USDC
+			"0xd9aAEc86B65D86f6A7B5B1b0c42FFA531710b6CA", // USDbC
+		},
+	}
+
+	Chains = map[string]Chain{
+		Ethereum.Name: Ethereum,
+		Arbitrum.Name: Arbitrum,
+		Optimism.Name: Optimism,
+		Polygon.Name:  Polygon,
+		Base.Name:     Base,
+	}
+)
+
+// positionTokenID returns ID the position NFT of the positions manager is tracked by. NFT IDs of managers other than
+// the chain's Uniswap V3 one are prefixed with the manager address, as IDs of different managers overlap.
+func (c Chain) positionTokenID(manager string, tokenID *big.Int) string {
+	if strings.EqualFold(manager, c.PositionsManager) {
+		return tokenID.String()
+	}
+	return strings.ToLower(manager) + ":" + tokenID.String()
+}
+
+// v4PositionTokenID returns ID of Uniswap V4 PositionManager NFT the ModifyLiquidity is made for.
+// Position is not an NFT if liquidity is modified by another caller.
+func (c Chain) v4PositionTokenID(modifyArgs eventArgs) (string, bool) {
+	sender := modifyArgs.Address("sender")
+	if c.V4PositionManager == "" || !strings.EqualFold(sender, c.V4PositionManager) {
+		return "", false
+	}
+	return c.positionTokenID(sender, modifyArgs.BigInt("salt")), true
+}
+
+// currencyAddress returns token address of Uniswap V4 currency. Native currency (zero address) is represented
+// by the wrapped native token, which has the same price.
+func (c Chain) currencyAddress(currency string) string {
+	if strings.EqualFold(currency, zeroAddress) {
+		return strings.ToLower(c.Native[0])
+	}
+	return strings.ToLower(currency)
+}
+
+func (c Chain) isSwapRouter(address string) bool {
+	return containsAddress(c.SwapRouters, address)
+}
+
+func (c Chain) isNative(address string) bool {
+	return containsAddress(c.Native, address)
+}
+
+func (c Chain) isStable(address string) bool {
+	return containsAddress(c.Stable, address)
+}
+
+func containsAddress(addresses []string, address string) bool {
+	return slices.ContainsFunc(addresses, func(a string) bool {
+		return strings.EqualFold(a, address)
+	})
+}
@@ -2,12 +2,13 @@ package ethereum
 
 import (
 	"strings"
+
+	"golang.org/x/exp/slices"
 )
 
-// isUniswapPositionsNFT checks if owner of event is uniswap positions NFT
-func isUniswapPositionsNFT(address string) bool {
-	if strings.Contains(address, strings.ToLower(uniswapPositionsOwner)[2:]) {
-		return true
-	}
-	return false
+// isPositionsManager checks if address (or event topic or data holding it) is a positions manager of the enabled protocols.
+func (a *Analytics) isPositionsManager(address string) bool {
+	return slices.ContainsFunc(a.positionsManagers, func(manager string) bool {
+		return strings.Contains(address, strings.ToLower(manager)[2:])
+	})
 }
@@ -1,12 +1,12 @@
 package ethereum
 
 import (
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math"
 	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -27,7 +27,7 @@ func convertHexToBigInt(hexStr string) *big.Int {
 	return resultInt
 }
 
-// convertToEventSignature converts event header into an event signature.
+// convertToEventSignature converts event header into an event signature - full 32-byte Keccak-256 hash used as topic0.
 func convertToEventSignature(header string) string {
 	input := []byte(header)
 	hash := make([]byte, 32) // Keccak-256 produces a 32-byte hash
@@ -39,7 +39,7 @@ func convertToEventSignature(header string) string {
 	}
 	// Calculate the hash and store it in the 'hash' slice
 	keccakHash.Sum(hash[:0])
-	signature := fmt.Sprintf("0x%x", hash)[:10]
+	signature := fmt.Sprintf("0x%x", hash)
 	log.Println(header[:strings.IndexByte(header, '(')], "signature: ", signature)
 
 	return signature
@@ -75,24 +75,72 @@ func parseJsonToAbi(jsonABI string) abi.ABI {
 
 // convertTransferAmount converts Transfer's hex amount into scaled actual amount of tokens
 func convertTransferAmount(amountHex string, decimals int) float64 {
-	amount := convertHexToBigInt(amountHex)
+	return convertAmount(convertHexToBigInt(amountHex), decimals)
+}
+
+// convertAmount converts raw integer token amount into scaled actual amount of tokens
+func convertAmount(amount *big.Int, decimals int) float64 {
 	amountFloat := new(big.Float).SetInt(amount)
 	scaleDecFactor := new(big.Float).SetFloat64(math.Pow10(decimals))
 	amountScaled, _ := new(big.Float).Quo(amountFloat, scaleDecFactor).Float64() // amount / 10^decimals
 	return amountScaled
 }
 
-func convertLogDataToHexAmounts(rawData string, eventName string) (string, string, error) {
-	hexString := strings.TrimPrefix(rawData, "0x")
-	data, err := hex.DecodeString(hexString)
+// convertHexToUint64 converts hex quantity (block number, indexes) into uint64. Invalid values are 0.
+func convertHexToUint64(hexStr string) uint64 {
+	res, err := strconv.ParseUint(strings.TrimPrefix(hexStr, "0x"), 16, 64)
+	if err != nil {
+		return 0
+	}
+	return res
+}
+
+// convertPoolIDToAddress extracts pool address from Balancer V2 pool ID - the address is its first 20 bytes.
+func convertPoolIDToAddress(poolID string) string {
+	poolID = strings.TrimPrefix(poolID, "0x")
+	if len(poolID) < 40 {
+		return ""
+	}
+	return "0x" + strings.ToLower(poolID[:40])
+}
+
+type swapData struct {
+	amount0      *big.Int
+	amount1      *big.Int
+	sqrtPriceX96 *big.Int
+	liquidity    *big.Int
+	tick         int
+}
 
-	var args = make(map[string]interface{})
-	err = uniswapLiqPoolsABI.UnpackIntoMap(args, eventName, []byte(data))
+// convertSwapLogData decodes Swap event data: pool deltas of tokens, price, active liquidity and tick after the swap.
+func convertSwapLogData(swapLog EventLog) (swapData, error) {
+	args, err := decodePoolLog(swapEvent, swapLog)
 	if err != nil {
-		return "", "", err
+		return swapData{}, err
 	}
+	return swapData{
+		amount0:      args.BigInt("amount0"),
+		amount1:      args.BigInt("amount1"),
+		sqrtPriceX96: args.BigInt("sqrtPriceX96"),
+		liquidity:    args.BigInt("liquidity"),
+		tick:         args.Int("tick"),
+	}, nil
+}
 
-	resAmount0Hex := "0x" + args["amount0"].(*big.Int).Text(16)
-	resAmount1Hex := "0x" + args["amount1"].(*big.Int).Text(16)
-	return resAmount0Hex, resAmount1Hex, nil
+// convertSqrtPriceX96ToPrice converts pool sqrt price (Q64.96) into price of token0 in token1 scaled by token decimals.
+func convertSqrtPriceX96ToPrice(sqrtPriceX96 *big.Int, token0Decimal, token1Decimal int) float64 {
+	sqrtPrice := new(big.Float).Quo(new(big.Float).SetInt(sqrtPriceX96), new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96)))
+	price, _ := new(big.Float).Mul(sqrtPrice, sqrtPrice).Float64()
+	return price * math.Pow10(token0Decimal-token1Decimal)
+}
+
+// sqrtPriceBeforeSwap estimates pool sqrt price before the swap from price after the swap, active liquidity and
+// token1 delta: Δ√P = Δy / L. It is exact as long as the swap did not cross initialized ticks.
+func sqrtPriceBeforeSwap(swap swapData) *big.Int {
+	if swap.liquidity.Sign() == 0 {
+		return new(big.Int)
+	}
+	delta := new(big.Int).Lsh(swap.amount1, 96)
+	delta.Quo(delta, swap.liquidity)
+	return new(big.Int).Sub(swap.sqrtPriceX96, delta)
 }
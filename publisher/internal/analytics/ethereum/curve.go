@@ -0,0 +1,144 @@
+package ethereum
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+)
+
+// Curve StableSwap events do not carry coin addresses. Coins are resolved from token transfers into and out of
+// the pool, which are made in the same transaction before the event is emitted.
+
+// processTokenExchange handles Curve TokenExchange. Coin of the lower index is the pool token0.
+func (sw *Swap) processTokenExchange(exchange WrappedEventLog) error {
+	args, err := decodeCurveLog(curveExchangeEvent, exchange.Log)
+	if err != nil {
+		return err
+	}
+	transferLogs, err := sw.cache.GetByTxHashAndLogType(exchange.Log.TransactionHash, transferEvent)
+	if err != nil {
+		return err
+	}
+	soldAmount, boughtAmount := args.BigInt("tokens_sold"), args.BigInt("tokens_bought")
+	soldLog, foundSold := findTransfer(transferLogs, exchange.Log.Address, true, "", soldAmount)
+	boughtLog, foundBought := findTransfer(transferLogs, exchange.Log.Address, false, "", boughtAmount)
+	if !foundSold || !foundBought {
+		return fmt.Errorf("could not find transfers of exchanged coins in tx %s", exchange.Log.TransactionHash)
+	}
+	sold, err := sw.lookupToken(soldLog.Address)
+	if err != nil {
+		return err
+	}
+	bought, err := sw.lookupToken(boughtLog.Address)
+	if err != nil {
+		return err
+	}
+
+	sw.Position = newPosition(exchange, sw.OperationBase.chain)
+	sw.Protocol = sw.protocol
+	sw.Sender, sw.Recipient = args.Address("buyer"), transferCounterparty(boughtLog, false)
+
+	in := TokenTransaction{Token: sold, Amount: convertAmount(soldAmount, sold.Decimals)} // Pool deltas
+	out := TokenTransaction{Token: bought, Amount: -convertAmount(boughtAmount, bought.Decimals)}
+	sw.Token0, sw.Token1 = in, out
+	if args.BigInt("sold_id").Cmp(args.BigInt("bought_id")) > 0 {
+		sw.Token0, sw.Token1 = out, in
+	}
+	if sw.Token0.Amount != 0 {
+		sw.ExecutionPrice = math.Abs(sw.Token1.Amount / sw.Token0.Amount) // Pool price is not reported
+	}
+	return sw.settle(sw.Token0.Address)
+}
+
+// processAddLiquidity handles Curve AddLiquidity of a two coin pool.
+func (add *Addition) processAddLiquidity(addLiquidity WrappedEventLog) error {
+	args, err := decodeCurveLog(curveAddLiquidityEvent, addLiquidity.Log)
+	if err != nil {
+		return err
+	}
+
+	add.Position = newPosition(addLiquidity, add.OperationBase.chain)
+	add.Protocol, add.FullRange = add.protocol, true
+	add.Owner, add.Sender = args.Address("provider"), args.Address("provider")
+
+	var payer string
+	add.Token0, add.Token1, payer, err = add.curveCoins(addLiquidity.Log, args.BigInts("token_amounts"), true)
+	if err != nil {
+		return err
+	}
+	if payer != "" {
+		add.Sender = payer
+	}
+
+	add.valueLiquidity(&add.Position, true)
+	return nil
+}
+
+// processRemoveLiquidity handles Curve RemoveLiquidity (withdrawal of both coins in balanced amounts) of a two coin pool.
+func (rem *Removal) processRemoveLiquidity(removeLiquidity WrappedEventLog) error {
+	args, err := decodeCurveLog(curveRemoveLiquidityEvent, removeLiquidity.Log)
+	if err != nil {
+		return err
+	}
+
+	rem.Position = newPosition(removeLiquidity, rem.OperationBase.chain)
+	rem.Protocol, rem.FullRange = rem.protocol, true
+	rem.Owner, rem.Recipient = args.Address("provider"), args.Address("provider")
+
+	var recipient string
+	rem.Token0, rem.Token1, recipient, err = rem.curveCoins(removeLiquidity.Log, args.BigInts("token_amounts"), false)
+	if err != nil {
+		return err
+	}
+	if recipient != "" {
+		rem.Recipient = recipient
+	}
+
+	rem.valueLiquidity(&rem.Position, false)
+	return nil
+}
+
+// curveCoins resolves coins of a two coin pool and their amounts deposited into (or withdrawn from) the pool,
+// together with the account that paid (or received) them. Coins that were not transferred are taken from the known pool.
+func (ob OperationBase) curveCoins(eLog EventLog, amounts []*big.Int, into bool) (TokenTransaction, TokenTransaction, string, error) {
+	if len(amounts) != 2 {
+		return TokenTransaction{}, TokenTransaction{}, "", fmt.Errorf("not a two coin pool %s", eLog.Address)
+	}
+	transferLogs, err := ob.cache.GetByTxHashAndLogType(eLog.TransactionHash, transferEvent)
+	if err != nil {
+		return TokenTransaction{}, TokenTransaction{}, "", err
+	}
+
+	var coins [2]TokenTransaction
+	var counterparty string
+	for i, amount := range amounts {
+		if amount.Sign() == 0 {
+			continue
+		}
+		transferLog, found := findTransfer(transferLogs, eLog.Address, into, "", amount)
+		if !found {
+			continue
+		}
+		t, err := ob.lookupToken(transferLog.Address)
+		if err != nil {
+			return TokenTransaction{}, TokenTransaction{}, "", err
+		}
+		coins[i] = TokenTransaction{Token: t, Amount: convertAmount(amount, t.Decimals)}
+		counterparty = transferCounterparty(transferLog, into)
+	}
+
+	if coins[0].Address == "" || coins[1].Address == "" { // E.g. single coin deposit, pool tokens are in coin order
+		token0, token1, err := ob.getTokensByPoolAddress(eLog.Address)
+		if err != nil {
+			return TokenTransaction{}, TokenTransaction{}, "", err
+		}
+		for i, t := range []repository.Token{token0, token1} {
+			if coins[i].Address == "" {
+				coins[i] = TokenTransaction{Token: t, Amount: convertAmount(amounts[i], t.Decimals)}
+			}
+		}
+	}
+	return coins[0], coins[1], counterparty, nil
+}
@@ -0,0 +1,166 @@
+package ethereum
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// eventArgs are decoded indexed and non-indexed arguments of an event log by their ABI names.
+// Values have go-ethereum ABI types: addresses are common.Address, integers wider than 64 bits
+// or of non-standard width (int24 ticks, uint128 liquidity, uint160 sqrt price) are *big.Int.
+type eventArgs map[string]interface{}
+
+// decodeEventLog decodes arguments of the log using the ABI event definition.
+func decodeEventLog(event abi.Event, eLog EventLog) (eventArgs, error) {
+	var indexed abi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if len(eLog.Topics) != len(indexed)+1 {
+		return nil, fmt.Errorf("%s log has %d topics; expected %d", event.Name, len(eLog.Topics), len(indexed)+1)
+	}
+
+	data, err := hex.DecodeString(strings.TrimPrefix(eLog.Data, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	args := make(eventArgs)
+	if err := event.Inputs.NonIndexed().UnpackIntoMap(args, data); err != nil {
+		return nil, err
+	}
+
+	topics := make([]common.Hash, 0, len(indexed))
+	for _, topic := range eLog.Topics[1:] {
+		topics = append(topics, common.HexToHash(topic))
+	}
+	if err := abi.ParseTopicsIntoMap(args, indexed, topics); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// decodePoolLog decodes Uniswap V3 pool event log (Mint, Burn, Collect, Swap).
+func decodePoolLog(eventName string, eLog EventLog) (eventArgs, error) {
+	event, found := uniswapLiqPoolsABI.Events[eventName]
+	if !found {
+		return nil, fmt.Errorf("unknown pool event %s", eventName)
+	}
+	return decodeEventLog(event, eLog)
+}
+
+// decodePositionsManagerLog decodes positions manager event log (IncreaseLiquidity, DecreaseLiquidity, Collect, Transfer).
+func decodePositionsManagerLog(eventName string, eLog EventLog) (eventArgs, error) {
+	event, found := uniswapPositionsManagerABI.Events[eventName]
+	if !found {
+		return nil, fmt.Errorf("unknown positions manager event %s", eventName)
+	}
+	return decodeEventLog(event, eLog)
+}
+
+// decodeCurveLog decodes Curve StableSwap pool event log (TokenExchange, AddLiquidity, RemoveLiquidity).
+func decodeCurveLog(eventName string, eLog EventLog) (eventArgs, error) {
+	event, found := curveStableSwapABI.Events[eventName]
+	if !found {
+		return nil, fmt.Errorf("unknown Curve pool event %s", eventName)
+	}
+	return decodeEventLog(event, eLog)
+}
+
+// decodeVaultLog decodes Balancer V2 Vault event log (Swap, PoolBalanceChanged).
+func decodeVaultLog(eventName string, eLog EventLog) (eventArgs, error) {
+	event, found := balancerVaultABI.Events[eventName]
+	if !found {
+		return nil, fmt.Errorf("unknown Balancer Vault event %s", eventName)
+	}
+	return decodeEventLog(event, eLog)
+}
+
+// decodePoolManagerLog decodes Uniswap V4 PoolManager event log (Initialize, ModifyLiquidity, Swap).
+func decodePoolManagerLog(eventName string, eLog EventLog) (eventArgs, error) {
+	event, found := uniswapPoolManagerABI.Events[eventName]
+	if !found {
+		return nil, fmt.Errorf("unknown PoolManager event %s", eventName)
+	}
+	return decodeEventLog(event, eLog)
+}
+
+// decodeTokenLog decodes ERC20 token event log (Transfer). ERC721 transfers have tokenId indexed and are not decoded.
+func decodeTokenLog(eventName string, eLog EventLog) (eventArgs, error) {
+	event, found := ethereumErc20TokenABI.Events[eventName]
+	if !found {
+		return nil, fmt.Errorf("unknown token event %s", eventName)
+	}
+	return decodeEventLog(event, eLog)
+}
+
+// Address returns lowercase hex of the address argument, empty if there is no such address argument.
+func (ea eventArgs) Address(name string) string {
+	address, ok := ea[name].(common.Address)
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(address.Hex())
+}
+
+// BigInt returns integer argument, zero if there is no such integer argument.
+// Bytes32 argument holding an integer (e.g. V4 position salt of PositionManager NFT) is read as uint256.
+func (ea eventArgs) BigInt(name string) *big.Int {
+	switch value := ea[name].(type) {
+	case *big.Int:
+		return value
+	case [32]byte:
+		return new(big.Int).SetBytes(value[:])
+	case uint8:
+		return new(big.Int).SetUint64(uint64(value))
+	case uint16:
+		return new(big.Int).SetUint64(uint64(value))
+	case uint32:
+		return new(big.Int).SetUint64(uint64(value))
+	case uint64:
+		return new(big.Int).SetUint64(value)
+	case int8:
+		return big.NewInt(int64(value))
+	case int16:
+		return big.NewInt(int64(value))
+	case int32:
+		return big.NewInt(int64(value))
+	case int64:
+		return big.NewInt(value)
+	}
+	return new(big.Int)
+}
+
+// Int returns small integer argument, e.g. int24 tick.
+func (ea eventArgs) Int(name string) int {
+	return int(ea.BigInt(name).Int64())
+}
+
+// Addresses returns lowercase hex of the address array argument.
+func (ea eventArgs) Addresses(name string) []string {
+	addresses, _ := ea[name].([]common.Address)
+	res := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		res = append(res, strings.ToLower(address.Hex()))
+	}
+	return res
+}
+
+// BigInts returns integer array argument of any length, e.g. uint256[2] Curve amounts or int256[] Balancer deltas.
+func (ea eventArgs) BigInts(name string) []*big.Int {
+	switch values := ea[name].(type) {
+	case []*big.Int:
+		return values
+	case [2]*big.Int:
+		return values[:]
+	case [3]*big.Int:
+		return values[:]
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package ethereum
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+// depthMap maintains net liquidity of initialized ticks of every pool from Mint and Burn events:
+// liquidity is added at the lower tick and subtracted at the upper tick of the position range.
+// Liquidity changes are stored, so that the map can be rebuilt on start.
+type depthMap struct {
+	mu    sync.Mutex
+	db    Database
+	pools map[string]*poolDepth
+}
+
+type poolDepth struct {
+	address string
+	ticks   map[int]*big.Int // Net liquidity change when price crosses the tick upwards
+	changed bool             // Changed since the last snapshot
+}
+
+// depthRange is liquidity active between two neighbouring initialized ticks.
+type depthRange struct {
+	lowerTick int
+	upperTick int
+	liquidity *big.Int
+}
+
+func newDepthMap(db Database) *depthMap {
+	return &depthMap{
+		db:    db,
+		pools: make(map[string]*poolDepth),
+	}
+}
+
+// Rebuild replaces the map with net liquidity of ticks summed up in DB from the stored liquidity changes.
+func (dm *depthMap) Rebuild() {
+	ticks := dm.db.GetTickLiquidity()
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	dm.pools = make(map[string]*poolDepth)
+	for _, tick := range ticks {
+		dm.pool(tick.LPoolAddress).addTick(tick.Tick, parseBigInt(tick.Liquidity))
+	}
+}
+
+// Update stores liquidity of pool Mint or Burn event and applies it to the map. Other events are ignored, and so are
+// events stored before (e.g. replayed logs), so that their liquidity is not counted twice.
+func (dm *depthMap) Update(wel WrappedEventLog) error {
+	if wel.Instructions.Name != mintEvent && wel.Instructions.Name != burnEvent {
+		return nil
+	}
+	change, err := newLiquidityChange(wel)
+	if err != nil || change.Liquidity == "0" { // Burn of zero liquidity only updates fees owed
+		return err
+	}
+	if inserted, err := dm.db.SaveLiquidityChange(change); err != nil || !inserted {
+		return err
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	dm.apply(change)
+	return nil
+}
+
+func (dm *depthMap) apply(change repository.LiquidityChange) {
+	depth := dm.pool(change.LPoolAddress)
+	liquidity := parseBigInt(change.Liquidity)
+	depth.addTick(change.LowerTick, liquidity)
+	depth.addTick(change.UpperTick, new(big.Int).Neg(liquidity))
+	depth.changed = true
+}
+
+func (dm *depthMap) pool(address string) *poolDepth {
+	depth, found := dm.pools[strings.ToLower(address)]
+	if !found {
+		depth = &poolDepth{address: address, ticks: make(map[int]*big.Int)}
+		dm.pools[strings.ToLower(address)] = depth
+	}
+	return depth
+}
+
+func (pd *poolDepth) addTick(tick int, liquidity *big.Int) {
+	net, found := pd.ticks[tick]
+	if !found {
+		net = new(big.Int)
+		pd.ticks[tick] = net
+	}
+	net.Add(net, liquidity)
+	if net.Sign() == 0 { // Tick is no longer initialized
+		delete(pd.ticks, tick)
+	}
+}
+
+// Snapshot returns liquidity ranges of pools changed since the previous snapshot.
+func (dm *depthMap) Snapshot() map[string][]depthRange {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	res := make(map[string][]depthRange)
+	for _, depth := range dm.pools {
+		if !depth.changed {
+			continue
+		}
+		depth.changed = false
+		res[depth.address] = depth.ranges()
+	}
+	return res
+}
+
+// ActiveRange returns neighbouring initialized ticks of the pool around the tick: lower <= tick < upper.
+// Ticks are known even if the pool history is incomplete, only their accumulated liquidity is not.
+func (dm *depthMap) ActiveRange(poolAddress string, tick int) (int, int, bool) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	depth, found := dm.pools[strings.ToLower(poolAddress)]
+	if !found {
+		return 0, 0, false
+	}
+	lower, upper, foundLower, foundUpper := 0, 0, false, false
+	for t := range depth.ticks {
+		if t <= tick && (!foundLower || t > lower) {
+			lower, foundLower = t, true
+		}
+		if t > tick && (!foundUpper || t < upper) {
+			upper, foundUpper = t, true
+		}
+	}
+	return lower, upper, foundLower && foundUpper
+}
+
+// ranges accumulates net liquidity of ticks in ascending order. Ranges without liquidity are skipped.
+func (pd *poolDepth) ranges() []depthRange {
+	ticks := make([]int, 0, len(pd.ticks))
+	for tick := range pd.ticks {
+		ticks = append(ticks, tick)
+	}
+	sort.Ints(ticks)
+
+	var res []depthRange
+	liquidity := new(big.Int)
+	for i := 0; i+1 < len(ticks); i++ {
+		liquidity.Add(liquidity, pd.ticks[ticks[i]])
+		if liquidity.Sign() <= 0 {
+			continue
+		}
+		res = append(res, depthRange{lowerTick: ticks[i], upperTick: ticks[i+1], liquidity: new(big.Int).Set(liquidity)})
+	}
+	return res
+}
+
+// newLiquidityChange decodes position range and liquidity of pool Mint or Burn event. Burned liquidity is negative.
+func newLiquidityChange(wel WrappedEventLog) (repository.LiquidityChange, error) {
+	args, err := decodePoolLog(wel.Instructions.Name, wel.Log)
+	if err != nil {
+		return repository.LiquidityChange{}, err
+	}
+	liquidity := args.BigInt("amount")
+	if wel.Instructions.Name == burnEvent {
+		liquidity = new(big.Int).Neg(liquidity)
+	}
+	return repository.LiquidityChange{
+		LPoolAddress: wel.Log.Address,
+		TxHash:       wel.Log.TransactionHash,
+		LogIndex:     convertHexToUint64(wel.Log.LogIndex),
+		LowerTick:    args.Int("tickLower"),
+		UpperTick:    args.Int("tickUpper"),
+		Liquidity:    liquidity.String(),
+	}, nil
+}
+
+func newDepthMessage(poolAddress string, ranges []depthRange, token0, token1 repository.Token, chainID int64, timestamp time.Time) types.DepthMessage {
+	msg := types.DepthMessage{
+		Timestamp: timestamp,
+		ChainID:   chainID,
+		Address:   poolAddress,
+		Base:      token0.Symbol,
+		Quote:     token1.Symbol,
+		Ranges:    make([]types.DepthRangeMessage, 0, len(ranges)),
+	}
+	for _, r := range ranges {
+		msg.Ranges = append(msg.Ranges, types.DepthRangeMessage{
+			LowerTick:  r.lowerTick,
+			UpperTick:  r.upperTick,
+			LowerPrice: convertTickToRatio(r.lowerTick, token0.Decimals, token1.Decimals),
+			UpperPrice: convertTickToRatio(r.upperTick, token0.Decimals, token1.Decimals),
+			Liquidity:  r.liquidity.String(),
+		})
+	}
+	return msg
+}
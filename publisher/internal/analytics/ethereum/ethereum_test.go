@@ -4,9 +4,15 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Synternet/swapscope/publisher/internal/filter"
 	"github.com/Synternet/swapscope/publisher/pkg/repository"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 var knownTokens = map[string]TokenTransaction{
@@ -41,6 +47,7 @@ func Test_tickConversion(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
+			test.input.chain = Ethereum
 			test.input.calculate()
 			resLowerRatio := test.input.LowerRatio
 			resUpperRatio := test.input.UpperRatio
@@ -59,9 +66,9 @@ func Test_eventSignatureConversion(t *testing.T) {
 		inputHeader  string
 		trueEventSig string
 	}{
-		{"convert Mint header to sig", "Mint(address,address,int24,int24,uint128,uint256,uint256)", "0x7a53080b"},
-		{"convert Transfer header to sig", "Transfer(address,address,uint256)", "0xddf252ad"},
-		{"convert Burn header to sig", "Burn(address,int24,int24,uint128,uint256,uint256)", "0x0c396cd9"},
+		{"convert Mint header to sig", "Mint(address,address,int24,int24,uint128,uint256,uint256)", "0x7a53080ba414158be7ec69b987b5fb7d07dee101fe85488f0853ae16239d0bde"},
+		{"convert Transfer header to sig", "Transfer(address,address,uint256)", "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"},
+		{"convert Burn header to sig", "Burn(address,int24,int24,uint128,uint256,uint256)", "0x0c396cd989a39f4459b5fa1aed6a9a8dcdbc45908acfd67e028cd568da98982c"},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -73,6 +80,64 @@ func Test_eventSignatureConversion(t *testing.T) {
 	}
 }
 
+// parseTestABIs parses ABIs of all protocols as New does.
+func parseTestABIs() {
+	uniswapLiqPoolsABI = parseJsonToAbi(uniswapLiqPoolsABIJson)
+	ethereumErc20TokenABI = parseJsonToAbi(ethereumErc20TokenABIJson)
+	uniswapPositionsManagerABI = parseJsonToAbi(uniswapPositionsManagerABIJson)
+	pancakeSwapPoolABI = parseJsonToAbi(pancakeSwapPoolABIJson)
+	curveStableSwapABI = parseJsonToAbi(curveStableSwapABIJson)
+	balancerVaultABI = parseJsonToAbi(balancerVaultABIJson)
+	uniswapPoolManagerABI = parseJsonToAbi(uniswapPoolManagerABIJson)
+}
+
+func Test_eventRegistryLookup(t *testing.T) {
+	parseTestABIs()
+	a := &Analytics{Options: Options{chain: Ethereum}, events: newEventRegistry()}
+	a.registerEvents()
+
+	mintTopic := "0x7a53080ba414158be7ec69b987b5fb7d07dee101fe85488f0853ae16239d0bde"
+	transferTopic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	increaseTopic := convertToEventSignature(uniswapPositionsManagerABI.Events[increaseLiquidityEvent].Sig)
+	pancakeSwapTopic := convertToEventSignature(pancakeSwapPoolABI.Events[swapEvent].Sig)
+	exchangeTopic := convertToEventSignature(curveStableSwapABI.Events[curveExchangeEvent].Sig)
+	vaultSwapTopic := convertToEventSignature(balancerVaultABI.Events[swapEvent].Sig)
+	v4SwapTopic := convertToEventSignature(uniswapPoolManagerABI.Events[swapEvent].Sig)
+	flashTopic := convertToEventSignature(uniswapLiqPoolsABI.Events[flashEvent].Sig)
+	pancakeManager := "0x46a15b0b27311cedf172ab29e4f4766fbe7f4364"
+	vault := "0xba12222222228d8ba445958a75a0704d566bf2c8"
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	tests := []struct {
+		name     string
+		log      EventLog
+		expected string // Empty if no handler is expected
+	}{
+		{"pool Mint", EventLog{Address: pool, Topics: []string{mintTopic, "0x1", "0x2", "0x3"}}, mintEvent},
+		{"upper case topic", EventLog{Address: pool, Topics: []string{"0x" + strings.ToUpper(mintTopic[2:]), "0x1", "0x2", "0x3"}}, mintEvent},
+		{"4-byte prefix only", EventLog{Address: pool, Topics: []string{mintTopic[:10] + strings.Repeat("0", 56)}}, ""},
+		{"ERC20 Transfer", EventLog{Address: knownTokens["WETH"].Address, Topics: []string{transferTopic, "0x1", "0x2"}}, transferEvent},
+		{"position NFT Transfer", EventLog{Address: Ethereum.PositionsManager, Topics: []string{transferTopic, "0x1", "0x2", "0x3"}}, positionTransferEvent},
+		{"other NFT Transfer", EventLog{Address: pool, Topics: []string{transferTopic, "0x1", "0x2", "0x3"}}, transferEvent},
+		{"positions manager IncreaseLiquidity", EventLog{Address: strings.ToLower(Ethereum.PositionsManager), Topics: []string{increaseTopic, "0x1"}}, increaseLiquidityEvent},
+		{"IncreaseLiquidity of other contract", EventLog{Address: pool, Topics: []string{increaseTopic, "0x1"}}, ""},
+		{"PancakeSwap positions manager IncreaseLiquidity", EventLog{Address: pancakeManager, Topics: []string{increaseTopic, "0x1"}}, increaseLiquidityEvent},
+		{"PancakeSwap pool Swap", EventLog{Address: pool, Topics: []string{pancakeSwapTopic, "0x1", "0x2"}}, swapEvent},
+		{"Curve TokenExchange", EventLog{Address: pool, Topics: []string{exchangeTopic, "0x1"}}, curveExchangeEvent},
+		{"Balancer Vault Swap", EventLog{Address: vault, Topics: []string{vaultSwapTopic, "0x1", "0x2", "0x3"}}, vaultSwapEvent},
+		{"Balancer Swap of other contract", EventLog{Address: pool, Topics: []string{vaultSwapTopic, "0x1", "0x2", "0x3"}}, ""},
+		{"pool Flash", EventLog{Address: pool, Topics: []string{flashTopic, "0x1", "0x2"}}, flashEvent},
+		{"PoolManager Swap", EventLog{Address: strings.ToLower(Ethereum.PoolManager), Topics: []string{v4SwapTopic, "0x1", "0x2"}}, v4SwapEvent},
+		{"V4 Swap of other contract", EventLog{Address: pool, Topics: []string{v4SwapTopic, "0x1", "0x2"}}, ""},
+		{"no topics", EventLog{Address: pool}, ""},
+	}
+	for _, test := range tests {
+		handler, found := a.events.Lookup(test.log)
+		if found != (test.expected != "") || handler.name != test.expected {
+			t.Errorf("Lookup(%s) = (%v, %v); expected (%v)", test.name, handler.name, found, test.expected)
+		}
+	}
+}
+
 func Test_hexToBigIntConversion(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -125,13 +190,19 @@ func Test_hexToTokenAmountConversion(t *testing.T) {
 	}
 }
 
-func Test_isUniswapPositionsNFT(t *testing.T) {
+func Test_isPositionsManager(t *testing.T) {
+	parseTestABIs()
+	a := &Analytics{Options: Options{chain: Ethereum}, events: newEventRegistry()}
+	a.registerEvents()
+
 	tests := []struct {
 		name         string
 		inputAddress string
 		trueRes      bool
 	}{
 		{"Uniswap address", "0xc36442b4a4522e871399cd717abdd847ab11fe88", true},
+		{"PancakeSwap address", "0x46a15b0b27311cedf172ab29e4f4766fbe7f4364", true},
+		{"Padded topic", "0x00000000000000000000000046a15b0b27311cedf172ab29e4f4766fbe7f4364", true},
 		{"Empty string", "", false},
 		{"Empty hex", "0x", false},
 		{"Not full hex", "C36442b4a4522E871399CD717aBDD847Ab11FE88", false},
@@ -139,9 +210,9 @@ func Test_isUniswapPositionsNFT(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			res := isUniswapPositionsNFT(test.inputAddress)
+			res := a.isPositionsManager(test.inputAddress)
 			if res != test.trueRes {
-				t.Errorf("isUniswapPositionsNFT(%v) = (%v); expected (%v)", test.inputAddress, res, test.trueRes)
+				t.Errorf("isPositionsManager(%v) = (%v); expected (%v)", test.inputAddress, res, test.trueRes)
 			}
 		})
 	}
@@ -185,7 +256,7 @@ func Test_isToken1Native(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			res := test.input.isToken1OneOf(nativeCoins)
+			res := test.input.isToken1OneOf(Ethereum.Native)
 			if res != test.trueRes {
 				t.Errorf("isToken1Native(%v) = (%v); expected (%v)", test.input, res, test.trueRes)
 			}
@@ -210,7 +281,7 @@ func Test_isToken1Stable(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			res := test.input.isToken1OneOf(stableCoins)
+			res := test.input.isToken1OneOf(Ethereum.Stable)
 			if res != test.trueRes {
 				t.Errorf("isToken1Stable(%v) = (%v); expected (%v)", test.input, res, test.trueRes)
 			}
@@ -231,7 +302,7 @@ func Test_isNativeInvolved(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			res := test.input.isAnyTokenOneOf(nativeCoins)
+			res := test.input.isAnyTokenOneOf(Ethereum.Native)
 			if res != test.trueRes {
 				t.Errorf("isNativeInvolved(%v) = (%v); expected (%v)", test.input, res, test.trueRes)
 			}
@@ -252,7 +323,7 @@ func Test_isStableInvolved(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			res := test.input.isAnyTokenOneOf(stableCoins)
+			res := test.input.isAnyTokenOneOf(Ethereum.Stable)
 			if res != test.trueRes {
 				t.Errorf("isStableInvolved(%v) = (%v); expected (%v)", test.input, res, test.trueRes)
 			}
@@ -309,3 +380,1452 @@ func Test_isEitherTokenAmountIsZero(t *testing.T) {
 		})
 	}
 }
+
+func Test_decodeEventLog(t *testing.T) {
+	uniswapLiqPoolsABI = parseJsonToAbi(uniswapLiqPoolsABIJson)
+	uniswapPositionsManagerABI = parseJsonToAbi(uniswapPositionsManagerABIJson)
+	word := func(v int64) string { // 32 byte two's complement
+		return fmt.Sprintf("%064x", new(big.Int).And(big.NewInt(v), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))))
+	}
+	manager := "000000000000000000000000c36442b4a4522e871399cd717abdd847ab11fe88"
+	owner := "000000000000000000000000d8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"
+
+	mintLog := EventLog{
+		Topics: []string{"0x7a53080ba414158be7ec69b987b5fb7d07dee101fe85488f0853ae16239d0bde", "0x" + manager, "0x" + word(-887220), "0x" + word(887220)},
+		Data:   "0x" + manager + word(1_000_000) + word(500) + word(600),
+	}
+	mint, err := decodePoolLog(mintEvent, mintLog)
+	if err != nil {
+		t.Fatalf("decodePoolLog(Mint) = (%v); expected (nil)", err)
+	}
+	if mint.Address("sender") != "0xc36442b4a4522e871399cd717abdd847ab11fe88" || mint.Address("owner") != "0xc36442b4a4522e871399cd717abdd847ab11fe88" ||
+		mint.Int("tickLower") != -887220 || mint.Int("tickUpper") != 887220 || mint.BigInt("amount").Int64() != 1_000_000 || mint.BigInt("amount1").Int64() != 600 {
+		t.Errorf("decodePoolLog(Mint) = (%v); expected (sender, owner, -887220, 887220, 1000000, 500, 600)", mint)
+	}
+
+	swapLog := EventLog{
+		Topics: []string{"0xc42079f94a6350d7e6235f29174924f928cc2ac818eb64fed8004e115fbcca67", "0x" + manager, "0x" + owner},
+		Data:   "0x" + word(-1500) + word(2000) + word(1<<40) + word(123456) + word(-201000),
+	}
+	swap, err := convertSwapLogData(swapLog)
+	if err != nil {
+		t.Fatalf("convertSwapLogData() = (%v); expected (nil)", err)
+	}
+	if swap.amount0.Int64() != -1500 || swap.amount1.Int64() != 2000 || swap.sqrtPriceX96.Int64() != 1<<40 || swap.liquidity.Int64() != 123456 || swap.tick != -201000 {
+		t.Errorf("convertSwapLogData() = (%+v); expected (-1500, 2000, %d, 123456, -201000)", swap, int64(1<<40))
+	}
+
+	transferLog := EventLog{Topics: []string{"0x", "0x" + word(0), "0x" + owner, "0x" + word(674591)}}
+	transfer, err := decodePositionsManagerLog(transferEvent, transferLog)
+	if err != nil || transfer.Address("to") != "0xd8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b" || transfer.BigInt("tokenId").String() != "674591" {
+		t.Errorf("decodePositionsManagerLog(Transfer) = (%v, %v); expected (to, 674591)", transfer, err)
+	}
+
+	if _, err := decodePoolLog(burnEvent, EventLog{Topics: []string{"0x"}, Data: "0x"}); err == nil {
+		t.Errorf("decodePoolLog(Burn without indexed topics) = (nil); expected error")
+	}
+}
+
+func Test_hasSamePositionData(t *testing.T) {
+	liquidity := "00000000000000000000000000000000000000000000000000001d1a94a20000"
+	amount0 := "0000000000000000000000000000000000000000000000000000000074f62ca3"
+	amount1 := "000000000000000000000000000000000000000000000000015e6fc4aea528f1"
+	sender := "000000000000000000000000c36442b4a4522e871399cd717abdd847ab11fe88"
+	recipient := "000000000000000000000000d8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"
+
+	tests := []struct {
+		name         string
+		poolData     string
+		positionData string
+		trueRes      bool
+	}{
+		{"Mint and IncreaseLiquidity", "0x" + sender + liquidity + amount0 + amount1, "0x" + liquidity + amount0 + amount1, true},
+		{"Burn and DecreaseLiquidity", "0x" + liquidity + amount0 + amount1, "0x" + liquidity + amount0 + amount1, true},
+		{"pool and positions manager Collect", "0x" + recipient + amount0 + amount1, "0x" + recipient + amount0 + amount1, true},
+		{"Collect of other recipient", "0x" + sender + amount0 + amount1, "0x" + recipient + amount0 + amount1, false},
+		{"Different amounts", "0x" + sender + liquidity + amount1 + amount0, "0x" + liquidity + amount0 + amount1, false},
+		{"Empty position data", "0x" + liquidity + amount0 + amount1, "0x", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := hasSamePositionData(EventLog{Data: test.poolData}, EventLog{Data: test.positionData})
+			if res != test.trueRes {
+				t.Errorf("hasSamePositionData(%v, %v) = (%v); expected (%v)", test.poolData, test.positionData, res, test.trueRes)
+			}
+		})
+	}
+}
+
+func Test_positionLedgerReport(t *testing.T) {
+	ledger := positionLedger{repository.PositionLedger{
+		Token0Address:   knownTokens["WETH"].Address,
+		Token1Address:   knownTokens["USDC"].Address,
+		Token0Deposited: 1,
+		Token1Deposited: 2000,
+		Token0Withdrawn: 0.8,
+		Token1Withdrawn: 2400,
+		DepositedUSD:    4000,
+		WithdrawnUSD:    4400,
+		FeesUSD:         50,
+	}}
+
+	report := ledger.report(2500, 1, time.Now())
+	tests := []struct {
+		name      string
+		res       float64
+		trueValue float64
+	}{
+		{"HODL value", report.HodlUSD, 4500},
+		{"impermanent loss USD", report.ImpermanentLossUSD, -100},
+		{"impermanent loss", report.ImpermanentLoss, -100.0 / 4500},
+		{"PnL", report.PnlUSD, 450},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if math.Abs(test.res-test.trueValue) > tolerance {
+				t.Errorf("%s = (%v); expected (%v)", test.name, test.res, test.trueValue)
+			}
+		})
+	}
+
+	token0, token1 := ledger.align(knownTokens["USDC"], knownTokens["WETH"])
+	if token0.Symbol != "WETH" || token1.Symbol != "USDC" {
+		t.Errorf("align(USDC, WETH) = (%s, %s); expected (WETH, USDC)", token0.Symbol, token1.Symbol)
+	}
+}
+
+type testPositionDB struct {
+	Database
+	positions map[string]repository.LiquidityPosition // By token ID
+	owed      map[string]repository.OwedTokens        // By pool, owner and ticks
+}
+
+func (db testPositionDB) GetPosition(tokenID string) (repository.LiquidityPosition, bool) {
+	pos, found := db.positions[tokenID]
+	return pos, found
+}
+
+func (db testPositionDB) SavePosition(pos repository.LiquidityPosition) error {
+	db.positions[pos.TokenID] = pos
+	return nil
+}
+
+func (db testPositionDB) GetOwedTokens(lpAddress, owner string, lowerTick, upperTick int) (repository.OwedTokens, bool) {
+	owed, found := db.owed[fmt.Sprint(lpAddress, owner, lowerTick, upperTick)]
+	return owed, found
+}
+
+func (db testPositionDB) SaveOwedTokens(owed repository.OwedTokens) error {
+	db.owed[fmt.Sprint(owed.LPoolAddress, owed.Owner, owed.LowerTick, owed.UpperTick)] = owed
+	return nil
+}
+
+func Test_positionTrackerWithdrawn(t *testing.T) {
+	uniswapLiqPoolsABI = parseJsonToAbi(uniswapLiqPoolsABIJson)
+	uniswapPositionsManagerABI = parseJsonToAbi(uniswapPositionsManagerABIJson)
+	word := func(v int64) string {
+		return fmt.Sprintf("%064x", new(big.Int).And(big.NewInt(v), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))))
+	}
+	const pool = "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	manager := "000000000000000000000000c36442b4a4522e871399cd717abdd847ab11fe88"
+	owner := "000000000000000000000000d8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"
+	poolLog := func(name, who string, amount0, amount1 int64) WrappedEventLog {
+		return WrappedEventLog{
+			Log:          EventLog{Address: pool, Topics: []string{"0x", "0x" + who, "0x" + word(-600), "0x" + word(600)}, Data: "0x" + owner + word(amount0) + word(amount1)},
+			Instructions: EventInstruction{Name: name},
+		}
+	}
+	positionLog := func(name string, amount0, amount1 int64) WrappedEventLog {
+		return WrappedEventLog{
+			Log:          EventLog{Address: "0xc36442b4a4522e871399cd717abdd847ab11fe88", Topics: []string{"0x", "0x" + word(674591)}, Data: "0x" + owner + word(amount0) + word(amount1)},
+			Instructions: EventInstruction{Name: name},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		updates    []WrappedEventLog
+		collect    WrappedEventLog
+		tokenID    string
+		withdrawn0 int64
+		withdrawn1 int64
+	}{
+		{"direct burn collected in later tx", []WrappedEventLog{poolLog(burnEvent, owner, 1000, 2000)}, poolLog(collectEvent, owner, 1010, 2020), "", 1000, 2000},
+		{"direct fees only collect", nil, poolLog(collectEvent, owner, 10, 20), "", 0, 0},
+		{"direct burn collected twice", []WrappedEventLog{poolLog(burnEvent, owner, 1000, 2000), poolLog(collectEvent, owner, 600, 2000)}, poolLog(collectEvent, owner, 500, 20), "", 400, 0},
+		{"direct burn of zero liquidity", []WrappedEventLog{poolLog(burnEvent, owner, 0, 0)}, poolLog(collectEvent, owner, 10, 20), "", 0, 0},
+		{"positions manager decrease collected in later tx", []WrappedEventLog{poolLog(burnEvent, manager, 1000, 2000), positionLog(decreaseLiquidityEvent, 1000, 2000)},
+			poolLog(collectEvent, manager, 1010, 2020), "674591", 1000, 2000},
+		{"positions manager fees only collect", []WrappedEventLog{poolLog(burnEvent, manager, 1000, 2000), positionLog(decreaseLiquidityEvent, 1000, 2000), positionLog(positionCollectEvent, 1010, 2020)},
+			poolLog(collectEvent, manager, 10, 20), "674591", 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := testPositionDB{
+				positions: map[string]repository.LiquidityPosition{"674591": {TokenID: "674591", LPoolAddress: pool, LowerTick: -600, UpperTick: 600, Liquidity: "1000000"}},
+				owed:      map[string]repository.OwedTokens{},
+			}
+			pt := positionTracker{db: db, chain: Ethereum, isPositionsManager: func(address string) bool {
+				return strings.EqualFold(address, Ethereum.PositionsManager)
+			}}
+			for _, wel := range test.updates {
+				if err := pt.Update(wel); err != nil {
+					t.Fatalf("Update(%s) = (%v); expected (nil)", wel.Instructions.Name, err)
+				}
+			}
+			withdrawn0, withdrawn1, err := pt.withdrawn(test.collect.Log, test.tokenID)
+			if err != nil || withdrawn0.Int64() != test.withdrawn0 || withdrawn1.Int64() != test.withdrawn1 {
+				t.Errorf("withdrawn() = (%v, %v, %v); expected (%v, %v, nil)", withdrawn0, withdrawn1, err, test.withdrawn0, test.withdrawn1)
+			}
+		})
+	}
+}
+
+type testDB struct {
+	Database
+	openPositions []repository.LiquidityPosition
+}
+
+func (db testDB) GetOpenPositions(string) []repository.LiquidityPosition {
+	return db.openPositions
+}
+
+func swapLogWithTick(pool string, tick int64) WrappedEventLog {
+	word := func(v int64) string {
+		return fmt.Sprintf("%064x", new(big.Int).And(big.NewInt(v), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))))
+	}
+	return WrappedEventLog{
+		Log:          EventLog{Address: pool, Topics: []string{"0x", "0x" + word(1), "0x" + word(2)}, Data: "0x" + word(-1000) + word(500) + word(1) + word(1) + word(tick)},
+		Instructions: EventInstruction{Name: swapEvent},
+	}
+}
+
+func Test_rangeMonitorTransitions(t *testing.T) {
+	uniswapLiqPoolsABI = parseJsonToAbi(uniswapLiqPoolsABIJson)
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	db := testDB{openPositions: []repository.LiquidityPosition{
+		{TokenID: "1", LPoolAddress: pool, LowerTick: -100, UpperTick: 100, Liquidity: "1000"},
+	}}
+	rm := newRangeMonitor(db, Ethereum)
+
+	var published []string
+	send := func(data any, subjects ...string) error {
+		published = append(published, subjects[len(subjects)-1])
+		return nil
+	}
+
+	ticks := []int64{0, 50, 100, 150, 99, -100, -101}
+	for _, tick := range ticks {
+		if err := rm.Update(swapLogWithTick(pool, tick), send, time.Now()); err != nil {
+			t.Fatalf("Update(tick %d) returned error: %v", tick, err)
+		}
+	}
+
+	expected := []string{"out-of-range", "in-range", "out-of-range"}
+	if fmt.Sprint(published) != fmt.Sprint(expected) {
+		t.Errorf("published transitions = (%v); expected (%v)", published, expected)
+	}
+
+	rm.Track(repository.LiquidityPosition{TokenID: "1", LPoolAddress: pool, Liquidity: "0"})
+	if n := len(rm.pools[pool].positions); n != 0 {
+		t.Errorf("positions without liquidity monitored = (%d); expected (0)", n)
+	}
+}
+
+func Test_sqrtPriceX96ToPriceConversion(t *testing.T) {
+	q96 := new(big.Int).Lsh(big.NewInt(1), 96)
+	sqrtPriceX96 := func(sqrtPrice float64) *big.Int {
+		res, _ := new(big.Float).Mul(big.NewFloat(sqrtPrice), new(big.Float).SetInt(q96)).Int(nil)
+		return res
+	}
+
+	tests := []struct {
+		name         string
+		sqrtPriceX96 *big.Int
+		token0       repository.Token
+		token1       repository.Token
+		truePrice    float64
+	}{
+		{"equal decimals", q96, knownTokens["PEPE"].Token, knownTokens["WETH"].Token, 1},
+		{"USDC / WETH at 2000 USDC", sqrtPriceX96(math.Sqrt(1e12 / 2000)), knownTokens["USDC"].Token, knownTokens["WETH"].Token, 1.0 / 2000},
+		{"WBTC / WETH at 16 WETH", sqrtPriceX96(math.Sqrt(16 * 1e10)), knownTokens["WBTC"].Token, knownTokens["WETH"].Token, 16},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := convertSqrtPriceX96ToPrice(test.sqrtPriceX96, test.token0.Decimals, test.token1.Decimals)
+			if math.Abs(res/test.truePrice-1) > 1e-9 {
+				t.Errorf("convertSqrtPriceX96ToPrice(%v) = (%v); expected (%v)", test.sqrtPriceX96, res, test.truePrice)
+			}
+		})
+	}
+
+	swap := swapData{
+		amount1:      big.NewInt(1_000_000),
+		liquidity:    big.NewInt(1_000_000),
+		sqrtPriceX96: new(big.Int).Mul(big.NewInt(3), q96),
+	}
+	if res := sqrtPriceBeforeSwap(swap); res.Cmp(new(big.Int).Mul(big.NewInt(2), q96)) != 0 {
+		t.Errorf("sqrtPriceBeforeSwap() = (%v); expected (%v)", res, new(big.Int).Mul(big.NewInt(2), q96))
+	}
+}
+
+func testSwapOperation(txIndex uint64, actor string, from, to TokenTransaction, fromAmount, toAmount float64) blockOperation {
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	from.Amount, to.Amount = fromAmount, toAmount
+	return blockOperation{
+		Operation: &Swap{From: from, To: to, Sender: actor, Recipient: actor, Position: Position{Address: pool, TxHash: fmt.Sprintf("0x%d", txIndex)}},
+		Log:       EventLog{Address: pool},
+		txIndex:   txIndex,
+	}
+}
+
+// testV4SwapOperation returns swap of Uniswap V4 pool, which is emitted by PoolManager for every pool.
+func testV4SwapOperation(txIndex uint64, poolID, actor string, from, to TokenTransaction, fromAmount, toAmount float64) blockOperation {
+	op := testSwapOperation(txIndex, actor, from, to, fromAmount, toAmount)
+	op.Operation.(*Swap).Address = poolID
+	op.Log = EventLog{Address: Ethereum.PoolManager, Topics: []string{"0x40e9cecb", poolID, "0x000000000000000000000000" + actor[2:]}}
+	return op
+}
+
+func Test_findSandwiches(t *testing.T) {
+	weth, usdc := knownTokens["WETH"], knownTokens["USDC"]
+	weth.Price, usdc.Price = 2000, 1
+	bot := "0x00000000000000000000000000000000000000b0"
+	victim := "0x00000000000000000000000000000000000000a1"
+	other := "0x00000000000000000000000000000000000000a2"
+	v4Pool := "0x21c67e77068de97969ba93d4aab21826d33ca12bb9f565d8496e8fda8a82ca27"
+	otherV4Pool := "0x72331fcb696b0151904c03584b66dc8365bc63f8a144d89a773384e3a579ca73"
+
+	tests := []struct {
+		name        string
+		ops         []blockOperation
+		trueCount   int
+		trueVictims int
+		trueProfit  float64
+	}{
+		{"sandwich", []blockOperation{
+			testSwapOperation(1, bot, usdc, weth, 10000, 4.9),
+			testSwapOperation(2, victim, usdc, weth, 20000, 9.7),
+			testSwapOperation(3, bot, weth, usdc, 4.9, 10100),
+		}, 1, 1, 100},
+		{"victim in opposite direction", []blockOperation{
+			testSwapOperation(1, bot, usdc, weth, 10000, 4.9),
+			testSwapOperation(2, victim, weth, usdc, 1, 2000),
+			testSwapOperation(3, bot, weth, usdc, 4.9, 10100),
+		}, 0, 0, 0},
+		{"several victims", []blockOperation{
+			testSwapOperation(1, bot, usdc, weth, 10000, 4.9),
+			testSwapOperation(2, victim, usdc, weth, 20000, 9.7),
+			testSwapOperation(3, other, usdc, weth, 1000, 0.4),
+			testSwapOperation(4, bot, weth, usdc, 4.9, 10050),
+		}, 1, 2, 50},
+		{"different back-run actor", []blockOperation{
+			testSwapOperation(1, bot, usdc, weth, 10000, 4.9),
+			testSwapOperation(2, victim, usdc, weth, 20000, 9.7),
+			testSwapOperation(3, other, weth, usdc, 4.9, 10100),
+		}, 0, 0, 0},
+		{"uniswap v4 sandwich", []blockOperation{
+			testV4SwapOperation(1, v4Pool, bot, usdc, weth, 10000, 4.9),
+			testV4SwapOperation(2, otherV4Pool, other, usdc, weth, 1000, 0.4),
+			testV4SwapOperation(3, v4Pool, victim, usdc, weth, 20000, 9.7),
+			testV4SwapOperation(4, v4Pool, bot, weth, usdc, 4.9, 10100),
+		}, 1, 1, 100},
+		{"uniswap v4 swaps of different pools", []blockOperation{
+			testV4SwapOperation(1, v4Pool, bot, usdc, weth, 10000, 4.9),
+			testV4SwapOperation(2, otherV4Pool, victim, usdc, weth, 20000, 9.7),
+			testV4SwapOperation(3, v4Pool, bot, weth, usdc, 4.9, 10100),
+		}, 0, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := findSandwiches(test.ops)
+			if len(res) != test.trueCount {
+				t.Fatalf("findSandwiches() found (%d); expected (%d)", len(res), test.trueCount)
+			}
+			if len(res) == 0 {
+				return
+			}
+			if len(res[0].victims) != test.trueVictims {
+				t.Errorf("victims = (%d); expected (%d)", len(res[0].victims), test.trueVictims)
+			}
+			if profit := res[0].profit(); math.Abs(profit.Amount-test.trueProfit) > tolerance || profit.Symbol != "USDC" {
+				t.Errorf("profit = (%v %s); expected (%v USDC)", profit.Amount, profit.Symbol, test.trueProfit)
+			}
+		})
+	}
+}
+
+func Test_findSandwichesThroughRouter(t *testing.T) {
+	uniswapPoolManagerABI = parseJsonToAbi(uniswapPoolManagerABIJson)
+	ethereumErc20TokenABI = parseJsonToAbi(ethereumErc20TokenABIJson)
+	poolID := "0x72331fcb696b0151904c03584b66dc8365bc63f8a144d89a773384e3a579ca73"
+	router := Ethereum.SwapRouters[0]
+	bot := "0x00000000000000000000000000000000000000b0"
+	victim := "0x00000000000000000000000000000000000000a1"
+	weth, usdc := knownTokens["WETH"], knownTokens["USDC"]
+	weth.Price, usdc.Price = 2000, 1
+	fetcher := testFetcher{strings.ToLower(weth.Address): weth, strings.ToLower(usdc.Address): usdc}
+	db := testPoolDB{pools: map[string]repository.Pool{poolID: {Address: poolID, Token0Address: strings.ToLower(usdc.Address), Token1Address: strings.ToLower(weth.Address)}}, tokens: fetcher}
+	sqrtPriceX96, _ := new(big.Int).SetString("1771595571142957102961017161607260", 10)
+	topic := func(address string) string {
+		return common.BytesToHash(common.HexToAddress(address).Bytes()).Hex()
+	}
+	amount := func(value float64, token TokenTransaction) *big.Int {
+		res, _ := new(big.Float).Mul(big.NewFloat(value), big.NewFloat(math.Pow10(token.Decimals))).Int(nil)
+		return res
+	}
+	// routedSwap swaps USDC for WETH (or back) through the router, which settles tokens of the swapper with PoolManager
+	routedSwap := func(txIndex uint64, swapper string, usdcAmount, wethAmount float64) blockOperation {
+		usdcDelta, wethDelta := amount(usdcAmount, usdc), amount(wethAmount, weth) // Positive are paid by the swapper
+		event := uniswapPoolManagerABI.Events[swapEvent]
+		data, err := event.Inputs.NonIndexed().Pack(new(big.Int).Neg(usdcDelta), new(big.Int).Neg(wethDelta), sqrtPriceX96, big.NewInt(1e18), big.NewInt(200000), big.NewInt(500))
+		if err != nil {
+			t.Fatalf("Pack(Swap) = (%v); expected (nil)", err)
+		}
+		var transfers []EventLog
+		for _, leg := range []struct {
+			token TokenTransaction
+			delta *big.Int
+		}{{usdc, usdcDelta}, {weth, wethDelta}} {
+			from, to := swapper, Ethereum.PoolManager
+			if leg.delta.Sign() < 0 {
+				from, to = to, from
+			}
+			transfers = append(transfers, EventLog{Address: leg.token.Address, Topics: []string{"0x", topic(from), topic(to)}, Data: common.BigToHash(new(big.Int).Abs(leg.delta)).Hex()})
+		}
+		swapLog := EventLog{
+			Address:         Ethereum.PoolManager,
+			TransactionHash: fmt.Sprintf("0x%d", txIndex),
+			Topics:          []string{event.ID.Hex(), poolID, topic(router)},
+			Data:            "0x" + fmt.Sprintf("%x", data),
+		}
+		sw := &Swap{OperationBase: OperationBase{db: db, cache: testCache{transferEvent: transfers}, fetchers: Fetchers{priceFetcher: fetcher, tokenFetcher: fetcher},
+			poolPrices: newPoolPriceCache(), chain: Ethereum, protocol: uniswapV4Protocol}}
+		if err := sw.Process(WrappedEventLog{Log: swapLog, Instructions: EventInstruction{Name: v4SwapEvent}}); err != nil {
+			t.Fatalf("Process(swap %d) = (%v); expected (nil)", txIndex, err)
+		}
+		if sw.Sender != swapper || sw.Recipient != swapper {
+			t.Errorf("Process(swap %d) = (sender %s, recipient %s); expected (%s, %s)", txIndex, sw.Sender, sw.Recipient, swapper, swapper)
+		}
+		return blockOperation{Operation: sw, Log: swapLog, txIndex: txIndex}
+	}
+
+	res := findSandwiches([]blockOperation{
+		routedSwap(1, bot, 10000, -4.9),
+		routedSwap(2, victim, 20000, -9.7),
+		routedSwap(3, bot, -10100, 4.9),
+	})
+	if len(res) != 1 {
+		t.Fatalf("findSandwiches() found (%d); expected (1)", len(res))
+	}
+	if len(res[0].victims) != 1 || res[0].victims[0].Operation.(*Swap).Sender != victim {
+		t.Errorf("victims = (%d); expected (1) of %s", len(res[0].victims), victim)
+	}
+	if profit := res[0].profit(); math.Abs(profit.Amount-100) > 1e-6 || profit.Symbol != "USDC" {
+		t.Errorf("profit = (%v %s); expected (100 USDC)", profit.Amount, profit.Symbol)
+	}
+}
+
+func Test_blockBufferJITDetection(t *testing.T) {
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	wrap := func(op Operation, address string, block, txIndex int) WrappedEventLog {
+		return WrappedEventLog{
+			Log:          EventLog{Address: address, BlockNumber: fmt.Sprintf("0x%x", block), TransactionIndex: fmt.Sprintf("0x%x", txIndex)},
+			Instructions: EventInstruction{Operation: op},
+		}
+	}
+	position := Position{Address: pool, LowerTick: 200000, UpperTick: 200010}
+
+	var jitMessages []any
+	buffer := newBlockBuffer(jitDetector{chain: Ethereum}.Detect)
+	send := func(data any, subjects ...string) error {
+		jitMessages = append(jitMessages, data)
+		return nil
+	}
+
+	add := &Addition{Position: position}
+	swap := &Swap{Position: Position{Address: pool}}
+	rem := &Removal{Position: position}
+	otherPool := "0x11b815efb8f581194ae79006d24e0d814b7697f6"
+	otherSwap := &Swap{Position: Position{Address: otherPool}}
+	ops := []WrappedEventLog{ // Arrival order differs from block order
+		wrap(add, pool, 100, 1),
+		wrap(rem, pool, 100, 3),
+		wrap(swap, pool, 100, 2),
+		wrap(otherSwap, otherPool, 100, 2),
+	}
+
+	now := time.Now()
+	buffer.Next(ops[0].Log, now, send)
+	for _, op := range ops {
+		if !buffer.Add(op.Instructions.Operation, op, now) {
+			t.Fatalf("operation of the current block was not buffered")
+		}
+	}
+	if buffer.FlushDue(now.Add(maxBlockDelay/2), send); len(jitMessages) != 0 {
+		t.Fatalf("block was flushed before it was finished")
+	}
+
+	buffer.Next(EventLog{BlockNumber: "0x65"}, now, send)
+	if len(jitMessages) != 1 {
+		t.Fatalf("JIT messages = (%d); expected (1)", len(jitMessages))
+	}
+	if !add.JIT || !swap.JIT || !rem.JIT || otherSwap.JIT {
+		t.Errorf("JIT flags (addition, swap, removal, other pool swap) = (%v, %v, %v, %v); expected (true, true, true, false)", add.JIT, swap.JIT, rem.JIT, otherSwap.JIT)
+	}
+
+	late := wrap(&Swap{Position: Position{Address: pool}}, pool, 100, 4)
+	if buffer.Add(late.Instructions.Operation, late, now) {
+		t.Errorf("operation of a finished block was buffered")
+	}
+
+	lateAdd, lateRem := &Addition{Position: position}, &Removal{Position: position}
+	for _, op := range []WrappedEventLog{wrap(lateAdd, pool, 101, 1), wrap(&Swap{Position: Position{Address: pool}}, pool, 101, 2), wrap(lateRem, pool, 101, 3)} {
+		buffer.Add(op.Instructions.Operation, op, now)
+	}
+	if buffer.FlushDue(now.Add(maxBlockDelay), send); len(jitMessages) != 2 || !lateAdd.JIT || !lateRem.JIT {
+		t.Errorf("JIT messages after delay = (%d); expected (2)", len(jitMessages))
+	}
+
+	// Uniswap V4 events of all pools are emitted by PoolManager, pools are told apart by PoolId
+	v4Position := Position{Address: "0x21c67e77068de97969ba93d4aab21826d33ca12bb9f565d8496e8fda8a82ca27", LowerTick: -600, UpperTick: 600}
+	v4Add, v4Rem := &Addition{Position: v4Position}, &Removal{Position: v4Position}
+	v4OtherSwap := &Swap{Position: Position{Address: "0x72331fcb696b0151904c03584b66dc8365bc63f8a144d89a773384e3a579ca73"}}
+	v4Swap := &Swap{Position: Position{Address: v4Position.Address}}
+	v4Ops := []WrappedEventLog{
+		wrap(v4Add, Ethereum.PoolManager, 102, 1),
+		wrap(v4OtherSwap, Ethereum.PoolManager, 102, 2),
+		wrap(v4Swap, Ethereum.PoolManager, 102, 3),
+		wrap(v4Rem, Ethereum.PoolManager, 102, 4),
+	}
+	buffer.Next(v4Ops[0].Log, now, send)
+	for _, op := range v4Ops {
+		buffer.Add(op.Instructions.Operation, op, now)
+	}
+	buffer.Next(EventLog{BlockNumber: "0x67"}, now, send)
+	if len(jitMessages) != 3 || !v4Add.JIT || !v4Swap.JIT || !v4Rem.JIT || v4OtherSwap.JIT {
+		t.Errorf("V4 JIT flags (addition, swap, removal, other pool swap) = (%v, %v, %v, %v); expected (true, true, true, false)", v4Add.JIT, v4Swap.JIT, v4Rem.JIT, v4OtherSwap.JIT)
+	}
+
+	// Direct pool mint is matched with removal of its owner, not with removal of the same range by someone else
+	bot := "0x00000000009e50a7ddb7a7b0e2ee6604fd120e49"
+	mint := &poolMint{Address: pool, Owner: bot, LowerTick: 200000, UpperTick: 200010, amount0: big.NewInt(2_000_000_000), amount1: big.NewInt(1e18)}
+	otherRem := &Removal{Position: position, Owner: "0xd8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"}
+	botRem := &Removal{Position: position, Owner: bot}
+	botRem.Token0 = TokenTransaction{Token: knownTokens["USDC"].Token, Price: 1}
+	botRem.Token1 = TokenTransaction{Token: knownTokens["WETH"].Token, Price: 2000}
+	directSwap := &Swap{Position: Position{Address: pool}}
+	directOps := []WrappedEventLog{
+		wrap(mint, pool, 103, 1),
+		wrap(directSwap, pool, 103, 2),
+		wrap(otherRem, pool, 103, 3),
+		wrap(botRem, pool, 103, 4),
+	}
+	buffer.Next(directOps[0].Log, now, send)
+	for _, op := range directOps {
+		buffer.Add(op.Instructions.Operation, op, now)
+	}
+	buffer.Next(EventLog{BlockNumber: "0x68"}, now, send)
+	if len(jitMessages) != 4 || !directSwap.JIT || !botRem.JIT || otherRem.JIT {
+		t.Fatalf("direct mint JIT flags (swap, owner removal, other removal) = (%v, %v, %v); expected (true, true, false)", directSwap.JIT, botRem.JIT, otherRem.JIT)
+	}
+	if msg := jitMessages[3].(types.JITMessage); math.Abs(msg.LiquidityUSD-4000) > tolerance {
+		t.Errorf("direct mint JIT liquidity = (%v); expected (4000)", msg.LiquidityUSD)
+	}
+}
+
+func Test_candleAggregator(t *testing.T) {
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	swap := func(price, amount0, amount1, value float64) *Swap {
+		return &Swap{
+			Position: Position{
+				Address:    pool,
+				Token0:     TokenTransaction{Token: repository.Token{Symbol: "WETH"}, Amount: amount0},
+				Token1:     TokenTransaction{Token: repository.Token{Symbol: "USDC"}, Amount: amount1},
+				TotalValue: value,
+			},
+			PriceAfter: price,
+		}
+	}
+
+	ca := newCandleAggregator([]time.Duration{time.Minute, time.Hour})
+	ca.Add(swap(2000, 1, -2000, 2000), start.Add(5*time.Second))
+	ca.Add(swap(2100, -2, 4200, 4200), start.Add(20*time.Second))
+	ca.Add(swap(1900, 1, -1900, 1900), start.Add(40*time.Second))
+
+	closed := ca.Add(swap(1950, 1, -1950, 1950), start.Add(70*time.Second))
+	if len(closed) != 1 {
+		t.Fatalf("closed candles = (%d); expected (1)", len(closed))
+	}
+	expected := repository.Candle{
+		LPoolAddress: pool, Interval: "1m", OpenTime: start, CloseTime: start.Add(time.Minute), BaseSymbol: "WETH", QuoteSymbol: "USDC",
+		Open: 2000, High: 2100, Low: 1900, Close: 1900, VolumeBase: 4, VolumeQuote: 8100, VolumeUSD: 8100, Trades: 3,
+	}
+	if closed[0] != expected {
+		t.Errorf("closed candle = (%+v); expected (%+v)", closed[0], expected)
+	}
+
+	if closed = ca.CloseDue(start.Add(119 * time.Second)); len(closed) != 0 {
+		t.Errorf("CloseDue(%v) = (%d) candles; expected (0)", start.Add(119*time.Second), len(closed))
+	}
+	if closed = ca.CloseDue(start.Add(time.Hour)); len(closed) != 2 {
+		t.Fatalf("CloseDue(%v) = (%d) candles; expected (2)", start.Add(time.Hour), len(closed))
+	}
+	for _, c := range closed {
+		if c.Interval == "1h" && (c.Open != 2000 || c.Close != 1950 || c.Trades != 4) {
+			t.Errorf("hourly candle (open, close, trades) = (%v, %v, %v); expected (2000, 1950, 4)", c.Open, c.Close, c.Trades)
+		}
+	}
+}
+
+func Test_intervalName(t *testing.T) {
+	testCases := []struct {
+		interval time.Duration
+		expected string
+	}{
+		{time.Minute, "1m"},
+		{5 * time.Minute, "5m"},
+		{time.Hour, "1h"},
+		{24 * time.Hour, "1d"},
+		{30 * time.Second, "30s"},
+	}
+
+	for _, tc := range testCases {
+		if res := intervalName(tc.interval); res != tc.expected {
+			t.Errorf("intervalName(%v) = (%v); expected (%v)", tc.interval, res, tc.expected)
+		}
+	}
+}
+
+func Test_statsAggregatorWindows(t *testing.T) {
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+	position := func(value float64) Position { return Position{Address: pool, TotalValue: value} }
+
+	sa := newStatsAggregator(defaultStatsWindows)
+	sa.Add(&Addition{Position: position(1000), Owner: "0xlp1"}, now.Add(-30*time.Minute))
+	sa.Add(&Removal{Position: position(400), Owner: "0xlp2"}, now.Add(-2*time.Hour))
+	sa.Add(&Removal{Position: position(100)}, now.Add(-20*time.Minute)) // Unknown owner is not counted as LP
+	sa.Add(&Addition{Position: position(500), Owner: "0xLP1"}, now.Add(-3*24*time.Hour))
+	sa.Add(&Swap{Position: position(10000), FeeTier: 3000}, now.Add(-10*time.Minute))
+	sa.Add(&Swap{Position: position(20000), FeeTier: 3000}, now.Add(-8*24*time.Hour)) // Outside of every window
+
+	stats := sa.Snapshot(now)[pool]
+	expected := []poolStats{
+		{Window: time.Hour, LiquidityAddedUSD: 1000, LiquidityRemovedUSD: 100, Additions: 1, Removals: 1, Swaps: 1, VolumeUSD: 10000, FeesUSD: 30, UniqueLPs: 1},
+		{Window: 24 * time.Hour, LiquidityAddedUSD: 1000, LiquidityRemovedUSD: 500, Additions: 1, Removals: 2, Swaps: 1, VolumeUSD: 10000, FeesUSD: 30, UniqueLPs: 2},
+		{Window: 7 * 24 * time.Hour, LiquidityAddedUSD: 1500, LiquidityRemovedUSD: 500, Additions: 2, Removals: 2, Swaps: 1, VolumeUSD: 10000, FeesUSD: 30, UniqueLPs: 2},
+	}
+	if len(stats) != len(expected) {
+		t.Fatalf("stats windows = (%d); expected (%d)", len(stats), len(expected))
+	}
+	for i := range expected {
+		if stats[i] != expected[i] {
+			t.Errorf("stats of %v window = (%+v); expected (%+v)", expected[i].Window, stats[i], expected[i])
+		}
+	}
+
+	if snapshot := sa.Snapshot(now.Add(8 * 24 * time.Hour)); len(snapshot) != 0 {
+		t.Errorf("Snapshot after 8 days = (%d) pools; expected (0)", len(snapshot))
+	}
+}
+
+func Test_positionAmounts(t *testing.T) {
+	liquidity := 1_000_000.0
+	sqrtLower, sqrtUpper := math.Pow(1.0001, -50), math.Pow(1.0001, 50)
+	testCases := []struct {
+		sqrtPrice       float64
+		expectedAmount0 float64
+		expectedAmount1 float64
+	}{
+		{1, liquidity * (1 - sqrtLower), liquidity * (1 - sqrtLower)},           // Middle of the range
+		{0.5, liquidity * (sqrtUpper - sqrtLower) / (sqrtLower * sqrtUpper), 0}, // Below the range - only token0
+		{2, 0, liquidity * (sqrtUpper - sqrtLower)},                             // Above the range - only token1
+	}
+
+	for _, tc := range testCases {
+		amount0, amount1 := positionAmounts(liquidity, tc.sqrtPrice, -100, 100)
+		if math.Abs(amount0-tc.expectedAmount0) > 1e-6 || math.Abs(amount1-tc.expectedAmount1) > 1e-6 {
+			t.Errorf("positionAmounts(%v, %v, -100, 100) = (%v, %v); expected (%v, %v)", liquidity, tc.sqrtPrice, amount0, amount1, tc.expectedAmount0, tc.expectedAmount1)
+		}
+	}
+}
+
+func Test_feeAPR(t *testing.T) {
+	testCases := []struct {
+		feesUSD      float64
+		liquidityUSD float64
+		window       time.Duration
+		expected     float64
+	}{
+		{100, 365_000, 24 * time.Hour, 0.1},
+		{100, 365_000, 7 * 24 * time.Hour, 0.1 / 7},
+		{100, 0, 24 * time.Hour, 0},
+	}
+
+	for _, tc := range testCases {
+		if res := feeAPR(tc.feesUSD, tc.liquidityUSD, tc.window); math.Abs(res-tc.expected) > 1e-12 {
+			t.Errorf("feeAPR(%v, %v, %v) = (%v); expected (%v)", tc.feesUSD, tc.liquidityUSD, tc.window, res, tc.expected)
+		}
+	}
+}
+
+func Test_depthMapRanges(t *testing.T) {
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	dm := newDepthMap(nil)
+	dm.apply(repository.LiquidityChange{LPoolAddress: pool, LowerTick: -100, UpperTick: 100, Liquidity: "1000"})
+	dm.apply(repository.LiquidityChange{LPoolAddress: pool, LowerTick: 0, UpperTick: 200, Liquidity: "500"})
+	dm.apply(repository.LiquidityChange{LPoolAddress: pool, LowerTick: 300, UpperTick: 400, Liquidity: "50"})
+	dm.apply(repository.LiquidityChange{LPoolAddress: pool, LowerTick: 300, UpperTick: 400, Liquidity: "-50"}) // Fully burned
+
+	expected := []string{"[-100, 0) 1000", "[0, 100) 1500", "[100, 200) 500"}
+	ranges := dm.Snapshot()[pool]
+	if len(ranges) != len(expected) {
+		t.Fatalf("depth ranges = (%d); expected (%d)", len(ranges), len(expected))
+	}
+	for i, r := range ranges {
+		if res := fmt.Sprintf("[%d, %d) %s", r.lowerTick, r.upperTick, r.liquidity); res != expected[i] {
+			t.Errorf("depth range %d = (%v); expected (%v)", i, res, expected[i])
+		}
+	}
+
+	if snapshot := dm.Snapshot(); len(snapshot) != 0 {
+		t.Errorf("Snapshot of unchanged pools = (%d) pools; expected (0)", len(snapshot))
+	}
+
+	activeRanges := []struct {
+		tick  int
+		lower int
+		upper int
+		found bool
+	}{
+		{50, 0, 100, true},
+		{-100, -100, 0, true},
+		{200, 0, 0, false}, // Above the highest initialized tick
+		{-150, 0, 0, false},
+	}
+	for _, ar := range activeRanges {
+		lower, upper, found := dm.ActiveRange(strings.ToUpper(pool), ar.tick)
+		if found != ar.found || (found && (lower != ar.lower || upper != ar.upper)) {
+			t.Errorf("ActiveRange(%d) = (%d, %d, %v); expected (%d, %d, %v)", ar.tick, lower, upper, found, ar.lower, ar.upper, ar.found)
+		}
+	}
+}
+
+type testDepthDB struct {
+	Database
+	changes map[string]repository.LiquidityChange // By transaction hash and log index
+	ticks   []repository.TickLiquidity
+}
+
+func (db testDepthDB) SaveLiquidityChange(change repository.LiquidityChange) (bool, error) {
+	key := fmt.Sprint(change.TxHash, change.LogIndex)
+	if _, found := db.changes[key]; found {
+		return false, nil
+	}
+	db.changes[key] = change
+	return true, nil
+}
+
+func (db testDepthDB) GetTickLiquidity() []repository.TickLiquidity {
+	return db.ticks
+}
+
+func Test_depthMapUpdate(t *testing.T) {
+	uniswapLiqPoolsABI = parseJsonToAbi(uniswapLiqPoolsABIJson)
+	word := func(v int64) string {
+		return fmt.Sprintf("%064x", new(big.Int).And(big.NewInt(v), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))))
+	}
+	const pool = "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	owner := "000000000000000000000000d8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"
+	mint := WrappedEventLog{
+		Log: EventLog{
+			Address:         pool,
+			TransactionHash: "0x01",
+			LogIndex:        "0x1",
+			Topics:          []string{"0x", "0x" + owner, "0x" + word(-600), "0x" + word(600)},
+			Data:            "0x" + owner + word(1000) + word(1) + word(1),
+		},
+		Instructions: EventInstruction{Name: mintEvent},
+	}
+
+	db := testDepthDB{
+		changes: make(map[string]repository.LiquidityChange),
+		ticks: []repository.TickLiquidity{
+			{LPoolAddress: pool, Tick: -600, Liquidity: "500"},
+			{LPoolAddress: pool, Tick: 0, Liquidity: "-500"},
+		},
+	}
+	dm := newDepthMap(db)
+	dm.Rebuild()
+	for i := 0; i < 2; i++ { // Replayed log is applied once
+		if err := dm.Update(mint); err != nil {
+			t.Fatalf("Update(mint) = (%v); expected (<nil>)", err)
+		}
+	}
+
+	expected := []string{"[-600, 0) 1500", "[0, 600) 1000"}
+	ranges := dm.Snapshot()[pool]
+	if len(ranges) != len(expected) {
+		t.Fatalf("depth ranges = (%d); expected (%d)", len(ranges), len(expected))
+	}
+	for i, r := range ranges {
+		if res := fmt.Sprintf("[%d, %d) %s", r.lowerTick, r.upperTick, r.liquidity); res != expected[i] {
+			t.Errorf("depth range %d = (%v); expected (%v)", i, res, expected[i])
+		}
+	}
+}
+
+func Test_findPayer(t *testing.T) {
+	uniswapLiqPoolsABI = parseJsonToAbi(uniswapLiqPoolsABIJson)
+	ethereumErc20TokenABI = parseJsonToAbi(ethereumErc20TokenABIJson)
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	poolTopic := "0x00000000000000000000000088e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	walletTopic := "0x000000000000000000000000d8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"
+	otherTopic := "0x0000000000000000000000001111111111111111111111111111111111111111"
+	value := "0x" + strings.Repeat("0", 63) + "1"
+	mintLog := EventLog{
+		Address: pool,
+		Topics:  []string{"0x", poolTopic, "0x" + strings.Repeat("0", 64), "0x" + strings.Repeat("0", 63) + "a"},
+		Data:    "0x000000000000000000000000c36442b4a4522e871399cd717abdd847ab11fe88" + strings.Repeat("0", 64*3),
+	}
+
+	testCases := []struct {
+		name      string
+		transfers []EventLog
+		expected  string
+	}{
+		{"transfer into pool", []EventLog{{Topics: []string{"0x", otherTopic, walletTopic}, Data: value}, {Topics: []string{"0x", walletTopic, poolTopic}, Data: value}}, "0xd8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"},
+		{"no transfer into pool", []EventLog{{Topics: []string{"0x", walletTopic, otherTopic}, Data: value}}, "0xc36442b4a4522e871399cd717abdd847ab11fe88"},
+		{"NFT transfer into pool", []EventLog{{Topics: []string{"0x", walletTopic, poolTopic, "0x" + strings.Repeat("0", 63) + "1"}}}, "0xc36442b4a4522e871399cd717abdd847ab11fe88"},
+	}
+	for _, tc := range testCases {
+		if res := findPayer(mintLog, tc.transfers); res != tc.expected {
+			t.Errorf("findPayer(%s) = (%v); expected (%v)", tc.name, res, tc.expected)
+		}
+	}
+}
+
+type testWalletDB struct {
+	Database
+	buckets map[string]repository.WalletBucket // By address and bucket start
+}
+
+func (db testWalletDB) SaveWalletBucket(bucket repository.WalletBucket) error {
+	db.buckets[fmt.Sprint(bucket.Address, bucket.Start.Unix())] = bucket
+	return nil
+}
+
+func (db testWalletDB) GetWalletBuckets(since time.Time) []repository.WalletBucket {
+	var res []repository.WalletBucket
+	for _, bucket := range db.buckets {
+		if bucket.Start.After(since) {
+			res = append(res, bucket)
+		}
+	}
+	return res
+}
+
+func Test_leaderboardWindows(t *testing.T) {
+	pool1, pool2 := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640", "0x8ad599c3a0ff1de082011efddc58f1908eb6e6d8"
+	now := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	earned := TokenTransaction{Amount: 2}
+	token := TokenTransaction{Price: 10}
+
+	db := testWalletDB{buckets: make(map[string]repository.WalletBucket)}
+	lb := newLeaderboard(db, defaultLeaderboardWindows)
+	lb.Add(&Addition{Position: Position{Address: pool1, TotalValue: 1000}, Owner: "0xLP1"}, now.Add(-2*time.Hour))
+	lb.Add(&Removal{Position: Position{Address: pool2, Token0: token, Token1: token}, Token0Earned: earned, Token1Earned: earned, Owner: "0xlp1"}, now.Add(-3*24*time.Hour))
+	lb.Add(&FeeCollection{Position: Position{Address: pool1, TotalValue: 5}, Owner: "0xlp2"}, now.Add(-20*24*time.Hour))
+	lb.Add(&Swap{Position: Position{Address: pool1, TotalValue: 300}, Recipient: "0xtrader"}, now.Add(-time.Hour))
+	lb.Add(&Swap{Position: Position{Address: pool1, TotalValue: 700}}, now.Add(-time.Hour)) // No recipient - ignored
+
+	stats := lb.Snapshot(now)
+	restarted := newLeaderboard(db, defaultLeaderboardWindows) // Windows are rebuilt from stored buckets after restart
+	restarted.Rebuild(now)
+	rebuiltStats := restarted.Snapshot(now)
+	testCases := []struct {
+		window   time.Duration
+		metric   string
+		expected []walletStats
+	}{
+		{24 * time.Hour, liquidityMetric, []walletStats{{Address: "0xlp1", Window: 24 * time.Hour, LiquidityUSD: 1000, Pools: 1}}},
+		{7 * 24 * time.Hour, feesMetric, []walletStats{{Address: "0xlp1", Window: 7 * 24 * time.Hour, LiquidityUSD: 1000, FeesUSD: 40, Pools: 2}}},
+		{30 * 24 * time.Hour, feesMetric, []walletStats{
+			{Address: "0xlp1", Window: 30 * 24 * time.Hour, LiquidityUSD: 1000, FeesUSD: 40, Pools: 2},
+			{Address: "0xlp2", Window: 30 * 24 * time.Hour, FeesUSD: 5, Pools: 1},
+		}},
+		{30 * 24 * time.Hour, volumeMetric, []walletStats{{Address: "0xtrader", Window: 30 * 24 * time.Hour, VolumeUSD: 300, Pools: 1}}},
+		{30 * 24 * time.Hour, poolsMetric, []walletStats{
+			{Address: "0xlp1", Window: 30 * 24 * time.Hour, LiquidityUSD: 1000, FeesUSD: 40, Pools: 2},
+			{Address: "0xlp2", Window: 30 * 24 * time.Hour, FeesUSD: 5, Pools: 1},
+		}},
+	}
+	for _, tc := range testCases {
+		res := topWallets(stats[tc.window], tc.metric, 2)
+		if !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("topWallets(%v, %s) = (%+v); expected (%+v)", tc.window, tc.metric, res, tc.expected)
+		}
+		res = topWallets(rebuiltStats[tc.window], tc.metric, 2)
+		if !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("topWallets(rebuilt %v, %s) = (%+v); expected (%+v)", tc.window, tc.metric, res, tc.expected)
+		}
+	}
+
+	if res := topWallets(stats[30*24*time.Hour], poolsMetric, 1); len(res) != 1 {
+		t.Errorf("topWallets(30d, pools, 1) = (%d) wallets; expected (1)", len(res))
+	}
+
+	lb.Snapshot(now.Add(31 * 24 * time.Hour)) // Wallets are returned once more with empty stats
+	if snapshot := lb.Snapshot(now.Add(31 * 24 * time.Hour)); len(snapshot) != 0 {
+		t.Errorf("Snapshot after 31 days = (%d) windows; expected (0)", len(snapshot))
+	}
+}
+
+func Test_rebalanceDetector(t *testing.T) {
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+	weth := TokenTransaction{Token: repository.Token{Address: "0xweth", Symbol: "WETH"}, Price: 2000}
+	usdc := TokenTransaction{Token: repository.Token{Address: "0xusdc", Symbol: "USDC"}, Price: 1}
+	removal := func(owner string) *Removal {
+		return &Removal{
+			Position:     Position{Address: pool, Token0: weth, Token1: usdc, LowerTick: -100, UpperTick: 100, TotalValue: 5000},
+			Token0Earned: TokenTransaction{Amount: 0.01},
+			Token1Earned: TokenTransaction{Amount: 10},
+			Owner:        owner,
+		}
+	}
+	addition := func(owner string, lower, upper int) *Addition {
+		return &Addition{Position: Position{Address: pool, LowerTick: lower, UpperTick: upper, TotalValue: 5050}, Owner: owner}
+	}
+	collection := &FeeCollection{Position: Position{Address: pool, Token0: TokenTransaction{Token: usdc.Token, Amount: 5}, Token1: TokenTransaction{Token: weth.Token, Amount: 0.02}}, Owner: "0xLP"}
+
+	testCases := []struct {
+		name          string
+		ops           []Operation
+		blocks        []uint64
+		expectedFees  float64 // -1 if no rebalance is expected
+		expectedBlock uint64
+	}{
+		{"same block", []Operation{removal("0xlp"), addition("0xLP", 0, 200)}, []uint64{100, 100}, 30, 0},
+		{"with collection", []Operation{removal("0xlp"), collection, addition("0xlp", 0, 200)}, []uint64{100, 101, 103}, 75, 3},
+		{"outside window", []Operation{removal("0xlp"), addition("0xlp", 0, 200)}, []uint64{100, 111}, -1, 0},
+		{"same range", []Operation{removal("0xlp"), addition("0xlp", -100, 100)}, []uint64{100, 100}, -1, 0},
+		{"other owner", []Operation{removal("0xlp"), addition("0xother", 0, 200)}, []uint64{100, 100}, -1, 0},
+		{"unknown owner", []Operation{removal(""), addition("", 0, 200)}, []uint64{100, 100}, -1, 0},
+		{"addition of earlier block", []Operation{removal("0xlp"), addition("0xlp", 0, 200)}, []uint64{100, 99}, -1, 0},
+		{"removal kept after earlier block", []Operation{removal("0xlp"), addition("0xother", 0, 200), addition("0xlp", 0, 200)}, []uint64{100, 99, 101}, 30, 1},
+	}
+
+	for _, tc := range testCases {
+		var messages []types.RebalanceMessage
+		send := func(data any, subjects ...string) error {
+			messages = append(messages, data.(types.RebalanceMessage))
+			return nil
+		}
+		rd := newRebalanceDetector(Ethereum, defaultRebalanceWindow)
+		for i, op := range tc.ops {
+			if err := rd.Record(op, tc.blocks[i], send, time.Now()); err != nil {
+				t.Fatalf("Record(%s) = (%v); expected (nil)", tc.name, err)
+			}
+		}
+		if tc.expectedFees < 0 {
+			if len(messages) != 0 {
+				t.Errorf("Record(%s) published (%d) rebalances; expected (0)", tc.name, len(messages))
+			}
+			continue
+		}
+		if len(messages) != 1 {
+			t.Fatalf("Record(%s) published (%d) rebalances; expected (1)", tc.name, len(messages))
+		}
+		msg := messages[0]
+		if math.Abs(msg.FeesUSD-tc.expectedFees) > 1e-9 || msg.Blocks != tc.expectedBlock || msg.OldRange.LowerTick != -100 || msg.NewRange.LowerTick != 0 {
+			t.Errorf("Record(%s) = (fees %v, blocks %v, ranges %+v -> %+v); expected (fees %v, blocks %v)", tc.name, msg.FeesUSD, msg.Blocks, msg.OldRange, msg.NewRange, tc.expectedFees, tc.expectedBlock)
+		}
+	}
+}
+
+func Test_protocolAdapters(t *testing.T) {
+	parseTestABIs()
+	mintTopic := "0x7a53080ba414158be7ec69b987b5fb7d07dee101fe85488f0853ae16239d0bde"
+	exchangeTopic := convertToEventSignature(curveStableSwapABI.Events[curveExchangeEvent].Sig)
+	pool := "0x88e6a0c2ddd26feeb64f039a2c41296fcb3f5640"
+
+	testCases := []struct {
+		name      string
+		protocols []string
+		log       EventLog
+		expected  string // Protocol of the handler, empty if no handler is expected
+	}{
+		{"shared pool event", nil, EventLog{Address: pool, Topics: []string{mintTopic, "0x1", "0x2", "0x3"}}, uniswapV3Protocol},
+		{"shared pool event of fork", []string{pancakeswapV3Protocol}, EventLog{Address: pool, Topics: []string{mintTopic, "0x1", "0x2", "0x3"}}, pancakeswapV3Protocol},
+		{"Curve event", nil, EventLog{Address: pool, Topics: []string{exchangeTopic, "0x1"}}, curveProtocol},
+		{"disabled protocol", []string{uniswapV3Protocol}, EventLog{Address: pool, Topics: []string{exchangeTopic, "0x1"}}, ""},
+	}
+	for _, tc := range testCases {
+		var opts Options
+		if err := WithProtocols(tc.protocols...)(&opts); err != nil {
+			t.Fatalf("WithProtocols(%v) = (%v); expected (nil)", tc.protocols, err)
+		}
+		opts.chain = Ethereum
+		a := &Analytics{Options: opts, events: newEventRegistry()}
+		a.registerEvents()
+
+		handler, found := a.events.Lookup(tc.log)
+		if found != (tc.expected != "") || handler.protocol != tc.expected {
+			t.Errorf("Lookup(%s) = (%v, %v); expected (%v)", tc.name, handler.protocol, found, tc.expected)
+		}
+		if n := len(a.events.handlers[mintTopic]); n > 1 {
+			t.Errorf("Register(%s) registered Mint (%d) times; expected (1)", tc.name, n)
+		}
+	}
+
+	if err := WithProtocols("uniswap-v2")(&Options{}); err == nil {
+		t.Errorf("WithProtocols(uniswap-v2) = (nil); expected error")
+	}
+	if !pancakeswapV3Adapter().Supports(Ethereum) || pancakeswapV3Adapter().Supports(Arbitrum) {
+		t.Errorf("PancakeSwap V3 Supports(ethereum, arbitrum) = (%v, %v); expected (true, false)", pancakeswapV3Adapter().Supports(Ethereum), pancakeswapV3Adapter().Supports(Arbitrum))
+	}
+}
+
+func pancakeswapV3Adapter() protocolAdapter {
+	for _, adapter := range protocolAdapters {
+		if adapter.Protocol() == pancakeswapV3Protocol {
+			return adapter
+		}
+	}
+	return nil
+}
+
+func Test_decodePoolBalanceChange(t *testing.T) {
+	balancerVaultABI = parseJsonToAbi(balancerVaultABIJson)
+	pool := "0x32296969ef14eb0c6d29669c550d4a0449130230" // wstETH / WETH composable pool, BPT is a pool token
+	wsteth := "0x7f39c581f595b53c5cb19bd0b3f8da6c935e2ca0"
+	weth := strings.ToLower(knownTokens["WETH"].Address)
+	poolBalanceChangedLog := func(tokens []string, deltas []int64) EventLog {
+		event := balancerVaultABI.Events[poolBalanceChangedEvent]
+		addresses := make([]common.Address, 0, len(tokens))
+		for _, token := range tokens {
+			addresses = append(addresses, common.HexToAddress(token))
+		}
+		amounts := make([]*big.Int, 0, len(deltas))
+		fees := make([]*big.Int, 0, len(deltas))
+		for _, delta := range deltas {
+			amounts = append(amounts, big.NewInt(delta))
+			fees = append(fees, new(big.Int))
+		}
+		data, err := event.Inputs.NonIndexed().Pack(addresses, amounts, fees)
+		if err != nil {
+			t.Fatalf("Pack(%v, %v) = (%v); expected (nil)", tokens, deltas, err)
+		}
+		return EventLog{
+			Topics: []string{event.ID.Hex(), pool + "000000000000000000000000", "0x000000000000000000000000d8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"},
+			Data:   "0x" + fmt.Sprintf("%x", data),
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		tokens    []string
+		deltas    []int64
+		direction int // 2 if decoding is expected to fail
+	}{
+		{"join", []string{wsteth, weth}, []int64{100, 200}, 1},
+		{"single token exit", []string{wsteth, weth}, []int64{0, -200}, -1},
+		{"BPT is skipped", []string{wsteth, pool, weth}, []int64{100, 0, 0}, 1},
+		{"swap-like change", []string{wsteth, weth}, []int64{100, -200}, 0},
+		{"three token pool", []string{wsteth, weth, knownTokens["USDC"].Address}, []int64{1, 2, 3}, 2},
+	}
+	for _, tc := range testCases {
+		change, err := decodePoolBalanceChange(poolBalanceChangedLog(tc.tokens, tc.deltas))
+		if tc.direction == 2 {
+			if err == nil {
+				t.Errorf("decodePoolBalanceChange(%s) = (nil); expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("decodePoolBalanceChange(%s) = (%v); expected (nil)", tc.name, err)
+		}
+		if change.pool != pool || change.provider != "0xd8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b" || change.tokens != [2]string{wsteth, weth} || change.direction() != tc.direction {
+			t.Errorf("decodePoolBalanceChange(%s) = (%+v, direction %d); expected (%s, [%s %s], direction %d)", tc.name, change, change.direction(), pool, wsteth, weth, tc.direction)
+		}
+	}
+}
+
+type testCache map[string][]EventLog // By log type
+
+func (c testCache) GetByTxHashAndLogType(txHash string, logType string) ([]EventLog, error) {
+	return c[logType], nil
+}
+
+type testFetcher map[string]TokenTransaction // By lowercase address
+
+func (f testFetcher) Token(address string) (repository.Token, error) {
+	return f[strings.ToLower(address)].Token, nil
+}
+
+func (f testFetcher) Price(address string) (repository.TokenPrice, error) {
+	return repository.TokenPrice{Value: f[strings.ToLower(address)].Price}, nil
+}
+
+func Test_processTokenExchange(t *testing.T) {
+	curveStableSwapABI = parseJsonToAbi(curveStableSwapABIJson)
+	pool := "0xdc24316b9ae028f1497c275eb9192a3ea0f67022"
+	trader := "0x000000000000000000000000d8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"
+	usdc, usdt := knownTokens["USDC"], knownTokens["USDT"]
+	usdc.Price, usdt.Price = 1, 0.999
+	fetcher := testFetcher{strings.ToLower(usdc.Address): usdc, strings.ToLower(usdt.Address): usdt}
+	word := func(v int64) string {
+		return fmt.Sprintf("%064x", v)
+	}
+	poolTopic := "0x000000000000000000000000" + pool[2:]
+	cache := testCache{transferEvent: {
+		{Address: usdt.Address, Topics: []string{"0x", trader, poolTopic}, Data: "0x" + word(1_000_000_000)},
+		{Address: usdc.Address, Topics: []string{"0x", poolTopic, trader}, Data: "0x" + word(999_000_000)},
+	}}
+	exchange := WrappedEventLog{
+		Log: EventLog{
+			Address: pool,
+			Topics:  []string{"0x", trader},
+			Data:    "0x" + word(2) + word(1_000_000_000) + word(1) + word(999_000_000), // Sold coin 2 (USDT) for coin 1 (USDC)
+		},
+		Instructions: EventInstruction{Name: curveExchangeEvent},
+	}
+
+	sw := &Swap{OperationBase: OperationBase{cache: cache, fetchers: Fetchers{priceFetcher: fetcher, tokenFetcher: fetcher}, chain: Ethereum, protocol: curveProtocol}}
+	if err := sw.Process(exchange); err != nil {
+		t.Fatalf("Process(TokenExchange) = (%v); expected (nil)", err)
+	}
+	if sw.From.Symbol != "USDT" || sw.From.Amount != 1000 || sw.To.Symbol != "USDC" || sw.To.Amount != 999 || sw.Protocol != curveProtocol ||
+		sw.Recipient != "0xd8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b" || math.Abs(sw.TotalValue-999) > tolerance || math.Abs(sw.ExecutionPrice-1000.0/999) > tolerance {
+		t.Errorf("Process(TokenExchange) = (%s, protocol %s, recipient %s, value %v, price %v); expected (1000 USDT to 999 USDC, curve, trader, 999, 1000/999 USDT per USDC)",
+			sw, sw.Protocol, sw.Recipient, sw.TotalValue, sw.ExecutionPrice)
+	}
+}
+
+type testPoolDB struct {
+	Database
+	pools     map[string]repository.Pool // By address
+	tokens    testFetcher
+	positions map[string]repository.LiquidityPosition // By token ID
+}
+
+func (db testPoolDB) SavePool(pool repository.Pool) error {
+	db.pools[pool.Address] = pool
+	return nil
+}
+
+func (db testPoolDB) GetPoolPairAddresses(address string) (string, string, bool) {
+	pool, found := db.pools[address]
+	return pool.Token0Address, pool.Token1Address, found
+}
+
+func (db testPoolDB) GetToken(address string) (repository.Token, bool) {
+	token, found := db.tokens[strings.ToLower(address)]
+	return token.Token, found
+}
+
+func (db testPoolDB) GetPosition(tokenID string) (repository.LiquidityPosition, bool) {
+	pos, found := db.positions[tokenID]
+	return pos, found
+}
+
+func (db testPoolDB) SavePosition(pos repository.LiquidityPosition) error {
+	db.positions[pos.TokenID] = pos
+	return nil
+}
+
+func Test_uniswapV4PoolManager(t *testing.T) {
+	uniswapPoolManagerABI = parseJsonToAbi(uniswapPoolManagerABIJson)
+	uniswapPositionsManagerABI = parseJsonToAbi(uniswapPositionsManagerABIJson)
+	ethereumErc20TokenABI = parseJsonToAbi(ethereumErc20TokenABIJson)
+	poolID := "0x21c67e77068de97969ba93d4aab21826d33ca12bb9f565d8496e8fda8a82ca27" // ETH / USDC 0.05%
+	caller := "0x66a9893cc07d91d95644aedd05d03f95e1dba8af"
+	weth, usdc := knownTokens["WETH"], knownTokens["USDC"]
+	weth.Price, usdc.Price = 2000, 1
+	fetcher := testFetcher{strings.ToLower(weth.Address): weth, strings.ToLower(usdc.Address): usdc}
+	db := testPoolDB{pools: make(map[string]repository.Pool), tokens: fetcher, positions: make(map[string]repository.LiquidityPosition)}
+	poolPrices := newPoolPriceCache()
+	sqrtPriceX96, _ := new(big.Int).SetString("3543191142285914205922034", 10) // 2000 USDC per ETH
+	managerLog := func(eventName string, args ...interface{}) EventLog {
+		event := uniswapPoolManagerABI.Events[eventName]
+		data, err := event.Inputs.NonIndexed().Pack(args...)
+		if err != nil {
+			t.Fatalf("Pack(%s) = (%v); expected (nil)", eventName, err)
+		}
+		second := common.BytesToHash(common.HexToAddress(caller).Bytes()).Hex() // Currency0 of Initialize, sender otherwise
+		if eventName == initializeEvent {
+			second = common.Hash{}.Hex()
+		}
+		topics := []string{event.ID.Hex(), poolID, second}
+		if eventName == initializeEvent {
+			topics = append(topics, common.BytesToHash(common.HexToAddress(usdc.Address).Bytes()).Hex())
+		}
+		return EventLog{Address: Ethereum.PoolManager, Topics: topics, Data: "0x" + fmt.Sprintf("%x", data)}
+	}
+
+	initialize := managerLog(initializeEvent, big.NewInt(500), big.NewInt(10), common.Address{}, sqrtPriceX96, big.NewInt(-200311))
+	tracker := poolManagerTracker{db: db, tokenFetcher: fetcher, poolPrices: poolPrices, chain: Ethereum}
+	if err := tracker.Update(WrappedEventLog{Log: initialize, Instructions: EventInstruction{Name: initializeEvent}}); err != nil {
+		t.Fatalf("Update(Initialize) = (%v); expected (nil)", err)
+	}
+	expectedPool := repository.Pool{
+		Address:       poolID,
+		Token0Address: strings.ToLower(weth.Address), // Native ETH
+		Token1Address: strings.ToLower(usdc.Address),
+		Fee:           500,
+		TickSpacing:   10,
+		Protocol:      uniswapV4Protocol,
+	}
+	if pool := db.pools[poolID]; pool != expectedPool {
+		t.Errorf("Update(Initialize) = (%+v); expected (%+v)", pool, expectedPool)
+	}
+
+	trader := "0xd8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"
+	usdcOut := EventLog{ // Native ETH paid by the router is not transferred
+		Address: usdc.Address,
+		Topics:  []string{"0x", common.BytesToHash(common.HexToAddress(Ethereum.PoolManager).Bytes()).Hex(), common.BytesToHash(common.HexToAddress(trader).Bytes()).Hex()},
+		Data:    common.BigToHash(big.NewInt(2000e6)).Hex(),
+	}
+	opBase := OperationBase{db: db, cache: testCache{transferEvent: {usdcOut}}, fetchers: Fetchers{priceFetcher: fetcher, tokenFetcher: fetcher}, poolPrices: poolPrices, chain: Ethereum, protocol: uniswapV4Protocol}
+	swapLog := managerLog(swapEvent, big.NewInt(-1e18), big.NewInt(2000e6), sqrtPriceX96, big.NewInt(1e18), big.NewInt(-200311), big.NewInt(500)) // Sold 1 ETH
+	sw := &Swap{OperationBase: opBase}
+	if err := sw.Process(WrappedEventLog{Log: swapLog, Instructions: EventInstruction{Name: v4SwapEvent}}); err != nil {
+		t.Fatalf("Process(V4 Swap) = (%v); expected (nil)", err)
+	}
+	if sw.Address != poolID || sw.Protocol != uniswapV4Protocol || sw.From.Symbol != "WETH" || sw.From.Amount != 1 || sw.To.Symbol != "USDC" || sw.To.Amount != 2000 ||
+		sw.FeeTier != 500 || math.Abs(sw.Fee.Amount-0.0005) > tolerance || sw.Sender != "" || sw.Recipient != trader {
+		t.Errorf("Process(V4 Swap) = (%s, pool %s, protocol %s, fee %v %v, sender %s, recipient %s); expected (1 WETH to 2000 USDC, %s, uniswap-v4, 500 0.0005, router unknown, %s)",
+			sw, sw.Address, sw.Protocol, sw.FeeTier, sw.Fee.Amount, sw.Sender, sw.Recipient, poolID, trader)
+	}
+
+	testCases := []struct {
+		name           string
+		liquidityDelta int64
+		tickLower      int64
+		tickUpper      int64
+		operation      string
+	}{
+		{"addition in range", 1e15, -200320, -200300, "add"},
+		{"removal below price", -1e15, -210000, -205000, "remove"},
+		{"fees only", 0, -200320, -200300, ""},
+	}
+	adapter := uniswapV4Adapter{}
+	a := &Analytics{Options: Options{chain: Ethereum}, events: newEventRegistry()}
+	adapter.Register(a, a.events.forProtocol(uniswapV4Protocol))
+	for _, tc := range testCases {
+		modify := managerLog(modifyLiquidityEvent, big.NewInt(tc.tickLower), big.NewInt(tc.tickUpper), big.NewInt(tc.liquidityDelta), [32]byte{})
+		handler, found := a.events.Lookup(modify)
+		if !found {
+			t.Fatalf("Lookup(%s) = (not found); expected (%s)", tc.name, modifyLiquidityEvent)
+		}
+		operation, publishTo := handler.operation(modify, opBase)
+		if publishTo != tc.operation {
+			t.Errorf("operation(%s) = (%v); expected (%v)", tc.name, publishTo, tc.operation)
+		}
+		if operation == nil {
+			continue
+		}
+		if err := operation.Process(WrappedEventLog{Log: modify, Instructions: EventInstruction{Name: modifyLiquidityEvent}}); err != nil {
+			t.Fatalf("Process(%s) = (%v); expected (nil)", tc.name, err)
+		}
+
+		sqrtPrice, _ := new(big.Float).Quo(new(big.Float).SetInt(sqrtPriceX96), new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96))).Float64()
+		amount0, amount1 := positionAmounts(math.Abs(float64(tc.liquidityDelta)), sqrtPrice, int(tc.tickLower), int(tc.tickUpper))
+		var pos Position
+		var owner string
+		switch op := operation.(type) {
+		case *Addition:
+			pos, owner = op.Position, op.Owner
+		case *Removal:
+			pos, owner = op.Position, op.Owner
+		}
+		if pos.Address != poolID || owner != caller || math.Abs(pos.Token0.Amount-amount0/1e18) > tolerance || math.Abs(pos.Token1.Amount-amount1/1e6) > tolerance || pos.TotalValue <= 0 {
+			t.Errorf("Process(%s) = (pool %s, owner %s, %v WETH, %v USDC, $%v); expected (%s, %s, %v WETH, %v USDC)",
+				tc.name, pos.Address, owner, pos.Token0.Amount, pos.Token1.Amount, pos.TotalValue, poolID, caller, amount0/1e18, amount1/1e6)
+		}
+	}
+
+	// Liquidity of PositionManager NFTs is owned by the NFT owner, not by PositionManager that calls PoolManager
+	lp := "0xd8da6bf26964af9d7eed9e10c65d2a5f3e1a6e9b"
+	positionManagerTopic := common.BytesToHash(common.HexToAddress(Ethereum.V4PositionManager).Bytes()).Hex()
+	mintNFT := EventLog{
+		Address: Ethereum.V4PositionManager,
+		Topics:  []string{"0x", common.Hash{}.Hex(), common.BytesToHash(common.HexToAddress(lp).Bytes()).Hex(), common.BigToHash(big.NewInt(7)).Hex()},
+	}
+	positions := positionTracker{db: db, chain: Ethereum}
+	if err := positions.Update(WrappedEventLog{Log: mintNFT, Instructions: EventInstruction{Name: positionTransferEvent}}); err != nil {
+		t.Fatalf("Update(PositionManager Transfer) = (%v); expected (nil)", err)
+	}
+	nftCases := []struct {
+		name           string
+		tokenID        int64
+		liquidityDelta int64
+		owner          string
+		liquidity      string
+	}{
+		{"NFT addition", 7, 1e15, lp, "1000000000000000"},
+		{"NFT removal", 7, -1e15, lp, "0"},
+		{"NFT minted before tracking", 8, -1e15, "", "0"},
+	}
+	for _, tc := range nftCases {
+		modify := managerLog(modifyLiquidityEvent, big.NewInt(-200320), big.NewInt(-200300), big.NewInt(tc.liquidityDelta), [32]byte(common.BigToHash(big.NewInt(tc.tokenID))))
+		modify.Topics[2] = positionManagerTopic
+		wel := WrappedEventLog{Log: modify, Instructions: EventInstruction{Name: modifyLiquidityEvent}}
+		if err := positions.Update(wel); err != nil {
+			t.Fatalf("Update(%s) = (%v); expected (nil)", tc.name, err)
+		}
+		handler, _ := a.events.Lookup(modify)
+		operation, _ := handler.operation(modify, opBase)
+		if err := operation.Process(wel); err != nil {
+			t.Fatalf("Process(%s) = (%v); expected (nil)", tc.name, err)
+		}
+		var tokenID, owner string
+		switch op := operation.(type) {
+		case *Addition:
+			tokenID, owner = op.TokenID, op.Owner
+		case *Removal:
+			tokenID, owner = op.TokenID, op.Owner
+		}
+		expectedTokenID := fmt.Sprintf("%s:%d", strings.ToLower(Ethereum.V4PositionManager), tc.tokenID)
+		if tokenID != expectedTokenID || owner != tc.owner || db.positions[expectedTokenID].Liquidity != tc.liquidity {
+			t.Errorf("Process(%s) = (token %s, owner %s, liquidity %s); expected (%s, %s, %s)",
+				tc.name, tokenID, owner, db.positions[expectedTokenID].Liquidity, expectedTokenID, tc.owner, tc.liquidity)
+		}
+	}
+}
+
+func Test_correlateFlash(t *testing.T) {
+	weth, usdc, pepe := knownTokens["WETH"], knownTokens["USDC"], knownTokens["PEPE"]
+	swap := func(from, to TokenTransaction) blockOperation {
+		return blockOperation{Operation: &Swap{From: from, To: to}, PublishTo: "swap"}
+	}
+	addition := blockOperation{Operation: &Addition{}, PublishTo: "add"}
+	borrowed := weth
+	borrowed.Amount = 10
+
+	testCases := []struct {
+		name     string
+		funded   []blockOperation
+		expected string
+	}{
+		{"arbitrage", []blockOperation{swap(weth, usdc), swap(usdc, pepe), swap(pepe, weth)}, flashPurposeArbitrage},
+		{"liquidity", []blockOperation{swap(weth, usdc), addition}, flashPurposeLiquidity},
+		{"arbitrage of other token", []blockOperation{swap(usdc, pepe), swap(pepe, usdc)}, flashPurposeSwap},
+		{"nothing funded", nil, ""},
+	}
+	for _, tc := range testCases {
+		flash := &Flash{Position: Position{Token0: borrowed, Token1: usdc}}
+		correlateFlash(flash, tc.funded)
+		if flash.Purpose != tc.expected || len(flash.Operations) != len(tc.funded) {
+			t.Errorf("correlateFlash(%s) = (%q, %v); expected (%q, %d operations)", tc.name, flash.Purpose, flash.Operations, tc.expected, len(tc.funded))
+		}
+		for _, op := range tc.funded {
+			if funded := op.Operation.Facts()["flashLoan"]; funded != true {
+				t.Errorf("correlateFlash(%s) %s flashLoan = (%v); expected (true)", tc.name, op.PublishTo, funded)
+			}
+		}
+	}
+}
+
+type testFlashDB struct {
+	Database
+	saved *[]repository.FlashLoan
+}
+
+func (db testFlashDB) SaveFlashLoan(flash repository.FlashLoan) error {
+	*db.saved = append(*db.saved, flash)
+	return nil
+}
+
+func Test_publishFlashSaved(t *testing.T) {
+	weth, usdc := knownTokens["WETH"], knownTokens["USDC"]
+	var saved []repository.FlashLoan
+	a := &Analytics{Options: Options{chain: Ethereum, publishFilter: filter.Default()}}
+	send := func(data any, subjects ...string) error { return nil }
+	flash := func(txHash string) blockOperation {
+		borrowed := weth
+		borrowed.Amount = 10
+		return blockOperation{
+			Operation: &Flash{Position: Position{Token0: borrowed, Token1: usdc, TxHash: txHash}, OperationBase: OperationBase{db: testFlashDB{saved: &saved}, chain: Ethereum}},
+			PublishTo: "flash",
+		}
+	}
+
+	ops := []blockOperation{flash("0x1"), testSwapOperation(1, "0x00000000000000000000000000000000000000b0", weth, usdc, 10, 20000)}
+	ops[0].txIndex = 1
+	if err := (flashDetector{}).Detect(1, ops, send); err != nil || len(saved) != 0 {
+		t.Errorf("flashDetector.Detect() = (%v, %d saved); expected (nil, 0 saved)", err, len(saved))
+	}
+	if err := a.publishBlock(1, ops, send); err != nil {
+		t.Errorf("publishBlock() = (%v); expected (nil)", err)
+	}
+	if err := a.publishOperation(flash("0x2"), send); err != nil { // Late flash loan of a finished block
+		t.Errorf("publishOperation(late flash) = (%v); expected (nil)", err)
+	}
+
+	expected := []struct{ txHash, purpose string }{{"0x1", flashPurposeSwap}, {"0x2", ""}}
+	if len(saved) != len(expected) {
+		t.Fatalf("SaveFlashLoan called (%d) times; expected (%d)", len(saved), len(expected))
+	}
+	for i, e := range expected {
+		if saved[i].TxHash != e.txHash || saved[i].Purpose != e.purpose {
+			t.Errorf("saved[%d] = (%s, %q); expected (%s, %q)", i, saved[i].TxHash, saved[i].Purpose, e.txHash, e.purpose)
+		}
+	}
+}
+
+func Test_findRoutes(t *testing.T) {
+	weth, usdc, pepe := knownTokens["WETH"], knownTokens["USDC"], knownTokens["PEPE"]
+	weth.Price, usdc.Price = 2000, 1
+	bot := "0x00000000000000000000000000000000000000b0"
+	hop := func(txIndex uint64, pool string, from, to TokenTransaction, fromAmount, toAmount float64) blockOperation {
+		op := testSwapOperation(txIndex, bot, from, to, fromAmount, toAmount)
+		op.Operation.(*Swap).Address = pool
+		return op
+	}
+
+	tests := []struct {
+		name       string
+		ops        []blockOperation
+		trueCount  int
+		trueKind   string
+		truePath   string
+		trueInput  float64
+		trueProfit float64
+	}{
+		{"cyclic arbitrage", []blockOperation{
+			hop(1, "0xa", weth, usdc, 1, 2010),
+			hop(1, "0xb", usdc, pepe, 2010, 1e9),
+			hop(1, "0xc", pepe, weth, 1e9, 1.02),
+		}, 1, routeArbitrage, "WETH,USDC,PEPE,WETH", 1, 0.02},
+		{"split aggregator trade", []blockOperation{
+			hop(1, "0xa", usdc, weth, 1000, 0.5),
+			hop(1, "0xb", usdc, weth, 1000, 0.49),
+		}, 1, routeAggregator, "USDC,WETH", 2000, 0},
+		{"swaps of different transactions", []blockOperation{
+			hop(1, "0xa", weth, usdc, 1, 2000),
+			hop(2, "0xb", usdc, weth, 2000, 1),
+		}, 0, "", "", 0, 0},
+		{"swaps of a single pool", []blockOperation{
+			hop(1, "0xa", weth, usdc, 1, 2000),
+			hop(1, "0xa", weth, usdc, 1, 1990),
+		}, 0, "", "", 0, 0},
+	}
+	for _, test := range tests {
+		res := findRoutes(test.ops)
+		if len(res) != test.trueCount {
+			t.Fatalf("findRoutes(%s) found (%d); expected (%d)", test.name, len(res), test.trueCount)
+		}
+		if len(res) == 0 {
+			continue
+		}
+		route := res[0]
+		if path := strings.Join(route.path(), ","); route.kind() != test.trueKind || path != test.truePath ||
+			math.Abs(route.input().Amount-test.trueInput) > tolerance || math.Abs(route.profit().Amount-test.trueProfit) > 1e-9 {
+			t.Errorf("findRoutes(%s) = (%s, %s, input %v, profit %v); expected (%s, %s, input %v, profit %v)",
+				test.name, route.kind(), path, route.input().Amount, route.profit().Amount, test.trueKind, test.truePath, test.trueInput, test.trueProfit)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package ethereum
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/internal/expr"
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+const (
+	flashPurposeArbitrage = "arbitrage" // Borrowed token was swapped and bought back
+	flashPurposeLiquidity = "liquidity" // Liquidity was added or removed
+	flashPurposeSwap      = "swap"      // Tokens were swapped without coming back
+)
+
+// Flash is a flash loan of pool tokens, borrowed and paid back with fees in the same transaction.
+// Position token amounts are the borrowed amounts in pool token order.
+type Flash struct {
+	Position
+	OperationBase
+
+	Fee0 TokenTransaction // Fee paid in Token0
+	Fee1 TokenTransaction // Fee paid in Token1
+
+	Sender    string // Account that called the pool
+	Recipient string // Receiver of the borrowed tokens
+
+	Purpose    string   // What the loan funded, empty if no other operation of the transaction is known
+	Operations []string // Other operations of the transaction, e.g. swap, add
+}
+
+// Process handles pool Flash event. Purpose of the loan is known only when the block is finished, see flashDetector.
+func (fl *Flash) Process(flash WrappedEventLog) error {
+	args, err := decodePoolLog(flashEvent, flash.Log)
+	if err != nil {
+		return err
+	}
+	token0, token1, err := fl.getTokensByPoolAddress(flash.Log.Address)
+	if err != nil {
+		return err
+	}
+
+	fl.Position = newPosition(flash, fl.OperationBase.chain)
+	fl.Protocol = fl.poolProtocol(flash.Log.Address)
+	fl.Sender, fl.Recipient = args.Address("sender"), args.Address("recipient")
+	fl.Token0 = TokenTransaction{Token: token0, Amount: convertAmount(args.BigInt("amount0"), token0.Decimals)}
+	fl.Token1 = TokenTransaction{Token: token1, Amount: convertAmount(args.BigInt("amount1"), token1.Decimals)}
+	fl.Fee0 = TokenTransaction{Token: token0, Amount: convertAmount(args.BigInt("paid0"), token0.Decimals)}
+	fl.Fee1 = TokenTransaction{Token: token1, Amount: convertAmount(args.BigInt("paid1"), token1.Decimals)}
+
+	fl.Token0.Price = fl.fetchTokenPrice(fl.Token0.Address)
+	fl.Token1.Price = fl.fetchTokenPrice(fl.Token1.Address)
+	fl.Fee0.Price, fl.Fee1.Price = fl.Token0.Price, fl.Token1.Price
+	fl.TotalValue = fl.Token0.Amount*fl.Token0.Price + fl.Token1.Amount*fl.Token1.Price
+	return nil
+}
+
+func (fl Flash) feeUSD() float64 {
+	return fl.Fee0.Amount*fl.Fee0.Price + fl.Fee1.Amount*fl.Fee1.Price
+}
+
+func (fl Flash) String() string {
+	format := "Flash loan of %f of %s and %f of %s ($%f) from %s. Fees paid $%f"
+	return fmt.Sprintf(format,
+		fl.Token0.Amount,
+		fl.Token0.Symbol,
+		fl.Token1.Amount,
+		fl.Token1.Symbol,
+		fl.TotalValue,
+		fl.Address,
+		fl.feeUSD())
+}
+
+func (fl Flash) CanPublish() bool {
+	if strings.EqualFold(fl.Token0.Symbol, "") || strings.EqualFold(fl.Token1.Symbol, "") {
+		log.Printf("SKIP - token symbol unknown. Tx: %s\n\n", fl.TxHash)
+		return false
+	}
+	return fl.Token0.Amount != 0 || fl.Token1.Amount != 0
+}
+
+func (fl Flash) Facts() expr.Env {
+	facts := fl.Position.Facts()
+	facts["feeUSD"] = fl.feeUSD()
+	facts["sender"] = fl.Sender
+	facts["recipient"] = fl.Recipient
+	facts["purpose"] = fl.Purpose
+	return facts
+}
+
+func (fl Flash) Publish(send analytics.Sender, publishTo string, timestamp time.Time) error {
+	flashMessage := types.FlashMessage{
+		Timestamp: timestamp,
+		ChainID:   fl.OperationBase.chain.ID,
+		Protocol:  fl.Protocol,
+		Address:   fl.Address,
+		TxHash:    fl.TxHash,
+		Borrowed: [2]types.TokenMessage{
+			fl.Token0.message(),
+			fl.Token1.message(),
+		},
+		Fees: [2]types.TokenMessage{
+			fl.Fee0.message(),
+			fl.Fee1.message(),
+		},
+		ValueUSD:   fl.TotalValue,
+		FeeUSD:     fl.feeUSD(),
+		Sender:     fl.Sender,
+		Recipient:  fl.Recipient,
+		Purpose:    fl.Purpose,
+		Operations: fl.Operations,
+	}
+
+	return send(flashMessage, publishTo, fl.Address)
+}
+
+func (fl Flash) Save(ts time.Time) error {
+	flash := repository.FlashLoan{
+		TimestampReceived: ts,
+		LPoolAddress:      fl.Address,
+		Token0Address:     fl.Token0.Address,
+		Token0Amount:      fl.Token0.Amount,
+		Token0Fee:         fl.Fee0.Amount,
+		Token1Address:     fl.Token1.Address,
+		Token1Amount:      fl.Token1.Amount,
+		Token1Fee:         fl.Fee1.Amount,
+		ValueUSD:          fl.TotalValue,
+		FeeUSD:            fl.feeUSD(),
+		Sender:            fl.Sender,
+		Recipient:         fl.Recipient,
+		Purpose:           fl.Purpose,
+		TxHash:            fl.TxHash,
+	}
+	return fl.db.SaveFlashLoan(flash)
+}
+
+// flashDetector correlates flash loans of a finished block with other operations of their transactions:
+// it marks the operations as funded by a flash loan and tells the purpose of the loan.
+type flashDetector struct{}
+
+func (fd flashDetector) Detect(block uint64, ops []blockOperation, send analytics.Sender) error {
+	for i, op := range ops {
+		flash, isFlash := op.Operation.(*Flash)
+		if !isFlash {
+			continue
+		}
+		var funded []blockOperation
+		for k, other := range ops {
+			if _, isMint := other.Operation.(*poolMint); k != i && other.txIndex == op.txIndex && !isMint { // Direct pool mints are buffered for detectors only
+				funded = append(funded, other)
+			}
+		}
+		correlateFlash(flash, funded)
+	}
+	return nil
+}
+
+// correlateFlash sets purpose of the flash loan from operations of its transaction and marks them as funded by it.
+func correlateFlash(flash *Flash, funded []blockOperation) {
+	flash.Operations = make([]string, 0, len(funded))
+	var swaps []*Swap
+	liquidity := false
+	for _, op := range funded {
+		flash.Operations = append(flash.Operations, op.PublishTo)
+		switch op := op.Operation.(type) {
+		case *Swap:
+			op.FlashLoan = true
+			swaps = append(swaps, op)
+		case *Addition:
+			op.FlashLoan = true
+			liquidity = true
+		case *Removal:
+			op.FlashLoan = true
+			liquidity = true
+		case *FeeCollection:
+			op.FlashLoan = true
+		}
+	}
+
+	switch {
+	case isFlashArbitrage(flash, swaps):
+		flash.Purpose = flashPurposeArbitrage
+	case liquidity:
+		flash.Purpose = flashPurposeLiquidity
+	case len(swaps) > 0:
+		flash.Purpose = flashPurposeSwap
+	}
+}
+
+// isFlashArbitrage checks if a borrowed token was swapped into other tokens and bought back by the swaps,
+// so that the loan is repaid from the profit of the price difference between pools.
+func isFlashArbitrage(flash *Flash, swaps []*Swap) bool {
+	if len(swaps) < 2 {
+		return false
+	}
+	for _, borrowed := range []TokenTransaction{flash.Token0, flash.Token1} {
+		if borrowed.Amount == 0 {
+			continue
+		}
+		sold, bought := false, false
+		for _, sw := range swaps {
+			sold = sold || strings.EqualFold(sw.From.Address, borrowed.Address)
+			bought = bought || strings.EqualFold(sw.To.Address, borrowed.Address)
+		}
+		if sold && bought {
+			return true
+		}
+	}
+	return false
+}
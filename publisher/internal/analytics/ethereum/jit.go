@@ -0,0 +1,186 @@
+package ethereum
+
+import (
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/internal/expr"
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+// jitLiquidity is liquidity added to a pool right before swaps and removed right after them in the same block.
+// Liquidity is added by positions manager (Addition) or directly in the pool (poolMint).
+type jitLiquidity struct {
+	addition blockOperation
+	swaps    []blockOperation
+	removal  blockOperation
+}
+
+// poolMint is pool Mint of a position owned directly in the pool, not through a positions manager.
+// It is not published, it is buffered only so that liquidity JIT bots mint in the pool directly can be matched
+// with its removal (direct Burn and Collect are published as removal).
+type poolMint struct {
+	Address   string
+	Owner     string
+	LowerTick int
+	UpperTick int
+
+	amount0, amount1 *big.Int // Pool token order
+}
+
+func (pm *poolMint) Process(WrappedEventLog) error                     { return nil }
+func (pm *poolMint) String() string                                    { return "Direct mint to " + pm.Address }
+func (pm *poolMint) CanPublish() bool                                  { return false }
+func (pm *poolMint) Facts() expr.Env                                   { return expr.Env{} }
+func (pm *poolMint) Publish(analytics.Sender, string, time.Time) error { return nil }
+func (pm *poolMint) Save(time.Time) error                              { return nil }
+
+// directMint decodes pool Mint of a position that is not owned by a positions manager.
+func (a *Analytics) directMint(wel WrappedEventLog) (*poolMint, bool) {
+	if wel.Instructions.Name != mintEvent {
+		return nil, false
+	}
+	args, err := decodePoolLog(mintEvent, wel.Log)
+	if err != nil || a.isPositionsManager(args.Address("owner")) {
+		return nil, false
+	}
+	return &poolMint{
+		Address:   wel.Log.Address,
+		Owner:     args.Address("owner"),
+		LowerTick: args.Int("tickLower"),
+		UpperTick: args.Int("tickUpper"),
+		amount0:   args.BigInt("amount0"),
+		amount1:   args.BigInt("amount1"),
+	}, true
+}
+
+// jitPosition is the position liquidity is added to by an Addition or a direct pool Mint.
+type jitPosition struct {
+	pool      string
+	tokenID   string // Empty if liquidity was not added via positions manager
+	owner     string // Set for direct pool mints only
+	lowerTick int
+	upperTick int
+}
+
+func addedPosition(op Operation) (jitPosition, bool) {
+	switch add := op.(type) {
+	case *Addition:
+		return jitPosition{pool: add.Address, tokenID: add.TokenID, lowerTick: add.LowerTick, upperTick: add.UpperTick}, true
+	case *poolMint:
+		return jitPosition{pool: add.Address, owner: add.Owner, lowerTick: add.LowerTick, upperTick: add.UpperTick}, true
+	}
+	return jitPosition{}, false
+}
+
+// jitDetector marks additions, swaps and removals of just-in-time liquidity in a finished block and reports them.
+type jitDetector struct {
+	chain Chain
+}
+
+func (jd jitDetector) Detect(block uint64, ops []blockOperation, send analytics.Sender) error {
+	for _, found := range findJITLiquidity(ops) {
+		if add, isAddition := found.addition.Operation.(*Addition); isAddition {
+			add.JIT = true
+		}
+		found.removal.Operation.(*Removal).JIT = true
+		for _, swap := range found.swaps {
+			swap.Operation.(*Swap).JIT = true
+		}
+		if err := send(jd.newJITMessage(block, found), "jit"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findJITLiquidity matches additions (and direct pool mints) with removals of the same pool and tick range
+// (and position NFT or direct owner, if known) in a later transaction of the block, that have swaps of the pool
+// executed between them.
+func findJITLiquidity(ops []blockOperation) []jitLiquidity {
+	var res []jitLiquidity
+	used := make(map[int]bool)
+	for i, addOp := range ops {
+		add, isAddition := addedPosition(addOp.Operation)
+		if !isAddition {
+			continue
+		}
+		for k := i + 1; k < len(ops); k++ {
+			rem, isRemoval := ops[k].Operation.(*Removal)
+			if !isRemoval || used[k] || ops[k].txIndex == addOp.txIndex || !isSamePositionRange(add, rem) {
+				continue
+			}
+
+			var swaps []blockOperation
+			for _, op := range ops[i+1 : k] {
+				if sw, isSwap := op.Operation.(*Swap); isSwap && strings.EqualFold(sw.Address, add.pool) &&
+					op.txIndex != addOp.txIndex && op.txIndex != ops[k].txIndex {
+					swaps = append(swaps, op)
+				}
+			}
+			if len(swaps) == 0 {
+				break // Liquidity was removed without being used
+			}
+			used[k] = true
+			res = append(res, jitLiquidity{addition: addOp, swaps: swaps, removal: ops[k]})
+			break
+		}
+	}
+	return res
+}
+
+func isSamePositionRange(add jitPosition, rem *Removal) bool {
+	if add.tokenID != "" && rem.TokenID != "" {
+		return add.tokenID == rem.TokenID
+	}
+	if add.owner != "" && (rem.TokenID != "" || !strings.EqualFold(add.owner, rem.Owner)) {
+		return false // Directly owned position is removed by its owner
+	}
+	return strings.EqualFold(add.pool, rem.Address) && add.lowerTick == rem.LowerTick && add.upperTick == rem.UpperTick
+}
+
+func (jd jitDetector) newJITMessage(block uint64, jit jitLiquidity) types.JITMessage {
+	add, _ := addedPosition(jit.addition.Operation)
+	rem := jit.removal.Operation.(*Removal)
+	msg := types.JITMessage{
+		Timestamp:    jit.removal.Timestamp,
+		ChainID:      jd.chain.ID,
+		Address:      add.pool,
+		BlockNumber:  block,
+		TokenID:      add.tokenID,
+		LowerTick:    add.lowerTick,
+		UpperTick:    add.upperTick,
+		LiquidityUSD: jit.liquidityUSD(),
+		FeesUSD:      rem.Token0Earned.Amount*rem.Token0.Price + rem.Token1Earned.Amount*rem.Token1.Price,
+		Fees: [2]types.TokenMessage{
+			{Address: rem.Token0.Address, Symbol: rem.Token0.Symbol, Amount: rem.Token0Earned.Amount, Price: rem.Token0.Price},
+			{Address: rem.Token1.Address, Symbol: rem.Token1.Symbol, Amount: rem.Token1Earned.Amount, Price: rem.Token1.Price},
+		},
+		AddTxHash:    jit.addition.Log.TransactionHash,
+		RemoveTxHash: rem.TxHash,
+	}
+	for _, op := range jit.swaps {
+		sw := op.Operation.(*Swap)
+		msg.SwapsUSD += sw.TotalValue
+		msg.SwapTxHashes = append(msg.SwapTxHashes, sw.TxHash)
+	}
+	return msg
+}
+
+// liquidityUSD values liquidity added. Direct pool mints are valued with tokens and prices of the removal.
+func (jit jitLiquidity) liquidityUSD() float64 {
+	switch add := jit.addition.Operation.(type) {
+	case *Addition:
+		return add.TotalValue
+	case *poolMint:
+		rem := jit.removal.Operation.(*Removal)
+		amount0, amount1 := add.amount0, add.amount1
+		if strings.ToLower(rem.Token0.Address) > strings.ToLower(rem.Token1.Address) { // Pool tokens are sorted by address
+			amount0, amount1 = amount1, amount0
+		}
+		return convertAmount(amount0, rem.Token0.Decimals)*rem.Token0.Price + convertAmount(amount1, rem.Token1.Decimals)*rem.Token1.Price
+	}
+	return 0
+}
@@ -0,0 +1,279 @@
+package ethereum
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+var defaultLeaderboardWindows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+const (
+	leaderboardBucketSize  = time.Hour // Rolling windows move by one bucket
+	defaultLeaderboardSize = 10
+
+	liquidityMetric = "liquidity" // Leaderboard metrics, part of the published subject
+	feesMetric      = "fees"
+	volumeMetric    = "volume"
+	poolsMetric     = "pools"
+)
+
+var leaderboardMetrics = []string{liquidityMetric, feesMetric, volumeMetric, poolsMetric}
+
+// walletBucket accumulates wallet activity of one hour.
+type walletBucket struct {
+	start        time.Time
+	liquidityUSD float64
+	feesUSD      float64
+	volumeUSD    float64
+	pools        map[string]bool
+}
+
+// walletStats is rolling statistics of a wallet over one window.
+type walletStats struct {
+	Address      string
+	Window       time.Duration
+	LiquidityUSD float64 // Value of liquidity added
+	FeesUSD      float64 // Fees earned by removals and fee collections
+	VolumeUSD    float64 // Value swapped as swap recipient
+	Pools        int     // Number of distinct pools touched
+}
+
+// leaderboard keeps per-wallet hourly buckets of liquidity provided, fees earned and swap volume for the longest
+// rolling window. Liquidity and fees are attributed to position owners, swap volume to swap recipients.
+// Buckets are stored as they change, so that windows survive restarts.
+type leaderboard struct {
+	db      Database
+	mu      sync.Mutex
+	windows []time.Duration
+	wallets map[string][]*walletBucket // Buckets of a wallet are ordered by time
+}
+
+func newLeaderboard(db Database, windows []time.Duration) *leaderboard {
+	return &leaderboard{
+		db:      db,
+		windows: windows,
+		wallets: make(map[string][]*walletBucket),
+	}
+}
+
+// Rebuild replaces the buckets with the ones stored during the longest window before now.
+func (lb *leaderboard) Rebuild(now time.Time) {
+	buckets := lb.db.GetWalletBuckets(now.Add(-lb.longestWindow()))
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	lb.wallets = make(map[string][]*walletBucket)
+	for _, b := range buckets {
+		bucket := lb.bucket(b.Address, b.Start)
+		bucket.liquidityUSD += b.LiquidityUSD
+		bucket.feesUSD += b.FeesUSD
+		bucket.volumeUSD += b.VolumeUSD
+		for _, pool := range strings.Split(b.Pools, ",") {
+			if pool != "" {
+				bucket.pools[pool] = true
+			}
+		}
+	}
+}
+
+// Add accounts operation into the stats of its wallet and stores the updated bucket.
+// Operations without a known wallet are ignored.
+func (lb *leaderboard) Add(op Operation, timestamp time.Time) error {
+	var wallet, poolAddress string
+	var liquidityUSD, feesUSD, volumeUSD float64
+	switch op := op.(type) {
+	case *Addition:
+		wallet, poolAddress, liquidityUSD = op.Owner, op.Address, op.TotalValue
+	case *Removal:
+		wallet, poolAddress, feesUSD = op.Owner, op.Address, op.Token0Earned.Amount*op.Token0.Price+op.Token1Earned.Amount*op.Token1.Price
+	case *FeeCollection:
+		wallet, poolAddress, feesUSD = op.Owner, op.Address, op.TotalValue
+	case *Swap:
+		wallet, poolAddress, volumeUSD = op.Recipient, op.Address, op.TotalValue
+	}
+	if wallet == "" {
+		return nil
+	}
+	wallet = strings.ToLower(wallet)
+
+	lb.mu.Lock()
+	bucket := lb.bucket(wallet, timestamp)
+	bucket.liquidityUSD += liquidityUSD
+	bucket.feesUSD += feesUSD
+	bucket.volumeUSD += volumeUSD
+	bucket.pools[strings.ToLower(poolAddress)] = true
+	stored := newWalletBucket(wallet, bucket)
+	lb.mu.Unlock()
+
+	return lb.db.SaveWalletBucket(stored)
+}
+
+// bucket returns the bucket of the wallet for the timestamp, adding it if missing.
+func (lb *leaderboard) bucket(wallet string, timestamp time.Time) *walletBucket {
+	start := timestamp.UTC().Truncate(leaderboardBucketSize)
+	buckets := lb.wallets[wallet]
+	var bucket *walletBucket
+	for i := len(buckets) - 1; i >= 0; i-- {
+		if buckets[i].start.Equal(start) {
+			bucket = buckets[i]
+			break
+		}
+		if buckets[i].start.Before(start) {
+			break
+		}
+	}
+	if bucket == nil {
+		bucket = &walletBucket{start: start, pools: make(map[string]bool)}
+		buckets = append(buckets, bucket)
+		sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].start.Before(buckets[j].start) })
+		lb.wallets[wallet] = buckets
+	}
+	return bucket
+}
+
+func (lb *leaderboard) longestWindow() time.Duration {
+	var longest time.Duration
+	for _, window := range lb.windows {
+		if window > longest {
+			longest = window
+		}
+	}
+	return longest
+}
+
+// Snapshot returns stats of every wallet that had activity during the longest window, by window.
+// Older buckets are dropped; wallets left without activity are returned once more with empty stats.
+func (lb *leaderboard) Snapshot(now time.Time) map[time.Duration][]walletStats {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	longest := lb.longestWindow()
+	res := make(map[time.Duration][]walletStats)
+	for wallet, buckets := range lb.wallets {
+		expired := sort.Search(len(buckets), func(i int) bool { return buckets[i].start.After(now.Add(-longest)) })
+		if buckets = buckets[expired:]; len(buckets) == 0 {
+			delete(lb.wallets, wallet)
+		} else {
+			lb.wallets[wallet] = buckets
+		}
+
+		for _, window := range lb.windows {
+			res[window] = append(res[window], walletWindowStats(wallet, buckets, window, now))
+		}
+	}
+	return res
+}
+
+func walletWindowStats(wallet string, buckets []*walletBucket, window time.Duration, now time.Time) walletStats {
+	stats := walletStats{Address: wallet, Window: window}
+	pools := make(map[string]bool)
+	for _, bucket := range buckets {
+		if !bucket.start.After(now.Add(-window)) {
+			continue
+		}
+		stats.LiquidityUSD += bucket.liquidityUSD
+		stats.FeesUSD += bucket.feesUSD
+		stats.VolumeUSD += bucket.volumeUSD
+		for pool := range bucket.pools {
+			pools[pool] = true
+		}
+	}
+	stats.Pools = len(pools)
+	return stats
+}
+
+// metricValue returns the value of the stats the wallets are ranked by.
+func (ws walletStats) metricValue(metric string) float64 {
+	switch metric {
+	case liquidityMetric:
+		return ws.LiquidityUSD
+	case feesMetric:
+		return ws.FeesUSD
+	case volumeMetric:
+		return ws.VolumeUSD
+	case poolsMetric:
+		return float64(ws.Pools)
+	}
+	return 0
+}
+
+// topWallets returns up to n wallets with the highest non-zero metric value, ties ordered by address.
+func topWallets(stats []walletStats, metric string, n int) []walletStats {
+	var res []walletStats
+	for _, s := range stats {
+		if s.metricValue(metric) > 0 {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		vi, vj := res[i].metricValue(metric), res[j].metricValue(metric)
+		if vi != vj {
+			return vi > vj
+		}
+		return res[i].Address < res[j].Address
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+func newWalletBucket(wallet string, bucket *walletBucket) repository.WalletBucket {
+	pools := make([]string, 0, len(bucket.pools))
+	for pool := range bucket.pools {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+	return repository.WalletBucket{
+		Address:      wallet,
+		Start:        bucket.start,
+		LiquidityUSD: bucket.liquidityUSD,
+		FeesUSD:      bucket.feesUSD,
+		VolumeUSD:    bucket.volumeUSD,
+		Pools:        strings.Join(pools, ","),
+	}
+}
+
+func newWalletStats(ws walletStats, timestamp time.Time) repository.WalletStats {
+	return repository.WalletStats{
+		Address:      ws.Address,
+		Window:       intervalName(ws.Window),
+		LiquidityUSD: ws.LiquidityUSD,
+		FeesUSD:      ws.FeesUSD,
+		VolumeUSD:    ws.VolumeUSD,
+		Pools:        ws.Pools,
+		UpdatedAt:    timestamp,
+	}
+}
+
+func newLeaderboardMessage(metric string, windows []time.Duration, stats map[time.Duration][]walletStats, size int, chainID int64, timestamp time.Time) types.LeaderboardMessage {
+	msg := types.LeaderboardMessage{
+		Timestamp: timestamp,
+		ChainID:   chainID,
+		Metric:    metric,
+	}
+	for _, window := range windows {
+		windowMsg := types.LeaderboardWindowMessage{
+			Window:  intervalName(window),
+			Entries: []types.LeaderboardEntryMessage{},
+		}
+		for i, s := range topWallets(stats[window], metric, size) {
+			windowMsg.Entries = append(windowMsg.Entries, types.LeaderboardEntryMessage{
+				Rank:         i + 1,
+				Address:      s.Address,
+				LiquidityUSD: s.LiquidityUSD,
+				FeesUSD:      s.FeesUSD,
+				VolumeUSD:    s.VolumeUSD,
+				Pools:        s.Pools,
+			})
+		}
+		msg.Windows = append(msg.Windows, windowMsg)
+	}
+	return msg
+}
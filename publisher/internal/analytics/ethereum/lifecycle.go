@@ -0,0 +1,172 @@
+package ethereum
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+// positionLifecycle keeps ledger of every position NFT from its first addition until all liquidity is removed.
+// Closed positions are reported (deposited and withdrawn value, fees, impermanent loss, duration) and persisted.
+type positionLifecycle struct {
+	db    Database
+	chain Chain
+}
+
+// Record accounts processed operation into the ledger of its position NFT.
+// Operations that were not made via positions manager are ignored.
+func (pl positionLifecycle) Record(op Operation, send analytics.Sender, timestamp time.Time) error {
+	switch op := op.(type) {
+	case *Addition:
+		if op.TokenID == "" {
+			return nil
+		}
+		ledger := pl.ledger(op.TokenID, op.Position)
+		if ledger.OpenedAt.IsZero() {
+			ledger.OpenedAt = timestamp
+		}
+		token0, token1 := ledger.align(op.Token0, op.Token1)
+		ledger.Token0Deposited += token0.Amount
+		ledger.Token1Deposited += token1.Amount
+		ledger.DepositedUSD += op.TotalValue
+		return pl.db.SavePositionLedger(ledger.PositionLedger)
+	case *FeeCollection:
+		if op.TokenID == "" {
+			return nil
+		}
+		ledger := pl.ledger(op.TokenID, op.Position)
+		ledger.addFees(op.Token0, op.Token1)
+		return pl.db.SavePositionLedger(ledger.PositionLedger)
+	case *Removal:
+		if op.TokenID == "" {
+			return nil
+		}
+		ledger := pl.ledger(op.TokenID, op.Position)
+		token0, token1 := ledger.align(op.Token0, op.Token1)
+		ledger.Token0Withdrawn += token0.Amount
+		ledger.Token1Withdrawn += token1.Amount
+		ledger.WithdrawnUSD += op.TotalValue
+		earned0, earned1 := op.Token0Earned, op.Token1Earned
+		earned0.Price, earned1.Price = op.Token0.Price, op.Token1.Price
+		ledger.addFees(earned0, earned1)
+
+		if !pl.isClosed(op.TokenID) {
+			return pl.db.SavePositionLedger(ledger.PositionLedger)
+		}
+		return pl.close(ledger, op, send, timestamp)
+	}
+	return nil
+}
+
+// close reports the position and starts a new ledger in case position NFT is reused.
+func (pl positionLifecycle) close(ledger positionLedger, rem *Removal, send analytics.Sender, timestamp time.Time) error {
+	err := pl.db.SavePositionLedger(repository.PositionLedger{TokenID: ledger.TokenID})
+	if err != nil {
+		return err
+	}
+	if ledger.OpenedAt.IsZero() { // Position was opened before tracking started - deposits are unknown
+		return nil
+	}
+
+	exit0, exit1 := ledger.align(rem.Token0, rem.Token1)
+	report := ledger.report(exit0.Price, exit1.Price, timestamp)
+	report.TxHash = rem.TxHash
+	if pos, found := pl.db.GetPosition(ledger.TokenID); found {
+		report.Owner = pos.Owner
+	}
+
+	if err := pl.db.SavePositionReport(report); err != nil {
+		return err
+	}
+	return send(newPositionClosedMessage(report, pl.chain.ID), "position", "closed")
+}
+
+func (pl positionLifecycle) isClosed(tokenID string) bool {
+	pos, found := pl.db.GetPosition(tokenID)
+	return found && parseBigInt(pos.Liquidity).Sign() == 0
+}
+
+func (pl positionLifecycle) ledger(tokenID string, pos Position) positionLedger {
+	ledger, found := pl.db.GetPositionLedger(tokenID)
+	if !found || ledger.Token0Address == "" {
+		ledger = repository.PositionLedger{
+			TokenID:       tokenID,
+			LPoolAddress:  pos.Address,
+			Token0Address: pos.Token0.Address,
+			Token0Symbol:  pos.Token0.Symbol,
+			Token1Address: pos.Token1.Address,
+			Token1Symbol:  pos.Token1.Symbol,
+		}
+	}
+	return positionLedger{ledger}
+}
+
+type positionLedger struct {
+	repository.PositionLedger
+}
+
+// align orders tokens of operation as in the ledger - operations may have tokens switched for readability.
+func (l positionLedger) align(token0, token1 TokenTransaction) (TokenTransaction, TokenTransaction) {
+	if strings.EqualFold(token0.Address, l.Token1Address) && strings.EqualFold(token1.Address, l.Token0Address) {
+		return token1, token0
+	}
+	return token0, token1
+}
+
+func (l *positionLedger) addFees(fees0, fees1 TokenTransaction) {
+	fees0, fees1 = l.align(fees0, fees1)
+	l.Token0Fees += fees0.Amount
+	l.Token1Fees += fees1.Amount
+	l.FeesUSD += fees0.Amount*fees0.Price + fees1.Amount*fees1.Price
+}
+
+// report calculates results of the closed position. HODL value is the deposited tokens valued at exit prices,
+// impermanent loss compares withdrawn tokens with HODL value at the same prices.
+func (l positionLedger) report(exitPrice0, exitPrice1 float64, closedAt time.Time) repository.PositionReport {
+	report := repository.PositionReport{
+		PositionLedger: l.PositionLedger,
+		ClosedAt:       closedAt,
+		HodlUSD:        l.Token0Deposited*exitPrice0 + l.Token1Deposited*exitPrice1,
+		PnlUSD:         l.WithdrawnUSD + l.FeesUSD - l.DepositedUSD,
+	}
+	report.ImpermanentLossUSD = l.Token0Withdrawn*exitPrice0 + l.Token1Withdrawn*exitPrice1 - report.HodlUSD
+	if report.HodlUSD > 0 {
+		report.ImpermanentLoss = report.ImpermanentLossUSD / report.HodlUSD
+	}
+	return report
+}
+
+func newPositionClosedMessage(report repository.PositionReport, chainID int64) types.PositionClosedMessage {
+	return types.PositionClosedMessage{
+		Timestamp:          report.ClosedAt,
+		ChainID:            chainID,
+		Address:            report.LPoolAddress,
+		TokenID:            report.TokenID,
+		Owner:              report.Owner,
+		OpenedAt:           report.OpenedAt,
+		DurationSeconds:    int64(report.ClosedAt.Sub(report.OpenedAt).Seconds()),
+		DepositedUSD:       report.DepositedUSD,
+		WithdrawnUSD:       report.WithdrawnUSD,
+		FeesEarnedUSD:      report.FeesUSD,
+		HodlUSD:            report.HodlUSD,
+		ImpermanentLossUSD: report.ImpermanentLossUSD,
+		ImpermanentLoss:    report.ImpermanentLoss,
+		PnlUSD:             report.PnlUSD,
+		Deposited: [2]types.TokenMessage{
+			{Address: report.Token0Address, Symbol: report.Token0Symbol, Amount: report.Token0Deposited},
+			{Address: report.Token1Address, Symbol: report.Token1Symbol, Amount: report.Token1Deposited},
+		},
+		Withdrawn: [2]types.TokenMessage{
+			{Address: report.Token0Address, Symbol: report.Token0Symbol, Amount: report.Token0Withdrawn},
+			{Address: report.Token1Address, Symbol: report.Token1Symbol, Amount: report.Token1Withdrawn},
+		},
+		Fees: [2]types.TokenMessage{
+			{Address: report.Token0Address, Symbol: report.Token0Symbol, Amount: report.Token0Fees},
+			{Address: report.Token1Address, Symbol: report.Token1Symbol, Amount: report.Token1Fees},
+		},
+		TxHash: report.TxHash,
+	}
+}
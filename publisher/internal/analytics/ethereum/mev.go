@@ -0,0 +1,137 @@
+package ethereum
+
+import (
+	"strings"
+
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+// sandwich is a front-run swap and a back-run swap of the same attacker around victim swaps in the same pool.
+type sandwich struct {
+	frontRun blockOperation
+	victims  []blockOperation
+	backRun  blockOperation
+}
+
+// sandwichDetector looks for sandwich attacks among swaps of a finished block.
+type sandwichDetector struct {
+	chain Chain
+}
+
+func (sd sandwichDetector) Detect(block uint64, ops []blockOperation, send analytics.Sender) error {
+	for _, found := range findSandwiches(ops) {
+		if err := send(sd.newSandwichMessage(block, found), "mev", "sandwich"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSandwiches groups swaps by pool (keeping block order) and matches sandwich patterns:
+// attacker swaps A to B, victims swap A to B in later transactions, attacker swaps B back to A.
+func findSandwiches(ops []blockOperation) []sandwich {
+	pools := make(map[string][]blockOperation)
+	var poolOrder []string
+	for _, op := range ops {
+		if _, isSwap := op.Operation.(*Swap); !isSwap {
+			continue
+		}
+		pool := strings.ToLower(op.Operation.(*Swap).Address) // Pool address or ID, not the emitting contract (e.g. V4 PoolManager)
+		if _, found := pools[pool]; !found {
+			poolOrder = append(poolOrder, pool)
+		}
+		pools[pool] = append(pools[pool], op)
+	}
+
+	var res []sandwich
+	for _, pool := range poolOrder {
+		swaps := pools[pool]
+		for i := 0; i < len(swaps); i++ {
+			front := swaps[i].Operation.(*Swap)
+			attacker := front.Recipient
+			for k := i + 2; k < len(swaps); k++ {
+				back := swaps[k].Operation.(*Swap)
+				if swaps[k].txIndex == swaps[i].txIndex || !isSameActor(attacker, back) ||
+					!strings.EqualFold(back.From.Address, front.To.Address) || !strings.EqualFold(back.To.Address, front.From.Address) {
+					continue
+				}
+
+				var victims []blockOperation
+				for _, candidate := range swaps[i+1 : k] {
+					victim := candidate.Operation.(*Swap)
+					if candidate.txIndex != swaps[i].txIndex && candidate.txIndex != swaps[k].txIndex &&
+						!isSameActor(attacker, victim) && strings.EqualFold(victim.From.Address, front.From.Address) {
+						victims = append(victims, candidate)
+					}
+				}
+				if len(victims) == 0 {
+					continue
+				}
+				res = append(res, sandwich{frontRun: swaps[i], victims: victims, backRun: swaps[k]})
+				i = k // Swaps of the sandwich are not reused
+				break
+			}
+		}
+	}
+	return res
+}
+
+// isSameActor reports whether address is sender or recipient of the swap. Sandwich bots usually swap
+// through their own contract which is both the sender and the recipient.
+func isSameActor(address string, sw *Swap) bool {
+	if address == "" {
+		return false
+	}
+	return strings.EqualFold(address, sw.Sender) || strings.EqualFold(address, sw.Recipient)
+}
+
+// profit returns amount of the front-run input token the attacker gained (or lost if negative).
+func (s sandwich) profit() TokenTransaction {
+	front, back := s.frontRun.Operation.(*Swap), s.backRun.Operation.(*Swap)
+	profit := front.From
+	profit.Amount = back.To.Amount - front.From.Amount
+	return profit
+}
+
+// victimLossUSD estimates how much victims overpaid: front-run moved the pool price by its price impact
+// before victims were executed, so victims received about as much less of the output token.
+func (s sandwich) victimLossUSD() float64 {
+	front := s.frontRun.Operation.(*Swap)
+	var loss float64
+	for _, op := range s.victims {
+		victim := op.Operation.(*Swap)
+		loss += victim.To.Amount * victim.To.Price * front.PriceImpactBps / 10_000
+	}
+	return loss
+}
+
+func (sd sandwichDetector) newSandwichMessage(block uint64, s sandwich) types.SandwichMessage {
+	front, profit := s.frontRun.Operation.(*Swap), s.profit()
+	msg := types.SandwichMessage{
+		Timestamp:         s.backRun.Timestamp,
+		ChainID:           sd.chain.ID,
+		Address:           front.Address,
+		BlockNumber:       block,
+		Attacker:          front.Recipient,
+		FrontRun:          newSwapLegMessage(s.frontRun),
+		BackRun:           newSwapLegMessage(s.backRun),
+		AttackerProfit:    profit.message(),
+		AttackerProfitUSD: profit.Amount * profit.Price,
+		VictimLossUSD:     s.victimLossUSD(),
+	}
+	for _, victim := range s.victims {
+		msg.Victims = append(msg.Victims, newSwapLegMessage(victim))
+	}
+	return msg
+}
+
+func newSwapLegMessage(op blockOperation) types.SwapLegMessage {
+	sw := op.Operation.(*Swap)
+	return types.SwapLegMessage{
+		TxHash:    sw.TxHash,
+		Recipient: sw.Recipient,
+		From:      sw.From.message(),
+		To:        sw.To.message(),
+	}
+}
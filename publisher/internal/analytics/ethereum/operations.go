@@ -3,33 +3,55 @@ package ethereum
 import (
 	"fmt"
 	"log"
+	"math"
+	"math/big"
 	"strings"
 	"time"
 
+	"github.com/Synternet/swapscope/publisher/internal/expr"
 	"github.com/Synternet/swapscope/publisher/pkg/analytics"
 	"github.com/Synternet/swapscope/publisher/pkg/repository"
 	"github.com/Synternet/swapscope/publisher/pkg/types"
-	"golang.org/x/exp/slices"
 )
 
 type Fetchers struct {
-	priceFetcher PriceFetcher
-	tokenFetcher TokenFetcher
+	priceFetcher   PriceFetcher
+	tokenFetcher   TokenFetcher
+	poolFeeFetcher PoolFeeFetcher
 }
 
 type OperationBase struct {
-	db       Database
-	cache    Cache
-	fetchers Fetchers
+	db         Database
+	cache      Cache
+	fetchers   Fetchers
+	poolPrices *poolPriceCache
+	chain      Chain
+	protocol   string // Protocol of the handled event
 }
 
 type Database interface {
 	SaveRemoval(repository.Removal) error
 	SaveSwap(repository.Swap) error
+	SaveFlashLoan(repository.FlashLoan) error
 	SaveAddition(repository.Addition) error
 	GetPoolPairAddresses(string) (string, string, bool)
+	GetPoolProtocol(string) (string, bool)
 	GetToken(string) (repository.Token, bool)
 	SavePool(repository.Pool) error
+	SavePoolFeeAPR(string, float64) error
+	GetPosition(string) (repository.LiquidityPosition, bool)
+	GetOpenPositions(string) []repository.LiquidityPosition
+	SavePosition(repository.LiquidityPosition) error
+	GetPositionLedger(string) (repository.PositionLedger, bool)
+	SavePositionLedger(repository.PositionLedger) error
+	SavePositionReport(repository.PositionReport) error
+	SaveCandle(repository.Candle) error
+	GetTickLiquidity() []repository.TickLiquidity
+	SaveLiquidityChange(repository.LiquidityChange) (bool, error)
+	GetOwedTokens(string, string, int, int) (repository.OwedTokens, bool)
+	SaveOwedTokens(repository.OwedTokens) error
+	GetWalletBuckets(time.Time) []repository.WalletBucket
+	SaveWalletBucket(repository.WalletBucket) error
 }
 
 type Cache interface {
@@ -37,10 +59,11 @@ type Cache interface {
 }
 
 type Operation interface {
-	// Common methods shared by Addition, Removal and Swap
+	// Common methods shared by Addition, Removal, FeeCollection and Swap
 	Process(WrappedEventLog) error
 	String() string
 	CanPublish() bool
+	Facts() expr.Env
 	Publish(analytics.Sender, string, time.Time) error
 	Save(time.Time) error
 }
@@ -48,16 +71,36 @@ type Operation interface {
 type Removal struct {
 	Position
 	OperationBase
-	Send analytics.Sender
+	Send    analytics.Sender
+	TokenID string // Positions manager NFT, empty if liquidity was not removed via positions manager
+
+	Owner     string // Position owner: NFT owner if known, otherwise Burn owner
+	Recipient string // Receiver of the collected tokens
 
-	Token0Earned TokenTransaction
+	Token0Earned TokenTransaction // Not reported (zero) by protocols whose fees are part of the pool balances (Curve, Balancer)
 	Token1Earned TokenTransaction
+
+	withdrawn0, withdrawn1 *big.Int // Liquidity collected from tokens owed, in pool token order (Uniswap V3 Collect)
 }
 
 type Addition struct {
 	Position
 	OperationBase
-	Send analytics.Sender
+	Send    analytics.Sender
+	TokenID string // Positions manager NFT
+
+	Owner  string // Position owner: NFT owner if known, otherwise Mint owner
+	Sender string // Payer of the added tokens if found in transfers, otherwise Mint sender
+}
+
+// FeeCollection is a Collect of accrued fees without removing any liquidity.
+// Position token amounts are the collected fee amounts.
+type FeeCollection struct {
+	Position
+	OperationBase
+	TokenID string // Positions manager NFT, empty if fees were not collected via positions manager
+
+	Owner string // Position owner: NFT owner if known, otherwise Collect owner
 }
 
 type Swap struct {
@@ -66,6 +109,18 @@ type Swap struct {
 	To   TokenTransaction
 	OperationBase
 	Send analytics.Sender
+
+	ExecutionPrice float64          // Token1 per Token0 (quote per base token) received by the swap
+	PriceBefore    float64          // Pool price before the swap, same denomination as ExecutionPrice
+	PriceAfter     float64          // Pool price after the swap
+	PriceImpactBps float64          // Pool price change in basis points
+	FeeTier        int              // Pool fee in hundredths of a bip, 0 if unknown
+	Fee            TokenTransaction // Fee paid in From token
+
+	Sender    string // Account that called the pool, usually a router
+	Recipient string // Receiver of the swapped tokens
+
+	state swapData // Pool state after the swap, set for concentrated liquidity pools only
 }
 
 func (sw Swap) Save(ts time.Time) error {
@@ -76,28 +131,70 @@ func (sw Swap) Save(ts time.Time) error {
 		TokenFromAmount:   sw.From.Amount,
 		TokenToAddress:    sw.To.Address,
 		TokenToAmount:     sw.To.Amount,
+		ValueUSD:          sw.TotalValue,
+		ExecutionPrice:    sw.ExecutionPrice,
+		PriceBefore:       sw.PriceBefore,
+		PriceAfter:        sw.PriceAfter,
+		PriceImpactBps:    sw.PriceImpactBps,
+		FeeTier:           sw.FeeTier,
+		FeeUSD:            sw.Fee.Amount * sw.Fee.Price,
+		Sender:            sw.Sender,
+		Recipient:         sw.Recipient,
 		TxHash:            sw.TxHash,
 	}
 	return sw.db.SaveSwap(swap)
 }
 
 func (sw *Swap) Process(swap WrappedEventLog) error {
+	switch swap.Instructions.Name {
+	case curveExchangeEvent:
+		return sw.processTokenExchange(swap)
+	case vaultSwapEvent:
+		return sw.processVaultSwap(swap)
+	case v4SwapEvent:
+		return sw.processV4Swap(swap)
+	}
+
 	swapLog := swap.Log
 	token0, token1, err := sw.getTokensByPoolAddress(swapLog.Address)
 	if err != nil {
 		return err
 	}
 
-	hexAmount0, hexAmount1, err := convertLogDataToHexAmounts(swapLog.Data, swap.Instructions.Name)
+	args, err := decodePoolLog(swapEvent, swapLog)
 	if err != nil {
 		return err
 	}
+	data, err := convertSwapLogData(swapLog)
+	if err != nil {
+		return err
+	}
+
+	sw.Position = newPosition(swap, sw.OperationBase.chain)
+	sw.Protocol = sw.poolProtocol(swapLog.Address)
+	sw.Sender, sw.Recipient = args.Address("sender"), args.Address("recipient")
+	sw.Token0 = TokenTransaction{Token: token0, Amount: convertAmount(data.amount0, token0.Decimals)}
+	sw.Token1 = TokenTransaction{Token: token1, Amount: convertAmount(data.amount1, token1.Decimals)}
+
+	sw.state = data
+	sw.calculatePrices(data)
+	if err := sw.settle(token0.Address); err != nil {
+		return err
+	}
+	sw.calculateFee()
 
-	sw.Position = newPosition(swap)
-	sw.Token0 = TokenTransaction{Token: token0, Amount: convertTransferAmount(hexAmount0, token0.Decimals)}
-	sw.Token1 = TokenTransaction{Token: token1, Amount: convertTransferAmount(hexAmount1, token1.Decimals)}
+	return nil
+}
 
+// settle orders swap tokens, prices them and tells the input token from the output token.
+// Token amounts are expected to be pool deltas and prices to be in pool token order.
+func (sw *Swap) settle(poolToken0 string) error {
 	sw.adjustOrder()
+	if !strings.EqualFold(sw.Token0.Address, poolToken0) { // Prices follow token order
+		sw.ExecutionPrice, sw.PriceBefore, sw.PriceAfter = invert(sw.ExecutionPrice), invert(sw.PriceBefore), invert(sw.PriceAfter)
+	}
+	sw.Token0.Price = sw.fetchTokenPrice(sw.Token0.Address)
+	sw.Token1.Price = sw.fetchTokenPrice(sw.Token1.Address)
 
 	if sw.Token0.Amount < 0 && sw.Token1.Amount > 0 {
 		sw.From, sw.To = sw.Token1, sw.Token0
@@ -108,9 +205,55 @@ func (sw *Swap) Process(swap WrappedEventLog) error {
 	}
 	sw.To.Amount = sw.To.Amount * (-1)
 
+	sw.TotalValue = sw.From.Amount * sw.From.Price
+	if sw.TotalValue == 0 {
+		sw.TotalValue = sw.To.Amount * sw.To.Price
+	}
+	sw.Fee = TokenTransaction{Token: sw.From.Token, Price: sw.From.Price} // Amount is calculated if pool fee is known
 	return nil
 }
 
+// calculatePrices calculates execution price and pool prices before and after the swap in pool token order.
+func (sw *Swap) calculatePrices(data swapData) {
+	if sw.Token0.Amount != 0 {
+		sw.ExecutionPrice = math.Abs(sw.Token1.Amount / sw.Token0.Amount)
+	}
+
+	sqrtPriceBefore, found := sw.poolPrices.swap(sw.Address, data.sqrtPriceX96)
+	if !found {
+		sqrtPriceBefore = sqrtPriceBeforeSwap(data)
+	}
+	if sqrtPriceBefore.Sign() <= 0 {
+		return
+	}
+	sw.PriceBefore = convertSqrtPriceX96ToPrice(sqrtPriceBefore, sw.Token0.Decimals, sw.Token1.Decimals)
+	sw.PriceAfter = convertSqrtPriceX96ToPrice(data.sqrtPriceX96, sw.Token0.Decimals, sw.Token1.Decimals)
+	if sw.PriceBefore > 0 {
+		sw.PriceImpactBps = math.Abs(sw.PriceAfter/sw.PriceBefore-1) * 10_000
+	}
+}
+
+// calculateFee calculates fee paid by the swapper. Fee is taken from the input token amount.
+func (sw *Swap) calculateFee() {
+	if sw.fetchers.poolFeeFetcher == nil {
+		return
+	}
+	feeTier, err := sw.fetchers.poolFeeFetcher.Fee(sw.Address)
+	if err != nil {
+		log.Println("failed to fetch pool fee: ", err.Error())
+		return
+	}
+	sw.FeeTier = feeTier
+	sw.Fee.Amount = sw.From.Amount * float64(feeTier) / 1_000_000
+}
+
+func invert(price float64) float64 {
+	if price == 0 {
+		return 0
+	}
+	return 1 / price
+}
+
 func (sw Swap) String() string {
 	format := "Swapping %f of %s to %f of %s."
 	return fmt.Sprintf(format,
@@ -124,19 +267,46 @@ func (sw Swap) CanPublish() bool {
 	if strings.EqualFold(sw.Token0.Address, "") || strings.EqualFold(sw.Token1.Address, "") {
 		return false
 	}
-	if !sw.isAnyTokenOneOf(nativeCoins) && !sw.isAnyTokenOneOf(stableCoins) {
-		return false
-	}
 	return true
 }
 
+func (sw Swap) Facts() expr.Env {
+	facts := sw.Position.Facts()
+	sw.Position.chain.addTokenFacts(facts, "from", sw.From)
+	sw.Position.chain.addTokenFacts(facts, "to", sw.To)
+	facts["priceImpactBps"] = sw.PriceImpactBps
+	facts["feeTier"] = sw.FeeTier
+	facts["feeUSD"] = sw.Fee.Amount * sw.Fee.Price
+	facts["sender"] = sw.Sender
+	facts["recipient"] = sw.Recipient
+	return facts
+}
+
 func (sw Swap) Publish(send analytics.Sender, publishTo string, timestamp time.Time) error {
 	swapMessage := types.SwapMessage{
 		Timestamp: timestamp,
+		ChainID:   sw.OperationBase.chain.ID,
+		Protocol:  sw.Protocol,
 		TxHash:    sw.TxHash,
 		Address:   sw.Address,
-		From:      types.TokenMessage{Address: sw.From.Address, Symbol: sw.From.Symbol, Amount: sw.From.Amount},
-		To:        types.TokenMessage{Address: sw.To.Address, Symbol: sw.To.Symbol, Amount: sw.To.Amount},
+		From:      sw.From.message(),
+		To:        sw.To.message(),
+		ValueUSD:  sw.TotalValue,
+		Price: types.SwapPriceMessage{
+			Base:      sw.Token0.Symbol,
+			Quote:     sw.Token1.Symbol,
+			Execution: sw.ExecutionPrice,
+			Before:    sw.PriceBefore,
+			After:     sw.PriceAfter,
+			ImpactBps: sw.PriceImpactBps,
+		},
+		FeeTier:   sw.FeeTier,
+		Fee:       sw.Fee.message(),
+		FeeUSD:    sw.Fee.Amount * sw.Fee.Price,
+		Sender:    sw.Sender,
+		Recipient: sw.Recipient,
+		JIT:       sw.JIT,
+		FlashLoan: sw.FlashLoan,
 	}
 
 	return send(swapMessage, publishTo, sw.Address)
@@ -146,6 +316,7 @@ func (rem Removal) Save(ts time.Time) error {
 	removal := repository.Removal{
 		TimestampReceived: ts,
 		LPoolAddress:      rem.Address,
+		TokenID:           rem.TokenID,
 		Token0Symbol:      rem.Token0.Symbol,
 		Token1Symbol:      rem.Token1.Symbol,
 		Token0Amount:      rem.Token0.Amount,
@@ -154,6 +325,8 @@ func (rem Removal) Save(ts time.Time) error {
 		UpperRatio:        rem.UpperRatio,
 		Token0PriceUsd:    rem.Token0.Price,
 		Token1PriceUsd:    rem.Token1.Price,
+		Owner:             rem.Owner,
+		Recipient:         rem.Recipient,
 		TxHash:            rem.TxHash,
 	}
 	return rem.db.SaveRemoval(removal)
@@ -163,6 +336,7 @@ func (add Addition) Save(ts time.Time) error {
 	addition := repository.Addition{
 		TimestampReceived: ts,
 		LPoolAddress:      add.Address,
+		TokenID:           add.TokenID,
 		Token0Symbol:      add.Token0.Symbol,
 		Token1Symbol:      add.Token1.Symbol,
 		Token0Amount:      add.Token0.Amount,
@@ -171,56 +345,52 @@ func (add Addition) Save(ts time.Time) error {
 		UpperRatio:        add.UpperRatio,
 		Token0PriceUsd:    add.Token0.Price,
 		Token1PriceUsd:    add.Token1.Price,
+		Owner:             add.Owner,
+		Sender:            add.Sender,
 		TxHash:            add.TxHash,
 	}
 	return add.db.SaveAddition(addition)
 }
 
-func (rem Removal) getCorespondingRemoval(primaryLog WrappedEventLog) (EventLog, error) {
-	removalLogs, err := rem.cache.GetByTxHashAndLogType(primaryLog.Log.TransactionHash, burnEvent)
-	if err != nil {
-		return EventLog{}, err
-	}
-	var requiredLog EventLog
-	for _, renovalLog := range removalLogs {
-		if renovalLog.Address == primaryLog.Log.Address { // Match liquidity pool
-			requiredLog = renovalLog
-			break
-		}
-	}
-	if requiredLog.Address == "" {
-		return EventLog{}, fmt.Errorf("fetched burn event has no liquidity pool.")
-	}
-	return requiredLog, nil
-}
-
 func (rem *Removal) Process(collect WrappedEventLog) error {
-	liqPool := collect.Log.Address
-	collectLog := collect.Log
+	switch collect.Instructions.Name {
+	case curveRemoveLiquidityEvent:
+		return rem.processRemoveLiquidity(collect)
+	case poolBalanceChangedEvent:
+		return rem.processPoolBalanceChanged(collect)
+	case modifyLiquidityEvent:
+		return rem.processModifyLiquidity(collect)
+	}
 
-	burnLog, err := rem.getCorespondingRemoval(collect)
+	collect, tokenID, err := rem.resolveCollect(collect)
 	if err != nil {
 		return err
 	}
+	rem.TokenID = tokenID
+	liqPool := collect.Log.Address
+	collectLog := collect.Log
+	if rem.withdrawn0 == nil || rem.withdrawn1 == nil {
+		return fmt.Errorf("withdrawn liquidity of collect in tx %s is unknown", collectLog.TransactionHash)
+	}
 
 	token0, token1, err := rem.getTokensByPoolAddress(liqPool)
 	if err != nil {
 		return err
 	}
 
-	token0HexAmount, token1HexAmount, err := convertLogDataToHexAmounts(burnLog.Data, burnEvent)
+	collected, err := decodePoolLog(collectEvent, collectLog)
 	if err != nil {
 		return err
 	}
 
-	rem.Position = newPosition(collect)
-	rem.Token0 = TokenTransaction{Token: token0, Amount: convertTransferAmount(token0HexAmount, token0.Decimals)}
-	rem.Token1 = TokenTransaction{Token: token1, Amount: convertTransferAmount(token1HexAmount, token1.Decimals)}
-
-	rem.Token0.Price = rem.fetchTokenPrice(rem.Token0.Address)
-	rem.Token1.Price = rem.fetchTokenPrice(rem.Token1.Address)
+	rem.Position = newPosition(collect, rem.OperationBase.chain)
+	rem.Protocol = rem.poolProtocol(liqPool)
+	rem.Owner = rem.positionOwner(tokenID, collected.Address("owner"))
+	rem.Recipient = collected.Address("recipient")
+	rem.Token0 = TokenTransaction{Token: token0, Amount: convertAmount(rem.withdrawn0, token0.Decimals)}
+	rem.Token1 = TokenTransaction{Token: token1, Amount: convertAmount(rem.withdrawn1, token1.Decimals)}
 
-	rem.Position.calculate()
+	rem.valueLiquidity(&rem.Position, false)
 
 	err = rem.calculateFeesEarned(collectLog, token0.Address, token1.Address)
 	if err != nil {
@@ -229,13 +399,37 @@ func (rem *Removal) Process(collect WrappedEventLog) error {
 	return nil
 }
 
-func (add *Addition) Process(mint WrappedEventLog) error {
-	mintLog := mint.Log
-	if !isUniswapPositionsNFT(mintLog.Data) {
-		return fmt.Errorf("not Uniswap Positions NFT.\n")
+// Process handles positions manager IncreaseLiquidity event together with pool Mint that precedes it.
+func (add *Addition) Process(increase WrappedEventLog) error {
+	switch increase.Instructions.Name {
+	case curveAddLiquidityEvent:
+		return add.processAddLiquidity(increase)
+	case poolBalanceChangedEvent:
+		return add.processPoolBalanceChanged(increase)
+	case modifyLiquidityEvent:
+		return add.processModifyLiquidity(increase)
 	}
 
-	add.Position = newPosition(mint)
+	mintLog, found := findPoolLogOfPosition(add.cache, increase.Log, mintEvent)
+	if !found {
+		return fmt.Errorf("could not find mint event of position in tx %s", increase.Log.TransactionHash)
+	}
+	mint := WrappedEventLog{Log: mintLog, Instructions: EventInstruction{Name: mintEvent}}
+	mintArgs, err := decodePoolLog(mintEvent, mintLog)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(mintArgs.Address("sender"), increase.Log.Address) {
+		return fmt.Errorf("mint was not made by positions manager %s", increase.Log.Address)
+	}
+
+	add.Position = newPosition(mint, add.OperationBase.chain)
+	add.Protocol = add.protocol // Positions manager tells the protocol of a new pool
+	increaseArgs, err := decodePositionsManagerLog(increaseLiquidityEvent, increase.Log)
+	if err != nil {
+		return err
+	}
+	add.TokenID = add.OperationBase.chain.positionTokenID(increase.Log.Address, increaseArgs.BigInt("tokenId"))
 
 	transferLogs, err := add.cache.GetByTxHashAndLogType(mintLog.TransactionHash, transferEvent)
 	if err != nil {
@@ -244,24 +438,32 @@ func (add *Addition) Process(mint WrappedEventLog) error {
 	for _, transferLog := range transferLogs { // Go through all transfers of this transaction
 		add.handleLiquidityTransfer(mintLog, transferLog)
 	}
+	add.Owner = add.positionOwner(add.TokenID, mintArgs.Address("owner"))
+	add.Sender = findPayer(mintLog, transferLogs)
 
 	if !add.Position.areTokensSet() {
 		add.Position.checkAndUpdateMissingToken(mintLog, add.OperationBase) // 5) Adding missing token if only 1 token transfer was made
 	}
 
-	err = add.savePool(add.Position)
-	if err != nil {
-		log.Println("error while adding new pool to database:", err.Error())
-	}
-
-	add.Token0.Price = add.fetchTokenPrice(add.Token0.Address)
-	add.Token1.Price = add.fetchTokenPrice(add.Token1.Address)
-	add.Position.calculate() // 7) Save Liquidity Entry and Liquidity Pool
+	add.valueLiquidity(&add.Position, true) // 7) Save Liquidity Entry and Liquidity Pool
 
 	return nil
 }
 
-func (add Addition) savePool(addPos Position) error {
+// valueLiquidity prices tokens of the liquidity change and calculates its value. Pool of added liquidity is saved first
+// if both its tokens are known.
+func (ob OperationBase) valueLiquidity(pos *Position, savePool bool) {
+	if savePool {
+		if err := ob.savePool(*pos); err != nil {
+			log.Println("error while adding new pool to database:", err.Error())
+		}
+	}
+	pos.Token0.Price = ob.fetchTokenPrice(pos.Token0.Address)
+	pos.Token1.Price = ob.fetchTokenPrice(pos.Token1.Address)
+	pos.calculate()
+}
+
+func (ob OperationBase) savePool(addPos Position) error {
 	if addPos.isEitherTokenAmountZero() || !addPos.areTokensSet() || (addPos.Token0.Address == addPos.Token1.Address) {
 		return nil
 	}
@@ -270,7 +472,23 @@ func (add Addition) savePool(addPos Position) error {
 	newLiqPoll.Address = addPos.Address
 	newLiqPoll.Token0Address = addPos.Token0.Address
 	newLiqPoll.Token1Address = addPos.Token1.Address
-	return add.db.SavePool(newLiqPoll)
+	newLiqPoll.Protocol = addPos.Protocol
+	return ob.db.SavePool(newLiqPoll)
+}
+
+func (add Addition) Facts() expr.Env {
+	facts := add.Position.Facts()
+	facts["owner"] = add.Owner
+	facts["sender"] = add.Sender
+	return facts
+}
+
+func (rem Removal) Facts() expr.Env {
+	facts := rem.Position.Facts()
+	facts["owner"] = rem.Owner
+	facts["recipient"] = rem.Recipient
+	facts["earnedUSD"] = rem.Token0Earned.Amount*rem.Token0.Price + rem.Token1Earned.Amount*rem.Token1.Price
+	return facts
 }
 
 func (rem Removal) String() string {
@@ -308,21 +526,28 @@ func (add Addition) String() string {
 func (rem Removal) Publish(send analytics.Sender, publishTo string, timestamp time.Time) error {
 	removalMessage := types.RemovalMessage{
 		Timestamp:         timestamp,
+		ChainID:           rem.OperationBase.chain.ID,
+		Protocol:          rem.Protocol,
 		Address:           rem.Address,
+		TokenID:           rem.TokenID,
 		LowerTokenRatio:   rem.LowerRatio,
 		CurrentTokenRatio: rem.CurrentRatio,
 		UpperTokenRatio:   rem.UpperRatio,
 		ValueRemovedUSD:   rem.TotalValue,
 		ValueEarnedUSD:    rem.Token0.Price*rem.Token0Earned.Amount + rem.Token1.Price*rem.Token1Earned.Amount,
 		Pair: [2]types.TokenMessage{
-			{Address: rem.Token0.Address, Symbol: rem.Token0.Symbol, Amount: rem.Token0.Amount, Price: rem.Token0.Price},
-			{Address: rem.Token1.Address, Symbol: rem.Token1.Symbol, Amount: rem.Token1.Amount, Price: rem.Token1.Price},
+			rem.Token0.message(),
+			rem.Token1.message(),
 		},
 		Earned: [2]types.TokenMessage{
 			{Symbol: rem.Token0.Symbol, Amount: rem.Token0Earned.Amount},
 			{Symbol: rem.Token1.Symbol, Amount: rem.Token1Earned.Amount},
 		},
-		TxHash: rem.TxHash,
+		Owner:     rem.Owner,
+		Recipient: rem.Recipient,
+		TxHash:    rem.TxHash,
+		JIT:       rem.JIT,
+		FlashLoan: rem.FlashLoan,
 	}
 
 	return send(removalMessage, publishTo, rem.Address)
@@ -331,16 +556,23 @@ func (rem Removal) Publish(send analytics.Sender, publishTo string, timestamp ti
 func (add Addition) Publish(send analytics.Sender, publishTo string, timestamp time.Time) error {
 	additionMessage := types.AdditionMessage{
 		Timestamp:         timestamp,
+		ChainID:           add.OperationBase.chain.ID,
+		Protocol:          add.Protocol,
 		Address:           add.Address,
+		TokenID:           add.TokenID,
 		LowerTokenRatio:   add.LowerRatio,
 		CurrentTokenRatio: add.CurrentRatio,
 		UpperTokenRatio:   add.UpperRatio,
 		ValueAddedUSD:     add.TotalValue,
 		Pair: [2]types.TokenMessage{
-			{Address: add.Token0.Address, Symbol: add.Token0.Symbol, Amount: add.Token0.Amount, Price: add.Token0.Price},
-			{Address: add.Token1.Address, Symbol: add.Token1.Symbol, Amount: add.Token1.Amount, Price: add.Token1.Price},
+			add.Token0.message(),
+			add.Token1.message(),
 		},
-		TxHash: add.TxHash,
+		Owner:     add.Owner,
+		Sender:    add.Sender,
+		TxHash:    add.TxHash,
+		JIT:       add.JIT,
+		FlashLoan: add.FlashLoan,
 	}
 
 	return send(additionMessage, publishTo, add.Address)
@@ -350,11 +582,12 @@ func (add Addition) Publish(send analytics.Sender, publishTo string, timestamp t
 // Getting token that was transferred and calculating amount transferred.
 // Keeping track of tokens involved in current Liq. Add. event.
 func (add *Addition) handleLiquidityTransfer(mint EventLog, transfer EventLog) {
-	token0HexAmount, token1HexAmount, err := convertLogDataToHexAmounts(mint.Data, mintEvent)
+	args, err := decodePoolLog(mintEvent, mint)
 	if err != nil {
 		log.Println("Could not split mint event into Amount fields: ", err.Error())
 		return
 	}
+	amount0, amount1 := args.BigInt("amount0"), args.BigInt("amount1")
 
 	t, err := add.lookupToken(transfer.Address)
 	if err != nil {
@@ -362,33 +595,124 @@ func (add *Addition) handleLiquidityTransfer(mint EventLog, transfer EventLog) {
 		return
 	}
 
-	if "0x"+convertHexToBigInt(transfer.Data).Text(16) == token0HexAmount && !strings.EqualFold(transfer.Address, add.Token1.Token.Address) {
+	transferred := convertHexToBigInt(transfer.Data)
+	if transferred.Cmp(amount0) == 0 && !strings.EqualFold(transfer.Address, add.Token1.Token.Address) {
 		add.Token0.Token = t
-		add.Token0.Amount = convertTransferAmount(token0HexAmount, t.Decimals)
+		add.Token0.Amount = convertAmount(amount0, t.Decimals)
 	}
 
-	if "0x"+convertHexToBigInt(transfer.Data).Text(16) == token1HexAmount && !strings.EqualFold(transfer.Address, add.Token0.Token.Address) {
+	if transferred.Cmp(amount1) == 0 && !strings.EqualFold(transfer.Address, add.Token0.Token.Address) {
 		add.Token1.Token = t
-		add.Token1.Amount = convertTransferAmount(token1HexAmount, t.Decimals)
+		add.Token1.Amount = convertAmount(amount1, t.Decimals)
 	}
 }
 
 func (rem *Removal) calculateFeesEarned(collectLog EventLog, poolOrderToken0 string, poolOrderToken1 string) error {
-	token0HexAmount, token1HexAmount, err := convertLogDataToHexAmounts(collectLog.Data, collectEvent) // Token order original as in liquidity pool
+	collected0, collected1, err := collectedAmounts(collectLog, rem.Token0, rem.Token1, poolOrderToken0, poolOrderToken1)
+	if err != nil {
+		return err
+	}
+
+	rem.Token0Earned, rem.Token1Earned = collected0, collected1
+	rem.Token0Earned.Amount -= rem.Token0.Amount // Collect contains both removed liquidity and fees
+	rem.Token1Earned.Amount -= rem.Token1.Amount
+
+	return nil
+}
+
+// collectedAmounts decodes amounts of Collect event into given tokens.
+// Collect amounts are in pool token order, while tokens might have been switched during processing.
+func collectedAmounts(collectLog EventLog, token0, token1 TokenTransaction, poolOrderToken0, poolOrderToken1 string) (TokenTransaction, TokenTransaction, error) {
+	args, err := decodePoolLog(collectEvent, collectLog)
+	if err != nil {
+		return TokenTransaction{}, TokenTransaction{}, err
+	}
+	amount0, amount1 := args.BigInt("amount0"), args.BigInt("amount1") // Token order original as in liquidity pool
+
+	if strings.EqualFold(token0.Address, poolOrderToken1) && strings.EqualFold(token1.Address, poolOrderToken0) {
+		amount0, amount1 = amount1, amount0
+	}
+
+	token0.Amount = convertAmount(amount0, token0.Decimals)
+	token1.Amount = convertAmount(amount1, token1.Decimals)
+	return token0, token1, nil
+}
+
+// Process handles Collect event that takes no withdrawn liquidity - position owner harvests accrued fees only.
+func (fc *FeeCollection) Process(collect WrappedEventLog) error {
+	collect, tokenID, err := fc.resolveCollect(collect)
 	if err != nil {
 		return err
 	}
+	fc.TokenID = tokenID
+	collectArgs, err := decodePoolLog(collectEvent, collect.Log)
+	if err != nil {
+		return err
+	}
+	fc.Owner = fc.positionOwner(tokenID, collectArgs.Address("owner"))
 
-	rem.Token0Earned, rem.Token1Earned = rem.Token0, rem.Token1
+	token0, token1, err := fc.getTokensByPoolAddress(collect.Log.Address)
+	if err != nil {
+		return err
+	}
 
-	if strings.EqualFold(rem.Token0.Address, poolOrderToken1) && strings.EqualFold(rem.Token1.Address, poolOrderToken0) {
-		rem.Token0Earned, rem.Token1Earned = rem.Token1Earned, rem.Token0Earned // Removed tokens were switched during processing - switch earned tokens as well
-		token0HexAmount, token1HexAmount = token1HexAmount, token0HexAmount
+	fc.Position = newPosition(collect, fc.OperationBase.chain)
+	fc.Protocol = fc.poolProtocol(collect.Log.Address)
+	fc.Token0 = TokenTransaction{Token: token0}
+	fc.Token1 = TokenTransaction{Token: token1}
+	fc.Token0, fc.Token1, err = collectedAmounts(collect.Log, fc.Token0, fc.Token1, token0.Address, token1.Address)
+	if err != nil {
+		return err
 	}
 
-	rem.Token0Earned.Amount = convertTransferAmount(token0HexAmount, rem.Token0.Decimals) - rem.Token0.Amount
-	rem.Token1Earned.Amount = convertTransferAmount(token1HexAmount, rem.Token1.Decimals) - rem.Token1.Amount
+	fc.Token0.Price = fc.fetchTokenPrice(fc.Token0.Address)
+	fc.Token1.Price = fc.fetchTokenPrice(fc.Token1.Address)
 
+	fc.Position.calculate()
+	return nil
+}
+
+func (fc FeeCollection) String() string {
+	format := "Collecting fees %f of %s and %f of %s ($%f) from %s"
+	return fmt.Sprintf(format,
+		fc.Token0.Amount,
+		fc.Token0.Symbol,
+		fc.Token1.Amount,
+		fc.Token1.Symbol,
+		fc.TotalValue,
+		fc.Address)
+}
+
+func (fc FeeCollection) Publish(send analytics.Sender, publishTo string, timestamp time.Time) error {
+	feeMessage := types.FeeCollectionMessage{
+		Timestamp:         timestamp,
+		ChainID:           fc.OperationBase.chain.ID,
+		Protocol:          fc.Protocol,
+		Address:           fc.Address,
+		TokenID:           fc.TokenID,
+		LowerTokenRatio:   fc.LowerRatio,
+		CurrentTokenRatio: fc.CurrentRatio,
+		UpperTokenRatio:   fc.UpperRatio,
+		ValueCollectedUSD: fc.TotalValue,
+		Fees: [2]types.TokenMessage{
+			fc.Token0.message(),
+			fc.Token1.message(),
+		},
+		Owner:  fc.Owner,
+		TxHash: fc.TxHash,
+	}
+
+	return send(feeMessage, publishTo, fc.Address)
+}
+
+func (fc FeeCollection) Facts() expr.Env {
+	facts := fc.Position.Facts()
+	facts["owner"] = fc.Owner
+	return facts
+}
+
+// Save does nothing: fee collections are only published, and the ones of position NFTs are accounted in position ledgers.
+func (fc FeeCollection) Save(time.Time) error {
 	return nil
 }
 
@@ -408,6 +732,56 @@ func (ob OperationBase) getTokensByPoolAddress(liqPoolAddress string) (repositor
 	return token0, token1, nil
 }
 
+// resolveCollect returns pool Collect event and position NFT token ID when Collect was made via positions manager.
+func (ob OperationBase) resolveCollect(collect WrappedEventLog) (WrappedEventLog, string, error) {
+	if collect.Instructions.Name != positionCollectEvent {
+		return collect, "", nil
+	}
+	poolCollectLog, found := findPoolLogOfPosition(ob.cache, collect.Log, collectEvent)
+	if !found {
+		return WrappedEventLog{}, "", fmt.Errorf("could not find pool collect event of position in tx %s", collect.Log.TransactionHash)
+	}
+	args, err := decodePositionsManagerLog(collectEvent, collect.Log)
+	if err != nil {
+		return WrappedEventLog{}, "", err
+	}
+	poolCollect := WrappedEventLog{Log: poolCollectLog, Instructions: EventInstruction{Name: collectEvent}}
+	return poolCollect, ob.chain.positionTokenID(collect.Log.Address, args.BigInt("tokenId")), nil
+}
+
+// poolProtocol returns protocol of the pool recorded when liquidity was added to it, or protocol of the handled event otherwise.
+// Pools of Uniswap V3 forks emit the same events, so the event alone does not tell the protocol.
+func (ob OperationBase) poolProtocol(poolAddress string) string {
+	if protocol, found := ob.db.GetPoolProtocol(poolAddress); found {
+		return protocol
+	}
+	return ob.protocol
+}
+
+// positionOwner returns owner of the position NFT, if it is tracked, or the owner from pool event otherwise.
+func (ob OperationBase) positionOwner(tokenID string, poolEventOwner string) string {
+	if tokenID != "" {
+		if pos, found := ob.db.GetPosition(tokenID); found && pos.Owner != "" {
+			return pos.Owner
+		}
+	}
+	return poolEventOwner
+}
+
+// findPayer returns sender of token transfers into the pool of the Mint, or the Mint sender if there are none.
+func findPayer(mintLog EventLog, transferLogs []EventLog) string {
+	for _, transferLog := range transferLogs {
+		if args, err := decodeTokenLog(transferEvent, transferLog); err == nil && strings.EqualFold(args.Address("to"), mintLog.Address) {
+			return args.Address("from")
+		}
+	}
+	mintArgs, err := decodePoolLog(mintEvent, mintLog)
+	if err != nil {
+		return ""
+	}
+	return mintArgs.Address("sender")
+}
+
 func (ob OperationBase) fetchTokenPrice(tokAddress string) float64 {
 	// Place here to implement price cache?
 	if strings.EqualFold(tokAddress, "") {
@@ -435,8 +809,8 @@ func (pos *Position) calculateRatios() {
 	lowerRatio := convertTickToRatio(pos.LowerTick, pos.Token0.Decimals, pos.Token1.Decimals)
 	upperRatio := convertTickToRatio(pos.UpperTick, pos.Token0.Decimals, pos.Token1.Decimals)
 
-	if (pos.isAnyTokenOneOf(stableCoins) && !pos.isToken1OneOf(stableCoins)) || // Stable (USDC, USDT) to always be quote token (second)
-		(!pos.isAnyTokenOneOf(stableCoins) && pos.isAnyTokenOneOf(nativeCoins) && !pos.isToken1OneOf(nativeCoins)) { // If there is no stable token involved - WETH will always be quoto token
+	if (pos.isAnyTokenOneOf(pos.chain.Stable) && !pos.isToken1OneOf(pos.chain.Stable)) || // Stable (USDC, USDT) to always be quote token (second)
+		(!pos.isAnyTokenOneOf(pos.chain.Stable) && pos.isAnyTokenOneOf(pos.chain.Native) && !pos.isToken1OneOf(pos.chain.Native)) { // If there is no stable token involved - WETH will always be quoto token
 		lowerRatio = 1 / lowerRatio
 		upperRatio = 1 / upperRatio
 	}
@@ -451,7 +825,9 @@ func (pos *Position) calculate() {
 		return
 	}
 
-	pos.calculateRatios()
+	if !pos.FullRange {
+		pos.calculateRatios()
+	}
 	pos.adjustOrder()
 
 	if pos.Token0.Price > 0 && pos.Token1.Price > 0 {
@@ -461,8 +837,8 @@ func (pos *Position) calculate() {
 }
 
 func (pos *Position) adjustOrder() {
-	if (pos.isAnyTokenOneOf(nativeCoins) && !pos.isAnyTokenOneOf(stableCoins) && !pos.isToken1OneOf(nativeCoins)) ||
-		(pos.isAnyTokenOneOf(stableCoins) && !pos.isToken1OneOf(stableCoins)) {
+	if (pos.isAnyTokenOneOf(pos.chain.Native) && !pos.isAnyTokenOneOf(pos.chain.Stable) && !pos.isToken1OneOf(pos.chain.Native)) ||
+		(pos.isAnyTokenOneOf(pos.chain.Stable) && !pos.isToken1OneOf(pos.chain.Stable)) {
 		pos.Token1, pos.Token0 = pos.Token0, pos.Token1
 	}
 }
@@ -502,7 +878,7 @@ func (p Position) CanPublish() bool {
 		log.Printf("SKIP - token symbol unknown. Tx: %s\n\n", p.TxHash)
 		return false
 	}
-	if p.LowerRatio == 0 && p.UpperRatio == 0 {
+	if !p.FullRange && p.LowerRatio == 0 && p.UpperRatio == 0 {
 		log.Printf("SKIP - actual ratio not calculated. Tx: %s\n\n", p.TxHash)
 		return false
 	}
@@ -510,17 +886,42 @@ func (p Position) CanPublish() bool {
 		log.Printf("SKIP - no tokens moved. Tx: %s\n\n", p.TxHash)
 		return false
 	}
-	if p.Token0.Price == 0.0 || p.Token1.Price == 0.0 {
-		log.Printf("SKIP - missing price (could not calculate current ratio). Tx: %s\n\n", p.TxHash)
-		return false
-	}
-	if !p.isAnyTokenOneOf(nativeCoins) && !p.isAnyTokenOneOf(stableCoins) {
-		log.Printf("SKIP - no stable or native currency involved. Tx: %s\n\n", p.TxHash)
-		return false
-	}
 	return true
 }
 
+// Facts describes position for publish filter rules.
+func (p Position) Facts() expr.Env {
+	facts := expr.Env{
+		"pool":           strings.ToLower(p.Address),
+		"txHash":         p.TxHash,
+		"valueUSD":       p.TotalValue,
+		"lowerTick":      p.LowerTick,
+		"upperTick":      p.UpperTick,
+		"tickRangeWidth": p.UpperTick - p.LowerTick,
+		"lowerRatio":     p.LowerRatio,
+		"currentRatio":   p.CurrentRatio,
+		"upperRatio":     p.UpperRatio,
+		"jit":            p.JIT,
+		"flashLoan":      p.FlashLoan,
+		"protocol":       p.Protocol,
+	}
+	p.chain.addTokenFacts(facts, "token0", p.Token0)
+	p.chain.addTokenFacts(facts, "token1", p.Token1)
+	return facts
+}
+
+func (c Chain) addTokenFacts(facts expr.Env, prefix string, t TokenTransaction) {
+	facts[prefix+".address"] = strings.ToLower(t.Address)
+	facts[prefix+".symbol"] = t.Symbol
+	facts[prefix+".amount"] = t.Amount
+	facts[prefix+".priceUSD"] = t.Price
+	facts[prefix+".valueUSD"] = t.Amount * t.Price
+	facts[prefix+".native"] = c.isNative(t.Address)
+	facts[prefix+".stable"] = c.isStable(t.Address)
+	facts[prefix+".flags"] = t.Flags
+	facts[prefix+".flagged"] = t.Flags != ""
+}
+
 func (p Position) areTokensSet() bool {
 	return (!strings.EqualFold(p.Token0.Address, "") && !strings.EqualFold(p.Token1.Address, ""))
 }
@@ -530,28 +931,31 @@ func (p Position) isEitherTokenAmountZero() bool {
 }
 
 func (p Position) isToken1OneOf(tokens []string) bool {
-	return slices.Contains(tokens, strings.ToLower(p.Token1.Address))
+	return containsAddress(tokens, p.Token1.Address)
 }
 
 func (p Position) isToken0OneOf(tokens []string) bool {
-	return slices.Contains(tokens, strings.ToLower(p.Token0.Address))
+	return containsAddress(tokens, p.Token0.Address)
 }
 
 func (p Position) isAnyTokenOneOf(tokens []string) bool {
 	return p.isToken0OneOf(tokens) || p.isToken1OneOf(tokens)
 }
 
-func newPosition(wlog WrappedEventLog) Position {
+func newPosition(wlog WrappedEventLog, chain Chain) Position {
 	log := wlog.Log
 
 	newPos := Position{
 		Address: log.Address,
 		TxHash:  log.TransactionHash,
+		chain:   chain,
 	}
 
 	if wlog.Instructions.Name == mintEvent || wlog.Instructions.Name == collectEvent {
-		newPos.LowerTick = int(convertHexToBigInt(log.Topics[2]).Int64())
-		newPos.UpperTick = int(convertHexToBigInt(log.Topics[3]).Int64())
+		if args, err := decodePoolLog(wlog.Instructions.Name, log); err == nil {
+			newPos.LowerTick = args.Int("tickLower")
+			newPos.UpperTick = args.Int("tickUpper")
+		}
 	}
 
 	return newPos
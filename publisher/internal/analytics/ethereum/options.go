@@ -1,8 +1,11 @@
 package ethereum
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/Synternet/swapscope/publisher/internal/alert"
+	"github.com/Synternet/swapscope/publisher/internal/expr"
 	"github.com/Synternet/swapscope/publisher/pkg/repository"
 )
 
@@ -17,14 +20,50 @@ type (
 		Token(tokenAddress string) (repository.Token, error)
 	}
 
+	PoolFeeFetcher interface {
+		// Fee returns pool fee tier in hundredths of a bip, e.g. 3000 = 0.3%
+		Fee(poolAddress string) (int, error)
+	}
+
+	PublishFilter interface {
+		// Allow reports whether operation described by facts should be published
+		Allow(facts expr.Env) bool
+	}
+
+	AlertEngine interface {
+		// Evaluate returns alerts fired by operation described by facts
+		Evaluate(facts expr.Env, timestamp time.Time) []alert.Alert
+	}
+
 	Options struct {
 		eventLogCacheExpirationTime time.Duration
 		eventLogCachePurgeTime      time.Duration
 		priceFetcher                PriceFetcher
 		tokenFetcher                TokenFetcher
+		poolFeeFetcher              PoolFeeFetcher
+		publishFilter               PublishFilter
+		alerts                      AlertEngine
+		chain                       Chain
+		candleIntervals             []time.Duration
+		statsInterval               time.Duration
+		depthInterval               time.Duration
+		leaderboardInterval         time.Duration
+		leaderboardSize             int
+		rebalanceWindow             uint64
+		protocols                   []string
 	}
 )
 
+func (o *Options) SetDefaults() {
+	o.chain = Ethereum
+	o.candleIntervals = defaultCandleIntervals
+	o.statsInterval = time.Minute
+	o.depthInterval = 5 * time.Minute
+	o.leaderboardInterval = 5 * time.Minute
+	o.leaderboardSize = defaultLeaderboardSize
+	o.rebalanceWindow = defaultRebalanceWindow
+}
+
 func (o *Options) ParseOptions(opts ...Option) error {
 	for _, opt := range opts {
 		if err := opt(o); err != nil {
@@ -55,3 +94,109 @@ func WithTokenFetcher(fetcher TokenFetcher) Option {
 		return nil
 	}
 }
+
+// WithPoolFeeFetcher enables swap fee calculation. Swap fees are not calculated if fetcher is not set.
+func WithPoolFeeFetcher(fetcher PoolFeeFetcher) Option {
+	return func(o *Options) error {
+		o.poolFeeFetcher = fetcher
+		return nil
+	}
+}
+
+// WithChain selects the chain whose event log stream is processed.
+func WithChain(chain Chain) Option {
+	return func(o *Options) error {
+		if chain.Subject == "" {
+			return fmt.Errorf("chain %s must have an input subject", chain.Name)
+		}
+		o.chain = chain
+		return nil
+	}
+}
+
+func WithPublishFilter(f PublishFilter) Option {
+	return func(o *Options) error {
+		o.publishFilter = f
+		return nil
+	}
+}
+
+// WithCandleIntervals sets intervals of swap OHLCV candles. No candles are built if none are given.
+func WithCandleIntervals(intervals ...time.Duration) Option {
+	return func(o *Options) error {
+		for _, interval := range intervals {
+			if interval < time.Second {
+				return fmt.Errorf("candle interval %s is shorter than a second", interval)
+			}
+		}
+		o.candleIntervals = intervals
+		return nil
+	}
+}
+
+// WithStatsInterval sets how often rolling pool stats snapshots are published.
+func WithStatsInterval(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval <= 0 {
+			return fmt.Errorf("stats interval must be positive")
+		}
+		o.statsInterval = interval
+		return nil
+	}
+}
+
+// WithDepthInterval sets how often liquidity depth snapshots of changed pools are published.
+func WithDepthInterval(interval time.Duration) Option {
+	return func(o *Options) error {
+		if interval <= 0 {
+			return fmt.Errorf("depth interval must be positive")
+		}
+		o.depthInterval = interval
+		return nil
+	}
+}
+
+// WithLeaderboard sets how often wallet leaderboards are published and how many top wallets they contain.
+func WithLeaderboard(interval time.Duration, size int) Option {
+	return func(o *Options) error {
+		if interval <= 0 {
+			return fmt.Errorf("leaderboard interval must be positive")
+		}
+		if size <= 0 {
+			return fmt.Errorf("leaderboard size must be positive")
+		}
+		o.leaderboardInterval = interval
+		o.leaderboardSize = size
+		return nil
+	}
+}
+
+// WithRebalanceWindow sets how many blocks after a removal an addition of the same owner and pool is a rebalance.
+func WithRebalanceWindow(blocks uint64) Option {
+	return func(o *Options) error {
+		o.rebalanceWindow = blocks
+		return nil
+	}
+}
+
+// WithProtocols selects protocols whose events are processed, e.g. uniswap-v3, curve.
+// All protocols deployed on the chain are processed if none are given.
+func WithProtocols(protocols ...string) Option {
+	return func(o *Options) error {
+		for _, protocol := range protocols {
+			if !isKnownProtocol(protocol) {
+				return fmt.Errorf("unknown protocol %q", protocol)
+			}
+		}
+		o.protocols = protocols
+		return nil
+	}
+}
+
+// WithAlertEngine sets alerting rules evaluated against processed operations.
+func WithAlertEngine(e AlertEngine) Option {
+	return func(o *Options) error {
+		o.alerts = e
+		return nil
+	}
+}
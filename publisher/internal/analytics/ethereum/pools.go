@@ -0,0 +1,38 @@
+package ethereum
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// poolPriceCache remembers pool sqrt price after the last processed swap.
+// Price of the pool changes only with swaps, so it is the price before the next swap of the pool.
+type poolPriceCache struct {
+	mu     sync.Mutex
+	prices map[string]*big.Int
+}
+
+func newPoolPriceCache() *poolPriceCache {
+	return &poolPriceCache{prices: make(map[string]*big.Int)}
+}
+
+// swap stores price of the pool after the swap and returns price before it, if known.
+func (c *poolPriceCache) swap(poolAddress string, sqrtPriceX96 *big.Int) (*big.Int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	poolAddress = strings.ToLower(poolAddress)
+	before, found := c.prices[poolAddress]
+	c.prices[poolAddress] = sqrtPriceX96
+	return before, found
+}
+
+// price returns current sqrt price of the pool, if known.
+func (c *poolPriceCache) price(poolAddress string) (*big.Int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sqrtPriceX96, found := c.prices[strings.ToLower(poolAddress)]
+	return sqrtPriceX96, found
+}
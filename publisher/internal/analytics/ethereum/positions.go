@@ -0,0 +1,240 @@
+package ethereum
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+)
+
+// positionTracker maintains positions manager NFTs (keyed by tokenId) from its
+// IncreaseLiquidity, DecreaseLiquidity, Collect and Transfer events, Uniswap V4 PositionManager NFTs from
+// their Transfer and PoolManager ModifyLiquidity events, and tokens owed to positions owned
+// directly in pools (keyed by pool, owner and tick range) from pool Burn and Collect events.
+//
+// Withdrawn liquidity stays owed by the pool until it is collected, often in a later transaction,
+// and it is collected before accrued fees. So collected amounts up to the tokens owed are withdrawn liquidity,
+// the rest are fees.
+type positionTracker struct {
+	db                 Database
+	cache              Cache
+	ranges             *rangeMonitor
+	chain              Chain
+	isPositionsManager func(address string) bool // Pool positions of positions managers are tracked by NFT
+}
+
+// Update applies positions manager event to the tracked position. Other events are ignored.
+func (pt positionTracker) Update(wel WrappedEventLog) error {
+	switch wel.Instructions.Name {
+	case positionTransferEvent:
+		return pt.transfer(wel.Log)
+	case increaseLiquidityEvent:
+		return pt.changeLiquidity(wel.Log, increaseLiquidityEvent, mintEvent)
+	case decreaseLiquidityEvent:
+		return pt.changeLiquidity(wel.Log, decreaseLiquidityEvent, burnEvent)
+	case positionCollectEvent:
+		return pt.collect(wel.Log)
+	case burnEvent:
+		return pt.burnDirect(wel.Log)
+	case collectEvent:
+		return pt.collectDirect(wel.Log)
+	case modifyLiquidityEvent:
+		return pt.modifyLiquidity(wel.Log)
+	}
+	return nil
+}
+
+// transfer updates owner of the position. Mint of position NFT is a transfer from zero address.
+func (pt positionTracker) transfer(transferLog EventLog) error {
+	args, err := decodePositionsManagerLog(transferEvent, transferLog)
+	if err != nil {
+		return err
+	}
+	pos := pt.position(pt.chain.positionTokenID(transferLog.Address, args.BigInt("tokenId")))
+	pos.Owner = args.Address("to")
+	return pt.save(pos)
+}
+
+// changeLiquidity adds or subtracts liquidity of the position.
+// Pool and ticks are taken from the corresponding pool Mint or Burn when position is seen for the first time.
+func (pt positionTracker) changeLiquidity(positionLog EventLog, eventName string, poolLogType string) error {
+	args, err := decodePositionsManagerLog(eventName, positionLog)
+	if err != nil {
+		return err
+	}
+	pos := pt.position(pt.chain.positionTokenID(positionLog.Address, args.BigInt("tokenId")))
+
+	if pos.LPoolAddress == "" {
+		poolLog, found := findPoolLogOfPosition(pt.cache, positionLog, poolLogType)
+		if !found {
+			return fmt.Errorf("could not find %s event of position %s in tx %s", poolLogType, pos.TokenID, positionLog.TransactionHash)
+		}
+		poolArgs, err := decodePoolLog(poolLogType, poolLog)
+		if err != nil {
+			return err
+		}
+		pos.LPoolAddress = poolLog.Address
+		pos.LowerTick = poolArgs.Int("tickLower")
+		pos.UpperTick = poolArgs.Int("tickUpper")
+	}
+
+	change := args.BigInt("liquidity")
+	if eventName == decreaseLiquidityEvent {
+		change = new(big.Int).Neg(change)
+	}
+
+	liquidity := new(big.Int).Add(parseBigInt(pos.Liquidity), change)
+	if liquidity.Sign() < 0 { // Position was opened before tracking started
+		liquidity.SetInt64(0)
+	}
+	pos.Liquidity = liquidity.String()
+	if eventName == decreaseLiquidityEvent {
+		pos.Token0Owed = new(big.Int).Add(parseBigInt(pos.Token0Owed), args.BigInt("amount0")).String()
+		pos.Token1Owed = new(big.Int).Add(parseBigInt(pos.Token1Owed), args.BigInt("amount1")).String()
+	}
+
+	return pt.save(pos)
+}
+
+// modifyLiquidity adds or subtracts liquidity of Uniswap V4 PositionManager NFT. PositionManager salts its
+// PoolManager positions with the NFT tokenId. Liquidity of other callers is not tracked.
+func (pt positionTracker) modifyLiquidity(modifyLog EventLog) error {
+	args, err := decodePoolManagerLog(modifyLiquidityEvent, modifyLog)
+	if err != nil {
+		return err
+	}
+	tokenID, found := pt.chain.v4PositionTokenID(args)
+	if !found {
+		return nil
+	}
+	pos := pt.position(tokenID)
+	pos.LPoolAddress = convertTopicToPoolID(modifyLog.Topics[1])
+	pos.LowerTick, pos.UpperTick = args.Int("tickLower"), args.Int("tickUpper")
+
+	liquidity := new(big.Int).Add(parseBigInt(pos.Liquidity), args.BigInt("liquidityDelta"))
+	if liquidity.Sign() < 0 { // Position was opened before tracking started
+		liquidity.SetInt64(0)
+	}
+	pos.Liquidity = liquidity.String()
+	return pt.save(pos)
+}
+
+// collect accumulates amounts (withdrawn liquidity and fees) collected from the position.
+func (pt positionTracker) collect(collectLog EventLog) error {
+	args, err := decodePositionsManagerLog(collectEvent, collectLog)
+	if err != nil {
+		return err
+	}
+	pos := pt.position(pt.chain.positionTokenID(collectLog.Address, args.BigInt("tokenId")))
+	pos.Token0Collected = new(big.Int).Add(parseBigInt(pos.Token0Collected), args.BigInt("amount0")).String()
+	pos.Token1Collected = new(big.Int).Add(parseBigInt(pos.Token1Collected), args.BigInt("amount1")).String()
+	pos.Token0Owed = settleOwed(pos.Token0Owed, args.BigInt("amount0"))
+	pos.Token1Owed = settleOwed(pos.Token1Owed, args.BigInt("amount1"))
+
+	return pt.save(pos)
+}
+
+// burnDirect adds tokens withdrawn by pool Burn to tokens owed to the directly owned tick range.
+// Burns of zero liquidity (used to update accrued fees) do not change them.
+func (pt positionTracker) burnDirect(burnLog EventLog) error {
+	args, err := decodePoolLog(burnEvent, burnLog)
+	if err != nil {
+		return err
+	}
+	if pt.isPositionsManager(args.Address("owner")) || (args.BigInt("amount0").Sign() == 0 && args.BigInt("amount1").Sign() == 0) {
+		return nil
+	}
+	owed := pt.owedTokens(burnLog.Address, args)
+	owed.Token0Owed = new(big.Int).Add(parseBigInt(owed.Token0Owed), args.BigInt("amount0")).String()
+	owed.Token1Owed = new(big.Int).Add(parseBigInt(owed.Token1Owed), args.BigInt("amount1")).String()
+	return pt.db.SaveOwedTokens(owed)
+}
+
+// collectDirect settles tokens owed to the directly owned tick range by pool Collect.
+func (pt positionTracker) collectDirect(collectLog EventLog) error {
+	args, err := decodePoolLog(collectEvent, collectLog)
+	if err != nil {
+		return err
+	}
+	if pt.isPositionsManager(args.Address("owner")) {
+		return nil
+	}
+	owed := pt.owedTokens(collectLog.Address, args)
+	if owed.Token0Owed == "" && owed.Token1Owed == "" {
+		return nil // Only fees are collected
+	}
+	owed.Token0Owed = settleOwed(owed.Token0Owed, args.BigInt("amount0"))
+	owed.Token1Owed = settleOwed(owed.Token1Owed, args.BigInt("amount1"))
+	return pt.db.SaveOwedTokens(owed)
+}
+
+// withdrawn returns liquidity amounts (in pool token order) the pool Collect takes out of the position apart from fees.
+// Position is the NFT if tokenID is given, or the directly owned tick range of the Collect otherwise.
+func (pt positionTracker) withdrawn(poolCollectLog EventLog, tokenID string) (*big.Int, *big.Int, error) {
+	args, err := decodePoolLog(collectEvent, poolCollectLog)
+	if err != nil {
+		return nil, nil, err
+	}
+	var owed0, owed1 string
+	if tokenID != "" {
+		pos := pt.position(tokenID)
+		owed0, owed1 = pos.Token0Owed, pos.Token1Owed
+	} else {
+		owed := pt.owedTokens(poolCollectLog.Address, args)
+		owed0, owed1 = owed.Token0Owed, owed.Token1Owed
+	}
+	return minBigInt(parseBigInt(owed0), args.BigInt("amount0")), minBigInt(parseBigInt(owed1), args.BigInt("amount1")), nil
+}
+
+func (pt positionTracker) owedTokens(pool string, args eventArgs) repository.OwedTokens {
+	owner, lower, upper := args.Address("owner"), args.Int("tickLower"), args.Int("tickUpper")
+	owed, found := pt.db.GetOwedTokens(strings.ToLower(pool), owner, lower, upper)
+	if !found {
+		owed = repository.OwedTokens{LPoolAddress: strings.ToLower(pool), Owner: owner, LowerTick: lower, UpperTick: upper}
+	}
+	return owed
+}
+
+// settleOwed returns tokens owed after collecting given amount. Withdrawn liquidity is collected before fees.
+func settleOwed(owed string, collected *big.Int) string {
+	res := new(big.Int).Sub(parseBigInt(owed), collected)
+	if res.Sign() < 0 {
+		res.SetInt64(0)
+	}
+	return res.String()
+}
+
+func minBigInt(a, b *big.Int) *big.Int {
+	if a.Cmp(b) < 0 {
+		return new(big.Int).Set(a)
+	}
+	return new(big.Int).Set(b)
+}
+
+func (pt positionTracker) save(pos repository.LiquidityPosition) error {
+	if err := pt.db.SavePosition(pos); err != nil {
+		return err
+	}
+	if pt.ranges != nil {
+		pt.ranges.Track(pos)
+	}
+	return nil
+}
+
+func (pt positionTracker) position(tokenID string) repository.LiquidityPosition {
+	pos, found := pt.db.GetPosition(tokenID)
+	if !found {
+		pos = repository.LiquidityPosition{TokenID: tokenID}
+	}
+	return pos
+}
+
+// parseBigInt parses decimal integer stored in DB. Empty value is zero.
+func parseBigInt(value string) *big.Int {
+	res, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return res
+}
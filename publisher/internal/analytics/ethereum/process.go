@@ -3,7 +3,9 @@ package ethereum
 import (
 	"log"
 
+	"github.com/Synternet/swapscope/publisher/internal/expr"
 	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
 )
 
 func (a *Analytics) ProcessMessage(msg analytics.Message, send analytics.Sender) error {
@@ -13,9 +15,29 @@ func (a *Analytics) ProcessMessage(msg analytics.Message, send analytics.Sender)
 		return nil
 	}
 
+	if err := a.blocks.Next(eLog, msg.Timestamp, a.chainSender(send)); err != nil {
+		log.Println("Failed to analyse finished block: ", err.Error())
+	}
+
 	wrappedLog := a.newWrappedEventLog(eLog)
 	a.addLogToTxCache(wrappedLog) // All events are put into cache
 
+	if err := a.positions.Update(wrappedLog); err != nil {
+		log.Println("Failed to update position: ", err.Error())
+	}
+	if err := a.v4Pools.Update(wrappedLog); err != nil {
+		log.Println("Failed to record Uniswap V4 pool: ", err.Error())
+	}
+	if err := a.ranges.Update(wrappedLog, a.chainSender(send), msg.Timestamp); err != nil {
+		log.Println("Failed to update position ranges: ", err.Error())
+	}
+	if err := a.depth.Update(wrappedLog); err != nil {
+		log.Println("Failed to update pool depth: ", err.Error())
+	}
+	if mint, isDirect := a.directMint(wrappedLog); isDirect {
+		a.blocks.Add(mint, wrappedLog, msg.Timestamp) // Late mints are not analysed and there is nothing to publish
+	}
+
 	if wrappedLog.Instructions.Operation == nil { // There is no way to turn this log into an operation - processing is done
 		return nil
 	}
@@ -29,13 +51,120 @@ func (a *Analytics) ProcessMessage(msg analytics.Message, send analytics.Sender)
 		// return err //TODO: currently if error is returned - whole service (goroutine) is stopped - should not be like this?
 	}
 
-	if !operation.CanPublish() {
+	if err := a.lifecycle.Record(operation, a.chainSender(send), msg.Timestamp); err != nil {
+		log.Println("Failed to record position lifecycle: ", err.Error())
+	}
+	if err := a.rebalances.Record(operation, convertHexToUint64(wrappedLog.Log.BlockNumber), a.chainSender(send), msg.Timestamp); err != nil {
+		log.Println("Failed to publish rebalance: ", err.Error())
+	}
+
+	if sw, isSwap := operation.(*Swap); isSwap {
+		a.publishCandles(a.candles.Add(sw, msg.Timestamp), a.chainSender(send))
+		if value, found := a.inRangeLiquidityValue(sw); found {
+			a.stats.SetInRangeLiquidity(sw.Address, value)
+		}
+	}
+	a.stats.Add(operation, msg.Timestamp)
+	if err := a.leaderboard.Add(operation, msg.Timestamp); err != nil {
+		log.Println("Failed to save wallet bucket: ", err.Error())
+	}
+
+	if a.blocks.Add(operation, wrappedLog, msg.Timestamp) { // Operations are published when the block is finished
+		return nil
+	}
+	// Late operation of a finished block is published without block analysis
+	if err := a.publishOperation(newBlockOperation(operation, wrappedLog, msg.Timestamp), a.chainSender(send)); err != nil {
+		log.Println("Failed to publish operation: ", err.Error())
+	}
+	return nil
+}
+
+// publishBlock publishes operations of the finished block after block detectors have analysed them.
+func (a *Analytics) publishBlock(block uint64, ops []blockOperation, send analytics.Sender) error {
+	var err error
+	for _, op := range ops {
+		if publishErr := a.publishOperation(op, send); publishErr != nil {
+			err = publishErr
+		}
+	}
+	return err
+}
+
+func (a *Analytics) publishOperation(op blockOperation, send analytics.Sender) error {
+	if flash, isFlash := op.Operation.(*Flash); isFlash { // Every flash loan is stored, late ones without purpose
+		if err := flash.Save(op.Timestamp); err != nil {
+			log.Println("Failed to save flash loan: ", err.Error())
+		}
+	}
+	if !op.CanPublish() {
+		return nil
+	}
+
+	facts := a.operationFacts(op)
+	if err := a.publishAlerts(op, facts, send); err != nil {
+		log.Println("Failed to publish alerts: ", err.Error())
+	}
+	if !a.publishFilter.Allow(facts) {
+		return nil
+	}
+
+	log.Println("Tx hash:", op.Log.TransactionHash)
+	log.Println("Operation processed:", op.String())
+
+	// return op.Save(op.Timestamp) // Option to save additions and removals to DB
+	return op.Publish(send, op.PublishTo, op.Timestamp)
+}
+
+// operationFacts describes operation for publish filter and alert rules.
+func (a *Analytics) operationFacts(op blockOperation) expr.Env {
+	facts := op.Facts()
+	facts["operation"] = op.PublishTo
+	return facts
+}
+
+// publishAlerts evaluates alert rules against the operation and publishes fired alerts with the operation message embedded.
+func (a *Analytics) publishAlerts(op blockOperation, facts expr.Env, send analytics.Sender) error {
+	if a.alerts == nil {
+		return nil
+	}
+	alerts := a.alerts.Evaluate(facts, op.Timestamp)
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	var message any
+	capture := func(data any, subjects ...string) error {
+		message = data
 		return nil
 	}
+	if err := op.Publish(capture, op.PublishTo, op.Timestamp); err != nil {
+		return err
+	}
 
-	log.Println("Tx hash:", wrappedLog.Log.TransactionHash)
-	log.Println("Operation processed:", operation.String())
+	var err error
+	for _, fired := range alerts {
+		log.Printf("Alert %q fired. Tx: %s", fired.Rule, op.Log.TransactionHash)
+		alertMessage := types.AlertMessage{
+			Timestamp:   op.Timestamp,
+			ChainID:     a.chain.ID,
+			Rule:        fired.Rule,
+			Description: fired.Description,
+			Group:       fired.Group,
+			Count:       fired.Count,
+			Operation:   op.PublishTo,
+			TxHash:      op.Log.TransactionHash,
+			Message:     message,
+		}
+		if sendErr := send(alertMessage, "alerts", fired.Rule); sendErr != nil {
+			err = sendErr
+		}
+	}
+	return err
+}
 
-	// return operation.Save(msg.Timestamp) // Option to save additions and removals to DB
-	return operation.Publish(send, wrappedLog.Instructions.PublishTo, msg.Timestamp)
+// chainSender scopes published subjects to the processed chain, e.g. <prefix>.ethereum.add.<pool>
+func (a *Analytics) chainSender(send analytics.Sender) analytics.Sender {
+	return func(data any, subjects ...string) error {
+		return send(data, append([]string{a.chain.Name}, subjects...)...)
+	}
 }
@@ -0,0 +1,143 @@
+package ethereum
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+// rangeMonitor maintains current tick of liquidity pools from Swap events and reports
+// open position NFTs whose range the current tick enters or leaves.
+// Open positions of a pool are loaded from DB on the first swap and kept up to date by the position tracker.
+type rangeMonitor struct {
+	mu    sync.Mutex
+	db    Database
+	chain Chain
+	pools map[string]*poolRange
+}
+
+type poolRange struct {
+	tick      int
+	positions map[string]*rangePosition
+}
+
+type rangePosition struct {
+	repository.LiquidityPosition
+	inRange bool
+}
+
+func newRangeMonitor(db Database, chain Chain) *rangeMonitor {
+	return &rangeMonitor{
+		db:    db,
+		chain: chain,
+		pools: make(map[string]*poolRange),
+	}
+}
+
+// Update moves current tick of the pool on Swap event and publishes range transitions of its positions.
+func (rm *rangeMonitor) Update(wel WrappedEventLog, send analytics.Sender, timestamp time.Time) error {
+	if wel.Instructions.Name != swapEvent {
+		return nil
+	}
+	data, err := convertSwapLogData(wel.Log)
+	if err != nil {
+		return err
+	}
+	tick := data.tick
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	poolAddress := strings.ToLower(wel.Log.Address)
+	pool, found := rm.pools[poolAddress]
+	if !found { // Previous tick is unknown - only the state is initialized
+		rm.pools[poolAddress] = rm.loadPool(poolAddress, tick)
+		return nil
+	}
+	if pool.tick == tick {
+		return nil
+	}
+	pool.tick = tick
+
+	for _, pos := range pool.positions {
+		inRange := isTickInRange(tick, pos.LowerTick, pos.UpperTick)
+		if inRange == pos.inRange {
+			continue
+		}
+		pos.inRange = inRange
+		if err := send(rm.newRangeMessage(pos, tick, wel.Log.TransactionHash, timestamp), "position", rangeSubject(inRange)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Track updates position of a monitored pool. Positions without liquidity are no longer monitored.
+func (rm *rangeMonitor) Track(pos repository.LiquidityPosition) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	pool, found := rm.pools[strings.ToLower(pos.LPoolAddress)]
+	if !found {
+		return
+	}
+	if parseBigInt(pos.Liquidity).Sign() == 0 {
+		delete(pool.positions, pos.TokenID)
+		return
+	}
+	if tracked, found := pool.positions[pos.TokenID]; found {
+		tracked.LiquidityPosition = pos
+		return
+	}
+	pool.positions[pos.TokenID] = &rangePosition{LiquidityPosition: pos, inRange: isTickInRange(pool.tick, pos.LowerTick, pos.UpperTick)}
+}
+
+func (rm *rangeMonitor) loadPool(poolAddress string, tick int) *poolRange {
+	pool := &poolRange{
+		tick:      tick,
+		positions: make(map[string]*rangePosition),
+	}
+	for _, pos := range rm.db.GetOpenPositions(poolAddress) {
+		pool.positions[pos.TokenID] = &rangePosition{LiquidityPosition: pos, inRange: isTickInRange(tick, pos.LowerTick, pos.UpperTick)}
+	}
+	return pool
+}
+
+func (rm *rangeMonitor) newRangeMessage(pos *rangePosition, tick int, txHash string, timestamp time.Time) types.PositionRangeMessage {
+	return types.PositionRangeMessage{
+		Timestamp:   timestamp,
+		ChainID:     rm.chain.ID,
+		Address:     pos.LPoolAddress,
+		TokenID:     pos.TokenID,
+		Owner:       pos.Owner,
+		LowerTick:   pos.LowerTick,
+		UpperTick:   pos.UpperTick,
+		CurrentTick: tick,
+		InRange:     pos.inRange,
+		TxHash:      txHash,
+	}
+}
+
+// isTickInRange reports whether position earns fees at the given pool tick.
+func isTickInRange(tick, lowerTick, upperTick int) bool {
+	return lowerTick <= tick && tick < upperTick
+}
+
+// positionAmounts returns raw token amounts of liquidity in the tick range at the given sqrt price (not scaled by 2^96).
+func positionAmounts(liquidity, sqrtPrice float64, lowerTick, upperTick int) (float64, float64) {
+	sqrtLower, sqrtUpper := math.Pow(1.0001, float64(lowerTick)/2), math.Pow(1.0001, float64(upperTick)/2)
+	sqrtPrice = math.Max(sqrtLower, math.Min(sqrtPrice, sqrtUpper))
+	return liquidity * (sqrtUpper - sqrtPrice) / (sqrtPrice * sqrtUpper), liquidity * (sqrtPrice - sqrtLower)
+}
+
+func rangeSubject(inRange bool) string {
+	if inRange {
+		return "in-range"
+	}
+	return "out-of-range"
+}
@@ -0,0 +1,133 @@
+package ethereum
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+const defaultRebalanceWindow = 10 // Blocks
+
+// rebalanceDetector matches removals with additions of the same owner and pool at a different range made within
+// a window of blocks. Fees earned by the removal and fees collected by the owner from the pool in between are summed.
+type rebalanceDetector struct {
+	mu        sync.Mutex
+	chain     Chain
+	window    uint64
+	pending   map[string]*pendingRebalance // Latest removal by owner and pool
+	lastPrune uint64
+}
+
+type pendingRebalance struct {
+	removal *Removal
+	block   uint64
+	fees0   float64 // Token amounts in the order of removal tokens
+	fees1   float64
+}
+
+func newRebalanceDetector(chain Chain, window uint64) *rebalanceDetector {
+	return &rebalanceDetector{
+		chain:   chain,
+		window:  window,
+		pending: make(map[string]*pendingRebalance),
+	}
+}
+
+// Record tracks removals and fee collections and publishes a rebalance when the matching addition arrives.
+// Operations without a known owner are ignored.
+func (rd *rebalanceDetector) Record(op Operation, block uint64, send analytics.Sender, timestamp time.Time) error {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	rd.prune(block)
+	switch op := op.(type) {
+	case *Removal:
+		if op.Owner == "" {
+			return nil
+		}
+		rd.pending[rebalanceKey(op.Owner, op.Address)] = &pendingRebalance{
+			removal: op,
+			block:   block,
+			fees0:   op.Token0Earned.Amount,
+			fees1:   op.Token1Earned.Amount,
+		}
+	case *FeeCollection:
+		pending, found := rd.pending[rebalanceKey(op.Owner, op.Address)]
+		if op.Owner == "" || !found {
+			return nil
+		}
+		token0, token1 := op.Token0, op.Token1
+		if !strings.EqualFold(token0.Address, pending.removal.Token0.Address) {
+			token0, token1 = token1, token0
+		}
+		pending.fees0 += token0.Amount
+		pending.fees1 += token1.Amount
+	case *Addition:
+		key := rebalanceKey(op.Owner, op.Address)
+		pending, found := rd.pending[key]
+		if op.Owner == "" || !found || block < pending.block || block-pending.block > rd.window {
+			return nil // Additions before the removal (e.g. of a late block) are not rebalances
+		}
+		delete(rd.pending, key)
+		if pending.removal.LowerTick == op.LowerTick && pending.removal.UpperTick == op.UpperTick {
+			return nil // Liquidity was re-added to the same range
+		}
+		return send(rd.newRebalanceMessage(pending, op, block, timestamp), "rebalance")
+	}
+	return nil
+}
+
+// prune drops removals that are outside the window. It runs once per block.
+func (rd *rebalanceDetector) prune(block uint64) {
+	if block == rd.lastPrune {
+		return
+	}
+	rd.lastPrune = block
+	for key, pending := range rd.pending {
+		if block > pending.block && block-pending.block > rd.window {
+			delete(rd.pending, key)
+		}
+	}
+}
+
+func rebalanceKey(owner, poolAddress string) string {
+	return strings.ToLower(owner) + "|" + strings.ToLower(poolAddress)
+}
+
+func (rd *rebalanceDetector) newRebalanceMessage(pending *pendingRebalance, add *Addition, block uint64, timestamp time.Time) types.RebalanceMessage {
+	rem := pending.removal
+	return types.RebalanceMessage{
+		Timestamp:   timestamp,
+		ChainID:     rd.chain.ID,
+		Address:     add.Address,
+		Owner:       add.Owner,
+		BlockNumber: block,
+		Blocks:      block - pending.block,
+		OldRange: types.RangeMessage{
+			TokenID:    rem.TokenID,
+			LowerTick:  rem.LowerTick,
+			UpperTick:  rem.UpperTick,
+			LowerRatio: rem.LowerRatio,
+			UpperRatio: rem.UpperRatio,
+		},
+		NewRange: types.RangeMessage{
+			TokenID:    add.TokenID,
+			LowerTick:  add.LowerTick,
+			UpperTick:  add.UpperTick,
+			LowerRatio: add.LowerRatio,
+			UpperRatio: add.UpperRatio,
+		},
+		RemovedUSD: rem.TotalValue,
+		AddedUSD:   add.TotalValue,
+		FeesUSD:    pending.fees0*rem.Token0.Price + pending.fees1*rem.Token1.Price,
+		Fees: [2]types.TokenMessage{
+			{Address: rem.Token0.Address, Symbol: rem.Token0.Symbol, Amount: pending.fees0, Price: rem.Token0.Price},
+			{Address: rem.Token1.Address, Symbol: rem.Token1.Symbol, Amount: pending.fees1, Price: rem.Token1.Price},
+		},
+		RemoveTxHash: rem.TxHash,
+		AddTxHash:    add.TxHash,
+	}
+}
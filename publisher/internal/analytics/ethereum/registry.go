@@ -0,0 +1,106 @@
+package ethereum
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// eventHandler describes how logs of a registered event are wrapped.
+type eventHandler struct {
+	name      string
+	header    string // Event signature, e.g. Mint(address,address,int24,int24,uint128,uint256,uint256)
+	signature string // Full 32-byte event topic
+	contract  string // Emitting contract, any contract if empty
+	topics    int    // Number of topics the log must have (indexed arguments and the event topic), any if 0
+	protocol  string // Protocol of the adapter that registered the handler
+	// operation returns the operation the log is turned into and the subject it is published to.
+	// Logs that are only tracked (e.g. put into the logs cache) have no operation.
+	operation func(eLog EventLog, opBase OperationBase) (Operation, string)
+}
+
+// handlerOption customises event handler when it is registered.
+type handlerOption func(*eventHandler)
+
+// fromContract restricts the handler to logs emitted by the contract.
+func fromContract(address string) handlerOption {
+	return func(h *eventHandler) {
+		h.contract = address
+	}
+}
+
+// withTopics restricts the handler to logs with the number of topics, e.g. to tell ERC721 Transfer
+// (tokenId is indexed) from ERC20 Transfer of the same signature.
+func withTopics(n int) handlerOption {
+	return func(h *eventHandler) {
+		h.topics = n
+	}
+}
+
+// withOperation sets operation the logs are turned into.
+func withOperation(operation func(eLog EventLog, opBase OperationBase) (Operation, string)) handlerOption {
+	return func(h *eventHandler) {
+		h.operation = operation
+	}
+}
+
+// eventRegistry matches event logs to handlers by the full event topic and emitting contract.
+type eventRegistry struct {
+	handlers map[string][]eventHandler // By lowercase event topic, in registration order
+	protocol string                    // Protocol stamped on registered handlers, see forProtocol
+}
+
+func newEventRegistry() *eventRegistry {
+	return &eventRegistry{handlers: make(map[string][]eventHandler)}
+}
+
+// forProtocol returns view of the registry that registers handlers on behalf of the protocol adapter.
+func (r *eventRegistry) forProtocol(protocol string) *eventRegistry {
+	return &eventRegistry{handlers: r.handlers, protocol: protocol}
+}
+
+// Register adds handler of the ABI event under the given name. Name is used as the log type in the logs cache,
+// so that events of the same signature from different contracts can be told apart.
+// Events shared by protocols (e.g. pools of Uniswap V3 forks) are registered once - by the first protocol.
+func (r *eventRegistry) Register(name string, event abi.Event, opts ...handlerOption) {
+	handler := eventHandler{
+		name:      name,
+		header:    event.Sig,
+		signature: convertToEventSignature(event.Sig),
+		protocol:  r.protocol,
+	}
+	for _, opt := range opts {
+		opt(&handler)
+	}
+	for _, registered := range r.handlers[handler.signature] {
+		if registered.name == handler.name && strings.EqualFold(registered.contract, handler.contract) && registered.topics == handler.topics {
+			return
+		}
+	}
+	r.handlers[handler.signature] = append(r.handlers[handler.signature], handler)
+}
+
+// Lookup returns handler of the log. Handlers restricted to the emitting contract take precedence over
+// handlers of any contract; otherwise the first registered matching handler is returned.
+func (r *eventRegistry) Lookup(eLog EventLog) (eventHandler, bool) {
+	if len(eLog.Topics) == 0 {
+		return eventHandler{}, false
+	}
+	var res eventHandler
+	found := false
+	for _, handler := range r.handlers[strings.ToLower(eLog.Topics[0])] {
+		if handler.topics != 0 && handler.topics != len(eLog.Topics) {
+			continue
+		}
+		if handler.contract != "" {
+			if strings.EqualFold(handler.contract, eLog.Address) {
+				return handler, true
+			}
+			continue
+		}
+		if !found {
+			res, found = handler, true
+		}
+	}
+	return res, found
+}
@@ -0,0 +1,158 @@
+package ethereum
+
+import (
+	"strings"
+
+	"github.com/Synternet/swapscope/publisher/pkg/analytics"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+const (
+	routeArbitrage  = "arbitrage"  // Route starts and ends with the same token
+	routeAggregator = "aggregator" // Trade of one token for another split or routed through several pools
+)
+
+// swapRoute is swaps of a transaction in more than one pool, ordered by log index.
+type swapRoute struct {
+	hops []blockOperation
+}
+
+// routeDetector reconstructs swap routes of transactions of a finished block and reports them.
+type routeDetector struct {
+	chain Chain
+}
+
+func (rd routeDetector) Detect(block uint64, ops []blockOperation, send analytics.Sender) error {
+	for _, found := range findRoutes(ops) {
+		if err := send(rd.newRouteMessage(block, found), "route"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findRoutes groups swaps of the block by transaction. Swaps of a single pool (e.g. several swaps of one trade
+// in the same pool) are not a route.
+func findRoutes(ops []blockOperation) []swapRoute {
+	var res []swapRoute
+	var route swapRoute
+	flush := func() {
+		if route.isMultiPool() {
+			res = append(res, route)
+		}
+		route = swapRoute{}
+	}
+	for _, op := range ops { // Ordered by transaction and log index
+		if _, isSwap := op.Operation.(*Swap); !isSwap {
+			continue
+		}
+		if len(route.hops) > 0 && route.hops[0].txIndex != op.txIndex {
+			flush()
+		}
+		route.hops = append(route.hops, op)
+	}
+	flush()
+	return res
+}
+
+func (r swapRoute) isMultiPool() bool {
+	for _, hop := range r.hops[1:] {
+		if !strings.EqualFold(hop.Operation.(*Swap).Address, r.hops[0].Operation.(*Swap).Address) {
+			return true
+		}
+	}
+	return false
+}
+
+// input returns token sold by the first hop with the amount sold of it by all hops (routes can be split).
+func (r swapRoute) input() TokenTransaction {
+	input := r.hops[0].Operation.(*Swap).From
+	input.Amount = 0
+	for _, hop := range r.hops {
+		if sw := hop.Operation.(*Swap); strings.EqualFold(sw.From.Address, input.Address) {
+			input.Amount += sw.From.Amount
+		}
+	}
+	return input
+}
+
+// output returns token bought by the last hop with the amount bought of it by all hops.
+func (r swapRoute) output() TokenTransaction {
+	output := r.hops[len(r.hops)-1].Operation.(*Swap).To
+	output.Amount = 0
+	for _, hop := range r.hops {
+		if sw := hop.Operation.(*Swap); strings.EqualFold(sw.To.Address, output.Address) {
+			output.Amount += sw.To.Amount
+		}
+	}
+	return output
+}
+
+func (r swapRoute) kind() string {
+	if strings.EqualFold(r.input().Address, r.output().Address) {
+		return routeArbitrage
+	}
+	return routeAggregator
+}
+
+// profit returns amount of the input token gained (or lost if negative) by cyclic arbitrage, zero for other routes.
+func (r swapRoute) profit() TokenTransaction {
+	input, output := r.input(), r.output()
+	profit := input
+	profit.Amount = 0
+	if r.kind() == routeArbitrage {
+		profit.Amount = output.Amount - input.Amount
+	}
+	return profit
+}
+
+// path returns symbols of the tokens the route goes through, starting with the input token.
+func (r swapRoute) path() []string {
+	first := r.hops[0].Operation.(*Swap)
+	path := []string{first.From.Symbol}
+	last := first.From.Address
+	for _, hop := range r.hops {
+		sw := hop.Operation.(*Swap)
+		if strings.EqualFold(sw.To.Address, last) {
+			continue
+		}
+		path = append(path, sw.To.Symbol)
+		last = sw.To.Address
+	}
+	return path
+}
+
+func (rd routeDetector) newRouteMessage(block uint64, r swapRoute) types.RouteMessage {
+	first, last := r.hops[0].Operation.(*Swap), r.hops[len(r.hops)-1].Operation.(*Swap)
+	input, output, profit := r.input(), r.output(), r.profit()
+	msg := types.RouteMessage{
+		Timestamp:   r.hops[len(r.hops)-1].Timestamp,
+		ChainID:     rd.chain.ID,
+		BlockNumber: block,
+		TxHash:      first.TxHash,
+		Kind:        r.kind(),
+		Path:        r.path(),
+		Input:       input.message(),
+		Output:      output.message(),
+		ValueUSD:    input.Amount * input.Price,
+		Profit:      profit.message(),
+		ProfitUSD:   profit.Amount * profit.Price,
+		Sender:      first.Sender,
+		Recipient:   last.Recipient,
+	}
+	if msg.ValueUSD == 0 {
+		msg.ValueUSD = output.Amount * output.Price
+	}
+	for _, hop := range r.hops {
+		sw := hop.Operation.(*Swap)
+		msg.FlashLoan = msg.FlashLoan || sw.FlashLoan
+		msg.Hops = append(msg.Hops, types.RouteHopMessage{
+			Address:  sw.Address,
+			Protocol: sw.Protocol,
+			From:     sw.From.message(),
+			To:       sw.To.message(),
+			ValueUSD: sw.TotalValue,
+		})
+	}
+	return msg
+}
@@ -0,0 +1,214 @@
+package ethereum
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/types"
+)
+
+var defaultStatsWindows = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+const (
+	statsBucketSize = time.Minute    // Rolling windows move by one bucket
+	feeAPRWindow    = 24 * time.Hour // Fee APR of this window is stored in the pool table
+	year            = 365 * 24 * time.Hour
+)
+
+// statsBucket accumulates pool activity of one minute.
+type statsBucket struct {
+	start               time.Time
+	liquidityAddedUSD   float64
+	liquidityRemovedUSD float64
+	additions           int
+	removals            int
+	swaps               int
+	volumeUSD           float64
+	feesUSD             float64
+	lps                 map[string]bool
+}
+
+// poolStats is rolling statistics of a pool over one window.
+type poolStats struct {
+	Window              time.Duration
+	LiquidityAddedUSD   float64
+	LiquidityRemovedUSD float64
+	Additions           int
+	Removals            int
+	Swaps               int
+	VolumeUSD           float64
+	FeesUSD             float64
+	FeeAPR              float64 // Fees of the window annualized and divided by in-range liquidity value, 0 if liquidity is unknown
+	UniqueLPs           int
+}
+
+// statsAggregator keeps per-pool minute buckets of additions, removals and swaps for the longest rolling window.
+// In-range liquidity value of a pool is updated on its swaps and used to estimate fee APR.
+type statsAggregator struct {
+	mu          sync.Mutex
+	windows     []time.Duration
+	pools       map[string][]*statsBucket // Buckets of a pool are ordered by time
+	liquidities map[string]float64        // In-range liquidity value (USD) of a pool
+}
+
+func newStatsAggregator(windows []time.Duration) *statsAggregator {
+	return &statsAggregator{
+		windows:     windows,
+		pools:       make(map[string][]*statsBucket),
+		liquidities: make(map[string]float64),
+	}
+}
+
+// SetInRangeLiquidity sets current USD value of liquidity that earns fees in the pool.
+func (sa *statsAggregator) SetInRangeLiquidity(poolAddress string, valueUSD float64) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	sa.liquidities[strings.ToLower(poolAddress)] = valueUSD
+}
+
+// InRangeLiquidity returns last known USD value of in-range liquidity of the pool.
+func (sa *statsAggregator) InRangeLiquidity(poolAddress string) float64 {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	return sa.liquidities[strings.ToLower(poolAddress)]
+}
+
+// Add accounts operation into the stats of its pool. Owners of added and removed positions are counted as LPs,
+// operations of unknown owner are counted without one.
+func (sa *statsAggregator) Add(op Operation, timestamp time.Time) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	switch op := op.(type) {
+	case *Addition:
+		bucket := sa.bucket(op.Address, timestamp)
+		bucket.additions++
+		bucket.liquidityAddedUSD += op.TotalValue
+		bucket.addLP(op.Owner)
+	case *Removal:
+		bucket := sa.bucket(op.Address, timestamp)
+		bucket.removals++
+		bucket.liquidityRemovedUSD += op.TotalValue
+		bucket.addLP(op.Owner)
+	case *Swap:
+		bucket := sa.bucket(op.Address, timestamp)
+		bucket.swaps++
+		bucket.volumeUSD += op.TotalValue
+		bucket.feesUSD += float64(op.FeeTier) * op.TotalValue / 1_000_000
+	}
+}
+
+func (sa *statsAggregator) bucket(poolAddress string, timestamp time.Time) *statsBucket {
+	pool := strings.ToLower(poolAddress)
+	start := timestamp.UTC().Truncate(statsBucketSize)
+	buckets := sa.pools[pool]
+	for i := len(buckets) - 1; i >= 0; i-- {
+		if buckets[i].start.Equal(start) {
+			return buckets[i]
+		}
+		if buckets[i].start.Before(start) {
+			break
+		}
+	}
+
+	bucket := &statsBucket{start: start, lps: make(map[string]bool)}
+	buckets = append(buckets, bucket)
+	sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].start.Before(buckets[j].start) })
+	sa.pools[pool] = buckets
+	return bucket
+}
+
+func (b *statsBucket) addLP(lp string) {
+	if lp != "" {
+		b.lps[strings.ToLower(lp)] = true
+	}
+}
+
+// Snapshot returns stats of every pool that had activity during the longest window. Older buckets are dropped.
+func (sa *statsAggregator) Snapshot(now time.Time) map[string][]poolStats {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	var longest time.Duration
+	for _, window := range sa.windows {
+		if window > longest {
+			longest = window
+		}
+	}
+
+	res := make(map[string][]poolStats)
+	for pool, buckets := range sa.pools {
+		expired := sort.Search(len(buckets), func(i int) bool { return buckets[i].start.After(now.Add(-longest)) })
+		if buckets = buckets[expired:]; len(buckets) == 0 {
+			delete(sa.pools, pool)
+			delete(sa.liquidities, pool)
+			continue
+		}
+		sa.pools[pool] = buckets
+
+		for _, window := range sa.windows {
+			res[pool] = append(res[pool], windowStats(buckets, window, now, sa.liquidities[pool]))
+		}
+	}
+	return res
+}
+
+func windowStats(buckets []*statsBucket, window time.Duration, now time.Time, liquidityUSD float64) poolStats {
+	stats := poolStats{Window: window}
+	lps := make(map[string]bool)
+	for _, bucket := range buckets {
+		if !bucket.start.After(now.Add(-window)) {
+			continue
+		}
+		stats.LiquidityAddedUSD += bucket.liquidityAddedUSD
+		stats.LiquidityRemovedUSD += bucket.liquidityRemovedUSD
+		stats.Additions += bucket.additions
+		stats.Removals += bucket.removals
+		stats.Swaps += bucket.swaps
+		stats.VolumeUSD += bucket.volumeUSD
+		stats.FeesUSD += bucket.feesUSD
+		for lp := range bucket.lps {
+			lps[lp] = true
+		}
+	}
+	stats.UniqueLPs = len(lps)
+	stats.FeeAPR = feeAPR(stats.FeesUSD, liquidityUSD, window)
+	return stats
+}
+
+// feeAPR annualizes fees earned during the window relative to the liquidity that earned them.
+func feeAPR(feesUSD, liquidityUSD float64, window time.Duration) float64 {
+	if liquidityUSD <= 0 || window <= 0 {
+		return 0
+	}
+	return feesUSD / liquidityUSD * float64(year) / float64(window)
+}
+
+func newPoolStatsMessage(poolAddress string, stats []poolStats, liquidityUSD float64, chainID int64, timestamp time.Time) types.PoolStatsMessage {
+	msg := types.PoolStatsMessage{
+		Timestamp:           timestamp,
+		ChainID:             chainID,
+		Address:             poolAddress,
+		InRangeLiquidityUSD: liquidityUSD,
+	}
+	for _, s := range stats {
+		msg.Windows = append(msg.Windows, types.PoolStatsWindowMessage{
+			Window:              intervalName(s.Window),
+			NetLiquidityFlowUSD: s.LiquidityAddedUSD - s.LiquidityRemovedUSD,
+			LiquidityAddedUSD:   s.LiquidityAddedUSD,
+			LiquidityRemovedUSD: s.LiquidityRemovedUSD,
+			Additions:           s.Additions,
+			Removals:            s.Removals,
+			Swaps:               s.Swaps,
+			VolumeUSD:           s.VolumeUSD,
+			FeesUSD:             s.FeesUSD,
+			FeeAPR:              s.FeeAPR,
+			UniqueLPs:           s.UniqueLPs,
+		})
+	}
+	return msg
+}
@@ -1,7 +1,10 @@
 package ethereum
 
 import (
+	"strings"
+
 	"github.com/Synternet/swapscope/publisher/pkg/repository"
+	"github.com/Synternet/swapscope/publisher/pkg/types"
 )
 
 type EventLog struct {
@@ -27,6 +30,12 @@ type Position struct {
 	LowerTick    int
 	UpperTick    int
 	TxHash       string
+	JIT          bool   // Part of just-in-time liquidity provision
+	FlashLoan    bool   // Funded by a flash loan in the same transaction
+	Protocol     string // Protocol of the pool, e.g. uniswap-v3
+	FullRange    bool   // Liquidity is provided over the whole price range, e.g. Curve and Balancer pools have no ticks
+
+	chain Chain
 }
 
 type TokenTransaction struct {
@@ -35,6 +44,18 @@ type TokenTransaction struct {
 	Price  float64
 }
 
+// message returns token transaction as published, with reputation flags of suspicious tokens.
+func (t TokenTransaction) message() types.TokenMessage {
+	return types.TokenMessage{Address: t.Address, Symbol: t.Symbol, Amount: t.Amount, Price: t.Price, Flags: t.flags()}
+}
+
+func (t TokenTransaction) flags() []string {
+	if t.Flags == "" {
+		return nil
+	}
+	return strings.Split(t.Flags, ",")
+}
+
 type EventInstruction struct {
 	Name      string
 	Header    string
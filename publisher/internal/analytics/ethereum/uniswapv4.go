@@ -0,0 +1,199 @@
+package ethereum
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+)
+
+const (
+	zeroAddress      = "0x0000000000000000000000000000000000000000"
+	v4DynamicFeeFlag = 0x800000 // Pool key fee of pools whose hooks set the fee, actual fee is reported by each Swap
+)
+
+// Uniswap V4 pools are identified by PoolId, which is used as the pool address everywhere (pool table,
+// published messages and subjects). Pool tokens are known only for pools initialized while the service runs.
+
+// poolManagerTracker records Uniswap V4 pools from PoolManager Initialize events.
+type poolManagerTracker struct {
+	db           Database
+	tokenFetcher TokenFetcher
+	poolPrices   *poolPriceCache
+	chain        Chain
+}
+
+// Update records pool of Initialize event together with its initial price. Other events are ignored.
+func (pt poolManagerTracker) Update(wel WrappedEventLog) error {
+	if wel.Instructions.Name != initializeEvent {
+		return nil
+	}
+	args, err := decodePoolManagerLog(initializeEvent, wel.Log)
+	if err != nil {
+		return err
+	}
+
+	pool := repository.Pool{
+		Address:       convertTopicToPoolID(wel.Log.Topics[1]),
+		Token0Address: pt.chain.currencyAddress(args.Address("currency0")),
+		Token1Address: pt.chain.currencyAddress(args.Address("currency1")),
+		Fee:           args.Int("fee"),
+		TickSpacing:   args.Int("tickSpacing"),
+		Protocol:      uniswapV4Protocol,
+	}
+	if pool.Fee == v4DynamicFeeFlag {
+		pool.Fee = 0
+	}
+	if hooks := args.Address("hooks"); hooks != zeroAddress {
+		pool.Hooks = hooks
+	}
+	for _, address := range []string{pool.Token0Address, pool.Token1Address} {
+		if _, err := pt.tokenFetcher.Token(address); err != nil { // Pool tokens are looked up in the database later
+			return err
+		}
+	}
+
+	pt.poolPrices.swap(pool.Address, args.BigInt("sqrtPriceX96"))
+	return pt.db.SavePool(pool)
+}
+
+// convertTopicToPoolID converts indexed PoolId into lowercase hex the pool is tracked by.
+func convertTopicToPoolID(topic string) string {
+	return strings.ToLower(topic)
+}
+
+// processV4Swap handles PoolManager Swap. Event amounts are balance changes of the swapper,
+// so they are negated into pool deltas. The event has no recipient - swap parties are resolved by v4SwapParties.
+func (sw *Swap) processV4Swap(swap WrappedEventLog) error {
+	args, err := decodePoolManagerLog(swapEvent, swap.Log)
+	if err != nil {
+		return err
+	}
+	poolID := convertTopicToPoolID(swap.Log.Topics[1])
+	token0, token1, err := sw.getTokensByPoolAddress(poolID)
+	if err != nil {
+		return err
+	}
+	data := swapData{
+		amount0:      new(big.Int).Neg(args.BigInt("amount0")),
+		amount1:      new(big.Int).Neg(args.BigInt("amount1")),
+		sqrtPriceX96: args.BigInt("sqrtPriceX96"),
+		liquidity:    args.BigInt("liquidity"),
+		tick:         args.Int("tick"),
+	}
+
+	sw.Position = newPosition(swap, sw.OperationBase.chain)
+	sw.Address = poolID
+	sw.Protocol = sw.protocol
+	sw.Sender, sw.Recipient = sw.v4SwapParties(swap.Log, args.Address("sender"), token0.Address, token1.Address, data)
+	sw.Token0 = TokenTransaction{Token: token0, Amount: convertAmount(data.amount0, token0.Decimals)}
+	sw.Token1 = TokenTransaction{Token: token1, Amount: convertAmount(data.amount1, token1.Decimals)}
+
+	sw.state = data
+	sw.calculatePrices(data)
+	if err := sw.settle(token0.Address); err != nil {
+		return err
+	}
+	sw.FeeTier = args.Int("fee") // Includes dynamic fee set by hooks
+	sw.Fee.Amount = sw.From.Amount * float64(sw.FeeTier) / 1_000_000
+	return nil
+}
+
+// v4SwapParties returns payer (sender) and taker (recipient) of V4 swap from transfers of its tokens to and from
+// PoolManager. If a token was not transferred (e.g. native ETH, or deltas of a multi-hop swap were netted), the caller
+// is the party, unless it is a router that swaps on behalf of others - then the party is unknown.
+func (sw *Swap) v4SwapParties(swap EventLog, caller string, token0, token1 string, data swapData) (string, string) {
+	if sw.OperationBase.chain.isSwapRouter(caller) {
+		caller = ""
+	}
+	sender, recipient := caller, caller
+	transferLogs, err := sw.cache.GetByTxHashAndLogType(swap.TransactionHash, transferEvent)
+	if err != nil {
+		return sender, recipient
+	}
+	for token, delta := range map[string]*big.Int{token0: data.amount0, token1: data.amount1} {
+		into := delta.Sign() > 0
+		transferLog, found := findTransfer(transferLogs, swap.Address, into, token, new(big.Int).Abs(delta))
+		if !found {
+			continue
+		}
+		if into {
+			sender = transferCounterparty(transferLog, true)
+		} else {
+			recipient = transferCounterparty(transferLog, false)
+		}
+	}
+	return sender, recipient
+}
+
+// processModifyLiquidity handles PoolManager ModifyLiquidity that adds liquidity.
+func (add *Addition) processModifyLiquidity(modify WrappedEventLog) error {
+	pos, args, err := add.OperationBase.modifiedPosition(modify)
+	if err != nil {
+		return err
+	}
+	add.Position = pos
+	add.TokenID, add.Owner = add.modifyingOwner(args)
+	add.Sender = add.Owner
+
+	add.valueLiquidity(&add.Position, false) // Pool is recorded by poolManagerTracker on Initialize
+	return nil
+}
+
+// processModifyLiquidity handles PoolManager ModifyLiquidity that removes liquidity.
+// Accrued fees are credited to the caller apart from the event, so they are not reported.
+func (rem *Removal) processModifyLiquidity(modify WrappedEventLog) error {
+	pos, args, err := rem.OperationBase.modifiedPosition(modify)
+	if err != nil {
+		return err
+	}
+	rem.Position = pos
+	rem.TokenID, rem.Owner = rem.modifyingOwner(args)
+	rem.Recipient = rem.Owner
+
+	rem.valueLiquidity(&rem.Position, false)
+	return nil
+}
+
+// modifyingOwner returns position NFT and its owner of ModifyLiquidity made by PositionManager, or the caller that
+// owns the position otherwise. Owner is empty if the NFT owner is unknown (e.g. NFT was minted before tracking started).
+func (ob OperationBase) modifyingOwner(modifyArgs eventArgs) (string, string) {
+	tokenID, found := ob.chain.v4PositionTokenID(modifyArgs)
+	if !found {
+		return "", modifyArgs.Address("sender")
+	}
+	return tokenID, ob.positionOwner(tokenID, "")
+}
+
+// modifiedPosition returns position of ModifyLiquidity with token amounts of the liquidity change, and the event arguments.
+// Event carries liquidity only, so amounts are calculated at the current pool price, which is known
+// once the pool is initialized or swapped while the service runs.
+func (ob OperationBase) modifiedPosition(modify WrappedEventLog) (Position, eventArgs, error) {
+	args, err := decodePoolManagerLog(modifyLiquidityEvent, modify.Log)
+	if err != nil {
+		return Position{}, nil, err
+	}
+	poolID := convertTopicToPoolID(modify.Log.Topics[1])
+	token0, token1, err := ob.getTokensByPoolAddress(poolID)
+	if err != nil {
+		return Position{}, nil, err
+	}
+	sqrtPriceX96, found := ob.poolPrices.price(poolID)
+	if !found {
+		return Position{}, nil, fmt.Errorf("SKIP - price of pool %s is unknown", poolID)
+	}
+
+	pos := newPosition(modify, ob.chain)
+	pos.Address = poolID
+	pos.Protocol = ob.protocol
+	pos.LowerTick, pos.UpperTick = args.Int("tickLower"), args.Int("tickUpper")
+
+	liquidity, _ := new(big.Float).SetInt(new(big.Int).Abs(args.BigInt("liquidityDelta"))).Float64()
+	sqrtPrice, _ := new(big.Float).Quo(new(big.Float).SetInt(sqrtPriceX96), new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96))).Float64()
+	amount0, amount1 := positionAmounts(liquidity, sqrtPrice, pos.LowerTick, pos.UpperTick)
+	pos.Token0 = TokenTransaction{Token: token0, Amount: amount0 / math.Pow10(token0.Decimals)}
+	pos.Token1 = TokenTransaction{Token: token1, Amount: amount1 / math.Pow10(token1.Decimals)}
+	return pos, args, nil
+}
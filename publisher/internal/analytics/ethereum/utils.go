@@ -2,9 +2,12 @@ package ethereum
 
 import (
 	"fmt"
+	"log"
+	"math/big"
 	"strings"
 
 	"github.com/patrickmn/go-cache"
+	"golang.org/x/exp/slices"
 )
 
 // addLogToTxCache adds event log to cache.
@@ -55,6 +58,66 @@ func (c EventLogCache) GetByTxHashAndLogType(txHash string, logType string) ([]E
 	return resFilteredByHashAndType, nil
 }
 
+// findPoolLogOfPosition looks for pool event of given type (Mint, Burn, Collect) in the same transaction
+// that was made by the positions manager together with given IncreaseLiquidity, DecreaseLiquidity or Collect event.
+func findPoolLogOfPosition(c Cache, positionLog EventLog, poolLogType string) (EventLog, bool) {
+	poolLogs, err := c.GetByTxHashAndLogType(positionLog.TransactionHash, poolLogType)
+	if err != nil {
+		return EventLog{}, false
+	}
+	for _, poolLog := range poolLogs {
+		if hasSamePositionData(poolLog, positionLog) {
+			return poolLog, true
+		}
+	}
+	return EventLog{}, false
+}
+
+// hasSamePositionData reports whether pool event data ends with the same three words as positions manager event data:
+// (liquidity, amount0, amount1) of Mint/Burn and IncreaseLiquidity/DecreaseLiquidity or (recipient, amount0, amount1) of Collect.
+func hasSamePositionData(poolLog EventLog, positionLog EventLog) bool {
+	positionData := strings.ToLower(strings.TrimPrefix(positionLog.Data, "0x"))
+	if len(positionData) != 3*64 {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(poolLog.Data), positionData)
+}
+
+// findTransfer looks for transfer of the exact token amount into (or out of) the holder, e.g. a pool or Balancer Vault.
+// Transfers of any token are matched if token is empty.
+func findTransfer(transferLogs []EventLog, holder string, into bool, token string, amount *big.Int) (EventLog, bool) {
+	for _, transferLog := range transferLogs {
+		if token != "" && !strings.EqualFold(transferLog.Address, token) {
+			continue
+		}
+		args, err := decodeTokenLog(transferEvent, transferLog)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(transferParty(args, into), holder) && args.BigInt("value").Cmp(amount) == 0 {
+			return transferLog, true
+		}
+	}
+	return EventLog{}, false
+}
+
+// transferCounterparty returns the other party of the transfer into (or out of) the holder.
+func transferCounterparty(transferLog EventLog, into bool) string {
+	args, err := decodeTokenLog(transferEvent, transferLog)
+	if err != nil {
+		return ""
+	}
+	return transferParty(args, !into)
+}
+
+// transferParty returns receiver (to) or sender (from) of the decoded transfer.
+func transferParty(args eventArgs, receiver bool) string {
+	if receiver {
+		return args.Address("to")
+	}
+	return args.Address("from")
+}
+
 func (a *Analytics) newWrappedEventLog(eLog EventLog) WrappedEventLog {
 	var wel WrappedEventLog
 	wel.Log = eLog
@@ -63,75 +126,61 @@ func (a *Analytics) newWrappedEventLog(eLog EventLog) WrappedEventLog {
 		db:    a.db,
 		cache: a.eventLogCache,
 		fetchers: Fetchers{
-			priceFetcher: a.priceFetcher,
-			tokenFetcher: a.tokenFetcher,
+			priceFetcher:   a.priceFetcher,
+			tokenFetcher:   a.tokenFetcher,
+			poolFeeFetcher: a.poolFeeFetcher,
 		},
+		poolPrices: a.poolPrices,
+		chain:      a.chain,
 	}
 
-	switch {
-	case a.isTransfer(eLog):
-		wel.Instructions = EventInstruction{
-			Name:      transferEvent,
-			Header:    ethereumErc20TokenABI.Events[transferEvent].Sig,
-			Signature: a.eventSignature[transferEvent],
-			Operation: nil,
-			PublishTo: "",
-		}
-	case a.isMint(eLog):
-		wel.Instructions = EventInstruction{
-			Name:      mintEvent,
-			Header:    uniswapLiqPoolsABI.Events[mintEvent].Sig,
-			Signature: a.eventSignature[mintEvent],
-			Operation: &Addition{OperationBase: initOpBase},
-			PublishTo: "add",
-		}
-	case a.isBurn(eLog):
-		wel.Instructions = EventInstruction{
-			Name:      burnEvent,
-			Header:    uniswapLiqPoolsABI.Events[burnEvent].Sig,
-			Signature: a.eventSignature[burnEvent],
-		}
-	case a.isCollect(eLog):
-		wel.Instructions = EventInstruction{
-			Name:      collectEvent,
-			Header:    uniswapLiqPoolsABI.Events[collectEvent].Sig,
-			Signature: a.eventSignature[collectEvent],
-			Operation: &Removal{OperationBase: initOpBase},
-			PublishTo: "remove",
-		}
-	case a.isSwap(eLog):
-		wel.Instructions = EventInstruction{
-			Name:      swapEvent,
-			Header:    uniswapLiqPoolsABI.Events[swapEvent].Sig,
-			Signature: a.eventSignature[swapEvent],
-			Operation: &Swap{OperationBase: initOpBase},
-			PublishTo: "swap",
-		}
-	default:
+	handler, found := a.events.Lookup(eLog)
+	if !found {
 		wel.Instructions = EventInstruction{
 			Name: "OTHER",
 		}
+		return wel
+	}
+	wel.Instructions = EventInstruction{
+		Name:      handler.name,
+		Header:    handler.header,
+		Signature: handler.signature,
+	}
+	initOpBase.protocol = handler.protocol
+	if handler.operation != nil {
+		wel.Instructions.Operation, wel.Instructions.PublishTo = handler.operation(eLog, initOpBase)
 	}
 
 	return wel
 }
 
-func (a *Analytics) isTransfer(el EventLog) bool {
-	return strings.HasPrefix(el.Topics[0], a.eventSignature[transferEvent])
-}
-
-func (a *Analytics) isMint(el EventLog) bool {
-	return strings.HasPrefix(el.Topics[0], a.eventSignature[mintEvent])
-}
-
-func (a *Analytics) isBurn(el EventLog) bool {
-	return strings.HasPrefix(el.Topics[0], a.eventSignature[burnEvent])
+// registerEvents registers handlers of token transfers, which all protocols use, and of the enabled protocols.
+// Adding an event is a single registration with the operation its logs are turned into (if any).
+func (a *Analytics) registerEvents() {
+	a.events.Register(transferEvent, ethereumErc20TokenABI.Events[transferEvent])
+	for _, adapter := range protocolAdapters {
+		if !a.isProtocolEnabled(adapter.Protocol()) || !adapter.Supports(a.chain) {
+			continue
+		}
+		adapter.Register(a, a.events.forProtocol(adapter.Protocol()))
+	}
 }
 
-func (a *Analytics) isCollect(el EventLog) bool {
-	return strings.HasPrefix(el.Topics[0], a.eventSignature[collectEvent])
+// isProtocolEnabled checks if protocol events are processed. All protocols are processed if none were selected.
+func (a *Analytics) isProtocolEnabled(protocol string) bool {
+	return len(a.protocols) == 0 || slices.Contains(a.protocols, protocol)
 }
 
-func (a *Analytics) isSwap(el EventLog) bool {
-	return strings.HasPrefix(el.Topics[0], a.eventSignature[swapEvent])
+// collectOperation decides whether pool Collect event is a liquidity removal or fees only collection,
+// by tokens owed to the position (NFT if tokenID is given) for liquidity withdrawn before.
+func (a *Analytics) collectOperation(poolCollectLog EventLog, tokenID string, opBase OperationBase) (Operation, string) {
+	withdrawn0, withdrawn1, err := a.positions.withdrawn(poolCollectLog, tokenID)
+	if err != nil {
+		log.Println("Failed to find tokens owed to position: ", err.Error())
+		return nil, ""
+	}
+	if withdrawn0.Sign() == 0 && withdrawn1.Sign() == 0 { // Only fees are collected
+		return &FeeCollection{OperationBase: opBase}, "collect"
+	}
+	return &Removal{OperationBase: opBase, withdrawn0: withdrawn0, withdrawn1: withdrawn1}, "remove"
 }
@@ -0,0 +1,99 @@
+// Package config reads JSON configuration files (publish filter rules, alert rules, webhooks) and reloads
+// the ones that can change while publisher is running.
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Duration is time.Duration that is written as a string (e.g. "10m") in configuration files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Read decodes JSON file into T. Name describes the file in errors, e.g. "alert rules".
+func Read[T any](path string, name string) (T, error) {
+	var cfg T
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read %s file: %w", name, err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s file: %w", name, err)
+	}
+	return cfg, nil
+}
+
+// File is a configuration file that is decoded into T and applied again whenever it changes.
+type File[T any] struct {
+	path    string
+	name    string
+	apply   func(T) error
+	modTime time.Time
+}
+
+// NewFile creates configuration file of given path. Apply validates and activates the decoded configuration.
+func NewFile[T any](path string, name string, apply func(T) error) *File[T] {
+	return &File[T]{path: path, name: name, apply: apply}
+}
+
+// Reload re-reads the file. Currently applied configuration is kept if the new file is invalid.
+func (f *File[T]) Reload() error {
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s file: %w", f.name, err)
+	}
+	cfg, err := Read[T](f.path, f.name)
+	if err != nil {
+		return err
+	}
+	if err := f.apply(cfg); err != nil {
+		return err
+	}
+	f.modTime = stat.ModTime()
+	log.Printf("Loaded %s from %s", f.name, f.path)
+	return nil
+}
+
+// Watch polls the file every interval and reloads it when it changes.
+func (f *File[T]) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		stat, err := os.Stat(f.path)
+		if err != nil {
+			log.Printf("Failed to check %s file: %s", f.name, err)
+			continue
+		}
+		if stat.ModTime().Equal(f.modTime) {
+			continue
+		}
+		if err := f.Reload(); err != nil {
+			log.Printf("Failed to reload %s, keeping previous ones: %s", f.name, err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type node interface {
+	eval(Env) (any, error)
+}
+
+type (
+	literalNode struct {
+		value any
+	}
+	identNode struct {
+		name string
+	}
+	listNode struct {
+		items []node
+	}
+	notNode struct {
+		operand node
+	}
+	logicalNode struct {
+		op          string
+		left, right node
+	}
+	compareNode struct {
+		op          string
+		left, right node
+	}
+	arithmeticNode struct {
+		op          string
+		left, right node
+	}
+	callNode struct {
+		name string
+		fn   function
+		args []node
+	}
+)
+
+type function func(args []any) (any, error)
+
+var functions = map[string]function{
+	"abs": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("abs expects 1 argument")
+		}
+		v, ok := toFloat(args[0])
+		if !ok {
+			return nil, fmt.Errorf("abs expects a number, got %T", args[0])
+		}
+		return math.Abs(v), nil
+	},
+	"lower": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("lower expects 1 argument")
+		}
+		return strings.ToLower(fmt.Sprint(args[0])), nil
+	},
+	"upper": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("upper expects 1 argument")
+		}
+		return strings.ToUpper(fmt.Sprint(args[0])), nil
+	},
+	"contains": func(args []any) (any, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("contains expects 2 arguments")
+		}
+		return strings.Contains(fmt.Sprint(args[0]), fmt.Sprint(args[1])), nil
+	},
+}
+
+func (n literalNode) eval(Env) (any, error) {
+	return n.value, nil
+}
+
+func (n identNode) eval(env Env) (any, error) {
+	return env[n.name], nil
+}
+
+func (n listNode) eval(env Env) (any, error) {
+	values := make([]any, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (n notNode) eval(env Env) (any, error) {
+	v, err := evalBool(n.operand, env)
+	if err != nil {
+		return nil, err
+	}
+	return !v, nil
+}
+
+func (n logicalNode) eval(env Env) (any, error) {
+	left, err := evalBool(n.left, env)
+	if err != nil {
+		return nil, err
+	}
+	// Short-circuit so that guards like `x != nil && x > 5` work as expected
+	if n.op == "&&" && !left {
+		return false, nil
+	}
+	if n.op == "||" && left {
+		return true, nil
+	}
+	return evalBool(n.right, env)
+}
+
+func (n compareNode) eval(env Env) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		list, ok := right.([]any)
+		if !ok {
+			return nil, fmt.Errorf("right side of 'in' must be a list, got %T", right)
+		}
+		for _, item := range list {
+			if equal(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if left == nil || right == nil {
+		return false, nil
+	}
+	if l, ok := toFloat(left); ok {
+		r, ok := toFloat(right)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %T with %T", left, right)
+		}
+		return compareOrdered(n.op, l, r), nil
+	}
+	if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %T with %T", left, right)
+		}
+		return compareOrdered(n.op, l, r), nil
+	}
+	return nil, fmt.Errorf("operator %s is not defined for %T", n.op, left)
+}
+
+func (n arithmeticNode) eval(env Env) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	l, okL := toFloat(left)
+	r, okR := toFloat(right)
+	if !okL || !okR {
+		return nil, fmt.Errorf("operator %s expects numbers, got %T and %T", n.op, left, right)
+	}
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", n.op)
+}
+
+func (n callNode) eval(env Env) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return n.fn(args)
+}
+
+func evalBool(n node, env Env) (bool, error) {
+	v, err := n.eval(env)
+	if err != nil {
+		return false, err
+	}
+	if v == nil {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected bool, got %v (%T)", v, v)
+	}
+	return b, nil
+}
+
+func equal(left, right any) bool {
+	if l, ok := toFloat(left); ok {
+		r, ok := toFloat(right)
+		return ok && l == r
+	}
+	if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		return ok && strings.EqualFold(l, r)
+	}
+	if _, ok := left.([]any); ok {
+		return false
+	}
+	if _, ok := right.([]any); ok {
+		return false
+	}
+	return left == right
+}
+
+func compareOrdered[T float64 | string](op string, l, r T) bool {
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,68 @@
+// Package expr implements a small boolean/arithmetic expression language used to declare
+// publishing and alerting rules in configuration files instead of code.
+//
+// Expressions are evaluated against an Env - a flat map of field names to values, e.g.
+//
+//	operation == 'add' && valueUSD > 1_000_000 && token1.symbol in ['USDC', 'USDT']
+//
+// Supported values are numbers (any Go integer or float), strings, booleans and lists.
+// Fields missing from the Env evaluate to nil; ordering comparisons involving nil are false.
+// String equality is case-insensitive so that checksummed and lowercase addresses match.
+package expr
+
+import (
+	"fmt"
+)
+
+// Env maps field names to values an expression is evaluated against.
+type Env map[string]any
+
+type Expression struct {
+	source string
+	root   node
+}
+
+// Compile parses the expression source.
+func Compile(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize expression %q: %w", source, err)
+	}
+	p := parser{tokens: tokens}
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expression %q: %w", source, err)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be parsed.
+func MustCompile(source string) *Expression {
+	e, err := Compile(source)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Eval evaluates the expression and returns the resulting value.
+func (e *Expression) Eval(env Env) (any, error) {
+	return e.root.eval(env)
+}
+
+// Bool evaluates the expression and requires it to result in a boolean.
+func (e *Expression) Bool(env Env) (bool, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q evaluated to %v (%T), expected bool", e.source, v, v)
+	}
+	return b, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
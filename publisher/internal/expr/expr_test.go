@@ -0,0 +1,98 @@
+package expr
+
+import (
+	"testing"
+)
+
+func Test_Bool(t *testing.T) {
+	env := Env{
+		"operation":      "add",
+		"valueUSD":       1500000.0,
+		"tickRangeWidth": 60,
+		"token0.symbol":  "WETH",
+		"token1.symbol":  "USDC",
+		"token1.address": "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+		"token1.stable":  true,
+	}
+	tests := []struct {
+		name    string
+		input   string
+		trueRes bool
+	}{
+		{"string equality", "operation == 'add'", true},
+		{"number threshold", "valueUSD > 1_000_000", true},
+		{"number threshold with exponent", "valueUSD >= 2e6", false},
+		{"int field vs float literal", "tickRangeWidth <= 60.0", true},
+		{"arithmetic", "valueUSD / 1000 - 500 == 1000", true},
+		{"unary minus", "-tickRangeWidth < 0", true},
+		{"and/or precedence", "operation == 'swap' || operation == 'add' && token1.stable", true},
+		{"not", "!token1.stable", false},
+		{"in list", "token0.symbol in ['WETH', \"WBTC\"]", true},
+		{"not in list", "!(token1.symbol in ['WETH'])", true},
+		{"case insensitive address", "token1.address == '0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48'", true},
+		{"missing field compares false", "earnedUSD > 0", false},
+		{"missing field equals nil", "earnedUSD == nil", true},
+		{"missing bool field", "token0.stable || token1.stable", true},
+		{"function call", "abs(-tickRangeWidth) == 60 && contains(lower(token0.symbol), 'eth')", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := Compile(test.input)
+			if err != nil {
+				t.Fatalf("Compile(%v) failed: %v", test.input, err)
+			}
+			res, err := e.Bool(env)
+			if err != nil {
+				t.Fatalf("Bool(%v) failed: %v", test.input, err)
+			}
+			if res != test.trueRes {
+				t.Errorf("Bool(%v) = (%v); expected (%v)", test.input, res, test.trueRes)
+			}
+		})
+	}
+}
+
+func Test_CompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unterminated string", "operation == 'add"},
+		{"dangling operator", "valueUSD >"},
+		{"unbalanced parenthesis", "(valueUSD > 1"},
+		{"unknown function", "sqrt(valueUSD) > 1"},
+		{"trailing tokens", "valueUSD > 1 2"},
+		{"unexpected character", "valueUSD > 1 # comment"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Compile(test.input); err == nil {
+				t.Errorf("Compile(%v) expected error", test.input)
+			}
+		})
+	}
+}
+
+func Test_BoolErrors(t *testing.T) {
+	env := Env{"valueUSD": 1500.0, "earnedUSD": 0.0, "operation": "add"}
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"division by zero", "valueUSD / earnedUSD > 10"},
+		{"arithmetic on string", "operation * 2 > 1"},
+		{"comparison of different types", "operation > 1"},
+		{"not a bool", "valueUSD"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := Compile(test.input)
+			if err != nil {
+				t.Fatalf("Compile(%v) failed: %v", test.input, err)
+			}
+			if _, err := e.Bool(env); err == nil {
+				t.Errorf("Bool(%v) expected error", test.input)
+			}
+		})
+	}
+}
@@ -37,14 +37,17 @@ type CoingeckoFetcher struct {
 	db           repository.Repository
 	baseApiUrl   string
 	expiresIn    time.Duration // For price fetching
-	priceFetcher RateLimitedFetcher[TokenPriceResponse]
-	tokenFetcher RateLimitedFetcher[TokenInfoResponse]
+	purgesIn     time.Duration
+	platform     string // CoinGecko asset platform, e.g. ethereum, arbitrum-one
+	priceFetcher *RateLimitedFetcher[TokenPriceResponse]
+	tokenFetcher *RateLimitedFetcher[TokenInfoResponse]
 	cache        *cache.Cache // For price fetching
 }
 
 const (
-	tokenInfoEndpoint  = "/coins/ethereum/contract/"
-	tokenPriceEndpoint = "/simple/token_price/ethereum"
+	tokenInfoEndpoint  = "/coins/%s/contract/"
+	tokenPriceEndpoint = "/simple/token_price/%s"
+	defaultPlatform    = "ethereum"
 	priceBase          = "usd"
 	pricePrecision     = 10
 )
@@ -54,15 +57,17 @@ func NewCoingeckoFetcher(ctx context.Context, db repository.Repository, apiUrl s
 		baseApiUrl: apiUrl,
 		ctx:        ctx,
 		expiresIn:  expires,
+		purgesIn:   purges,
+		platform:   defaultPlatform,
 		db:         db,
 	}
 	ret.cache = cache.New(expires, purges)
-	ret.priceFetcher = RateLimitedFetcher[TokenPriceResponse]{
+	ret.priceFetcher = &RateLimitedFetcher[TokenPriceResponse]{
 		Client:    &http.Client{},
 		Timeout:   timeout,
 		RateLimit: rateLimit,
 	}
-	ret.tokenFetcher = RateLimitedFetcher[TokenInfoResponse]{
+	ret.tokenFetcher = &RateLimitedFetcher[TokenInfoResponse]{
 		Client:    &http.Client{},
 		Timeout:   timeout,
 		RateLimit: rateLimit,
@@ -70,6 +75,22 @@ func NewCoingeckoFetcher(ctx context.Context, db repository.Repository, apiUrl s
 	return ret, nil
 }
 
+// ForPlatform returns a fetcher for another CoinGecko asset platform (chain).
+// Returned fetcher shares API rate limits with the original one, but has its own price cache and token repository.
+func (p *CoingeckoFetcher) ForPlatform(db repository.Repository, platform string) *CoingeckoFetcher {
+	return &CoingeckoFetcher{
+		ctx:          p.ctx,
+		db:           db,
+		baseApiUrl:   p.baseApiUrl,
+		expiresIn:    p.expiresIn,
+		purgesIn:     p.purgesIn,
+		platform:     platform,
+		priceFetcher: p.priceFetcher,
+		tokenFetcher: p.tokenFetcher,
+		cache:        cache.New(p.expiresIn, p.purgesIn),
+	}
+}
+
 func (p *CoingeckoFetcher) Price(tokenAddress string) (repository.TokenPrice, error) {
 	if price, found := p.cache.Get(tokenAddress); found {
 		log.Println("Price found in cache", price, "of token", tokenAddress)
@@ -90,7 +111,7 @@ func (p *CoingeckoFetcher) fetchPrice(tokenAddress string) (repository.TokenPric
 	queryParams.Add("vs_currencies", priceBase)
 	queryParams.Add("precision", strconv.Itoa(pricePrecision))
 	apiURL, _ := url.Parse(p.baseApiUrl)
-	apiURL = apiURL.JoinPath(tokenPriceEndpoint)
+	apiURL = apiURL.JoinPath(fmt.Sprintf(tokenPriceEndpoint, p.platform))
 	apiURL.RawQuery = queryParams.Encode()
 
 	// var result TokenPriceResponse
@@ -132,7 +153,7 @@ func (p *CoingeckoFetcher) Token(tokenAddress string) (repository.Token, error)
 // If token is present in CoinGecko API - it is put to DB, price is also updated to cache (to not request CoinGecko 2 times)
 func (p *CoingeckoFetcher) fetchToken(tokenAddress string) (repository.Token, error) {
 	apiURL, _ := url.Parse(p.baseApiUrl)
-	apiURL = apiURL.JoinPath(tokenInfoEndpoint)
+	apiURL = apiURL.JoinPath(fmt.Sprintf(tokenInfoEndpoint, p.platform))
 	apiURL = apiURL.JoinPath(tokenAddress)
 
 	response, err := p.tokenFetcher.Fetch(p.ctx, apiURL.String())
@@ -144,12 +165,12 @@ func (p *CoingeckoFetcher) fetchToken(tokenAddress string) (repository.Token, er
 		Address:     tokenAddress,
 		Symbol:      strings.ToUpper(response.Symbol),
 		Name:        response.Name,
-		Decimals:    response.DetailPlatforms["ethereum"].DecimalPlaces,
+		Decimals:    response.DetailPlatforms[p.platform].DecimalPlaces,
 		TotalSupply: 0,
 	}
 
 	if token.Symbol == "" || token.Decimals == 0 {
-		return repository.Token{}, fmt.Errorf("token (%s,%s,%d) not found in API", tokenAddress, token.Symbol, token.Decimals)
+		return repository.Token{}, fmt.Errorf("token (%s,%s,%d) %w in API", tokenAddress, token.Symbol, token.Decimals, ErrNotFound)
 	}
 
 	if value, found := response.MarketData.CurrentPrice[priceBase]; found {
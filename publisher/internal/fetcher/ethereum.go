@@ -3,6 +3,7 @@ package fetcher
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -14,19 +15,25 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 var (
 	//go:embed token_abi.json
 	tokenABI        string
 	tokenABIMethods = []string{"name", "symbol", "decimals"}
+
+	errMethodReverted = errors.New("method reverted")
+
+	poolABI = `[{"inputs":[],"name":"fee","outputs":[{"internalType":"uint24","name":"","type":"uint24"}],"stateMutability":"view","type":"function"}]`
 )
 
 type EthereumFetcher struct {
-	db     repository.Repository
-	url    string
-	client *ethclient.Client
-	abi    abi.ABI
+	db      repository.Repository
+	url     string
+	client  *ethclient.Client
+	abi     abi.ABI
+	poolAbi abi.ABI
 }
 
 func NewEthereumFetcher(ctx context.Context, rpcURL string, db repository.Repository) (*EthereumFetcher, error) {
@@ -56,6 +63,11 @@ func NewEthereumFetcher(ctx context.Context, rpcURL string, db repository.Reposi
 
 	ret.abi = tokenAbi
 
+	ret.poolAbi, err = abi.JSON(strings.NewReader(poolABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pool ABI: %w", err)
+	}
+
 	return ret, nil
 }
 
@@ -76,39 +88,73 @@ func (a *EthereumFetcher) Token(address string) (repository.Token, error) {
 	return token, err
 }
 
-func (a *EthereumFetcher) fetchToken(address string) (repository.Token, error) {
-	// Create a context with a timeout (adjust the timeout as needed)
+// Fee returns fee tier of the liquidity pool. Fee is fetched from ETH node once and kept in the database.
+func (a *EthereumFetcher) Fee(poolAddress string) (int, error) {
+	fee, found := a.db.GetPoolFee(poolAddress)
+	if found {
+		return fee, nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Call the contract's name() function
-	symbol, err := a.callContractFunc(ctx, address, "symbol")
+	contractAddress := common.HexToAddress(poolAddress)
+	result, err := a.client.CallContract(ctx, ethereum.CallMsg{
+		To:   &contractAddress,
+		Data: a.poolAbi.Methods["fee"].ID,
+	}, nil)
 	if err != nil {
-		log.Println("Failed to fetch token", address, "data (symbol) from full node:", err)
+		return 0, fmt.Errorf("failed to call fee method of pool %s: %w", poolAddress, err)
 	}
 
-	name, err := a.callContractFunc(ctx, address, "name")
+	resultField, err := a.poolAbi.Unpack("fee", result)
 	if err != nil {
-		log.Println("Failed to fetch token", address, "data (name) from full node:", err)
+		return 0, fmt.Errorf("failed unpacking fee of pool %s: %w", poolAddress, err)
 	}
-
-	decimals, err := a.callContractFunc(ctx, address, "decimals")
+	fee, err = strconv.Atoi(fmt.Sprintf("%v", resultField[0]))
 	if err != nil {
-		log.Println("Failed to fetch token", address, "data (decimals) from full node:", err)
+		return 0, fmt.Errorf("failed converting fee of pool %s: %w", poolAddress, err)
+	}
+
+	return fee, a.db.SavePoolFee(poolAddress, fee)
+}
+
+// fetchToken reads token metadata from the token contract. Tokens whose name or symbol calls revert are flagged,
+// other call failures (e.g. node timeouts) are returned as errors so that the token is not stored half-known.
+func (a *EthereumFetcher) fetchToken(address string) (repository.Token, error) {
+	// Create a context with a timeout (adjust the timeout as needed)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var flags []string
+	fields := make(map[string]string, len(tokenABIMethods))
+	for _, method := range tokenABIMethods {
+		value, err := a.callContractFunc(ctx, address, method)
+		switch {
+		case errors.Is(err, errMethodReverted):
+			log.Println("Token", address, "method", method, "reverts on full node:", err)
+			if method != "decimals" { // Missing decimals are flagged as non-standard
+				flags = appendFlag(flags, FlagMetadataReverts)
+			}
+		case err != nil:
+			return repository.Token{}, fmt.Errorf("failed to fetch token %s data (%s) from full node: %w", address, method, err)
+		}
+		fields[method] = value
 	}
 
-	decimalsInt, err := strconv.Atoi(decimals)
+	decimalsInt, err := strconv.Atoi(fields["decimals"])
 	if err != nil {
 		log.Println("Failed to convert token", address, "decimals data:", err)
 	}
 
-	log.Println("Token info gathered from node:", address, symbol, name, decimalsInt)
+	log.Println("Token info gathered from node:", address, fields["symbol"], fields["name"], decimalsInt)
 
 	return repository.Token{
 		Address:  address,
-		Symbol:   symbol,
-		Name:     name,
+		Symbol:   fields["symbol"],
+		Name:     fields["name"],
 		Decimals: decimalsInt,
+		Flags:    strings.Join(flags, ","),
 	}, nil
 }
 
@@ -121,16 +167,32 @@ func (a *EthereumFetcher) callContractFunc(ctx context.Context, address, method
 		To:   &contractAddress,
 		Data: a.abi.Methods[method].ID,
 	}, nil)
+	if isRevert(err) {
+		return "", fmt.Errorf("%s method: %w: %v", method, errMethodReverted, err)
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to call %s method: %w", method, err)
 	}
 
+	// Contracts without the method and accounts without code return no data
 	resultField, err := a.abi.Unpack(method, result)
 	if err != nil {
-		return "", fmt.Errorf("failed unpacking method's %s result: %w", method, err)
+		return "", fmt.Errorf("unpacking method's %s result: %w: %v", method, errMethodReverted, err)
 	}
 
 	strField := fmt.Sprintf("%v", resultField[0])
 
 	return strField, err
 }
+
+// isRevert checks if contract call failed because of the contract rather than the node.
+func isRevert(err error) bool {
+	if err == nil {
+		return false
+	}
+	var dataErr rpc.DataError // Any JSON-RPC error, but only reverts carry data
+	if errors.As(err, &dataErr) && dataErr.ErrorData() != nil {
+		return true
+	}
+	return strings.Contains(err.Error(), "execution reverted")
+}
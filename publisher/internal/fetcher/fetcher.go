@@ -3,6 +3,7 @@ package fetcher
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +12,9 @@ import (
 	"time"
 )
 
+// ErrNotFound is returned when the API does not know the requested resource.
+var ErrNotFound = errors.New("resource not found")
+
 // RateLimitedFeetcher implements a two staged rate limited fetching of a resource by implementing
 // an estimation of the sliding window rate limiter on the API side as well as utilizing `Retry-After“ headers in the response.
 //
@@ -167,7 +171,7 @@ func (f *RateLimitedFetcher[T]) Fetch(ctxMain context.Context, url string) (T, e
 			fmt.Println("Error:", err)
 		}
 		if response.StatusCode == http.StatusNotFound {
-			return result, fmt.Errorf("error on HTTP request. Status code: %d with message: %s", response.StatusCode, body) // Do not print head for 404
+			return result, fmt.Errorf("%w. Status code: %d with message: %s", ErrNotFound, response.StatusCode, body) // Do not print head for 404
 		}
 		return result, fmt.Errorf("error on HTTP request. Status code: %d with message: %s and headers %v", response.StatusCode, body, response.Header)
 	}
@@ -1,8 +1,11 @@
 package fetcher
 
 import (
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
 )
 
 func calculateRelativeTS(now time.Time, ts []time.Time) []time.Duration {
@@ -137,3 +140,67 @@ func Test_nextCallDue(t *testing.T) {
 		})
 	}
 }
+
+func Test_reputationFlags(t *testing.T) {
+	wellKnown := map[string]string{
+		"WETH": "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2",
+		"USDC": "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48",
+	}
+	tests := []struct {
+		name     string
+		token    repository.Token
+		listed   bool
+		contract repository.Token
+		want     []string
+	}{
+		{
+			"well-known token",
+			repository.Token{Address: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Symbol: "USDC", Decimals: 6},
+			true,
+			repository.Token{Symbol: "USDC", Decimals: 6},
+			nil,
+		},
+		{
+			"listed token without full node",
+			repository.Token{Address: "0x1f9840a85d5af5bf1d1762f925bdaddc4201f984", Symbol: "UNI", Decimals: 18},
+			true,
+			repository.Token{},
+			nil,
+		},
+		{
+			"fake stable token",
+			repository.Token{Address: "0x1111111111111111111111111111111111111111", Symbol: "usdc", Decimals: 6},
+			false,
+			repository.Token{Symbol: "usdc", Decimals: 6},
+			[]string{FlagSymbolCollision, FlagNotListed},
+		},
+		{
+			"decimals differ from contract",
+			repository.Token{Address: "0x2222222222222222222222222222222222222222", Symbol: "ABC", Decimals: 18},
+			true,
+			repository.Token{Symbol: "ABC", Decimals: 9},
+			[]string{FlagNonStandardDecimals},
+		},
+		{
+			"too many decimals",
+			repository.Token{Address: "0x3333333333333333333333333333333333333333", Symbol: "XYZ", Decimals: 24},
+			false,
+			repository.Token{Symbol: "XYZ", Decimals: 24},
+			[]string{FlagNotListed, FlagNonStandardDecimals},
+		},
+		{
+			"metadata reverts",
+			repository.Token{Address: "0x4444444444444444444444444444444444444444", Decimals: 0},
+			false,
+			repository.Token{Flags: FlagMetadataReverts},
+			[]string{FlagNotListed, FlagNonStandardDecimals, FlagMetadataReverts},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reputationFlags(tt.token, tt.listed, tt.contract, wellKnown); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reputationFlags(%v) = (%v); expected (%v)", tt.token, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package fetcher
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/Synternet/swapscope/publisher/pkg/repository"
+)
+
+// Reputation flags of tokens. Flagged tokens are still processed, flags are stored with the token and published
+// with its operations so that spam and scam tokens can be told apart from the ones they imitate.
+const (
+	FlagSymbolCollision     = "symbol-collision"      // Symbol of a well-known token, but at another address
+	FlagNotListed           = "not-listed"            // Token is unknown to CoinGecko
+	FlagNonStandardDecimals = "non-standard-decimals" // Decimals are missing, above 18, or differ between CoinGecko and the contract
+	FlagMetadataReverts     = "metadata-reverts"      // Contract name or symbol calls revert
+
+	maxStandardDecimals = 18
+)
+
+// ReputationFetcher fetches tokens and flags the suspicious ones before putting them to DB.
+// Tokens are listed by CoinGecko and, if a full node is configured, checked against their contract.
+// Tokens unknown to CoinGecko are taken from the contract; without a full node they can not be fetched.
+type ReputationFetcher struct {
+	db        repository.Repository
+	listing   *CoingeckoFetcher
+	node      *EthereumFetcher // Optional
+	wellKnown []string         // Addresses of tokens whose symbols must not be reused
+}
+
+func NewReputationFetcher(db repository.Repository, listing *CoingeckoFetcher, node *EthereumFetcher, wellKnown ...string) *ReputationFetcher {
+	return &ReputationFetcher{
+		db:        db,
+		listing:   listing,
+		node:      node,
+		wellKnown: wellKnown,
+	}
+}
+
+// Token returns token from DB, or fetches it, flags it and puts it to DB.
+// Tokens are flagged once, when they are seen for the first time. Tokens stored before reputation checks
+// are flagged the first time they are read.
+func (f *ReputationFetcher) Token(address string) (repository.Token, error) {
+	token, found := f.db.GetToken(address)
+	if found && token.Checked {
+		return token, nil
+	}
+	if found {
+		return f.flagStored(token), nil
+	}
+	log.Println("Token", address, "not in DB... Try to fetch it and check its reputation.")
+
+	listed, listingErr := f.listing.fetchToken(address)
+	if listingErr != nil && (f.node == nil || !errors.Is(listingErr, ErrNotFound)) {
+		return repository.Token{}, listingErr // Not flagged as not listed while CoinGecko is unavailable
+	}
+	contract, err := f.contractToken(address, listingErr == nil)
+	if err != nil {
+		return repository.Token{}, err
+	}
+
+	token = listed
+	if listingErr != nil {
+		log.Println("Token", address, "is taken from its contract:", listingErr)
+		token = contract
+	}
+	token.Flags = strings.Join(reputationFlags(token, listingErr == nil, contract, f.wellKnownSymbols(address)), ",")
+	token.Checked = true
+	if token.Flags != "" {
+		log.Println("Token", address, token.Symbol, "flagged:", token.Flags)
+	}
+	return token, f.db.AddToken(token)
+}
+
+// flagStored checks reputation of the token stored before reputation checks and saves its flags. Stored token data
+// is kept. If CoinGecko is unavailable, the token is returned unflagged and checked again when it is read next time.
+func (f *ReputationFetcher) flagStored(token repository.Token) repository.Token {
+	_, listingErr := f.listing.fetchToken(token.Address)
+	if listingErr != nil && !errors.Is(listingErr, ErrNotFound) {
+		log.Println("Failed checking reputation of token", token.Address, ":", listingErr)
+		return token
+	}
+	contract, _ := f.contractToken(token.Address, true) // Node errors of known tokens are only logged
+	token.Flags = strings.Join(reputationFlags(token, listingErr == nil, contract, f.wellKnownSymbols(token.Address)), ",")
+	token.Checked = true
+	if token.Flags != "" {
+		log.Println("Stored token", token.Address, token.Symbol, "flagged:", token.Flags)
+	}
+	if err := f.db.SaveTokenFlags(token.Address, token.Flags); err != nil {
+		log.Println("Failed saving flags of token", token.Address, ":", err)
+	}
+	return token
+}
+
+// contractToken fetches token from its contract, if a full node is configured. Node errors of tokens known otherwise
+// (listed by CoinGecko) are logged only: such tokens are checked without their contract, so decimals are not compared.
+func (f *ReputationFetcher) contractToken(address string, known bool) (repository.Token, error) {
+	if f.node == nil {
+		return repository.Token{}, nil
+	}
+	contract, err := f.node.fetchToken(address)
+	if err != nil && known {
+		log.Println("Token", address, "is checked without its contract:", err)
+		return repository.Token{}, nil
+	}
+	return contract, err
+}
+
+// wellKnownSymbols returns addresses of well-known tokens by their symbols. Well-known tokens are fetched
+// from CoinGecko the first time and then from DB. Token being fetched is skipped, so it is not added twice.
+func (f *ReputationFetcher) wellKnownSymbols(skip string) map[string]string {
+	symbols := make(map[string]string, len(f.wellKnown))
+	for _, address := range f.wellKnown {
+		if strings.EqualFold(address, skip) {
+			continue
+		}
+		token, err := f.listing.Token(address)
+		if err != nil {
+			log.Println("Failed fetching well-known token", address, ":", err)
+			continue
+		}
+		symbols[strings.ToUpper(token.Symbol)] = address
+	}
+	return symbols
+}
+
+// reputationFlags checks the token fetched from CoinGecko (listed) or from its contract otherwise.
+// Contract token is empty if there is no full node, then only CoinGecko data is checked.
+func reputationFlags(token repository.Token, listed bool, contract repository.Token, wellKnown map[string]string) []string {
+	var flags []string
+	if address, found := wellKnown[strings.ToUpper(token.Symbol)]; found && !strings.EqualFold(address, token.Address) {
+		flags = appendFlag(flags, FlagSymbolCollision)
+	}
+	if !listed {
+		flags = appendFlag(flags, FlagNotListed)
+	}
+	if token.Decimals <= 0 || token.Decimals > maxStandardDecimals || (listed && contract.Decimals != 0 && contract.Decimals != token.Decimals) {
+		flags = appendFlag(flags, FlagNonStandardDecimals)
+	}
+	for _, flag := range strings.Split(contract.Flags, ",") {
+		if flag != "" {
+			flags = appendFlag(flags, flag)
+		}
+	}
+	return flags
+}
+
+func appendFlag(flags []string, flag string) []string {
+	for _, f := range flags {
+		if f == flag {
+			return flags
+		}
+	}
+	return append(flags, flag)
+}
@@ -0,0 +1,168 @@
+// Package filter decides whether a processed operation gets published.
+//
+// Rules are declared in a JSON file and evaluated in order; the first rule whose `when` expression
+// matches decides the action. If no rule matches, the default action is applied:
+//
+//	{
+//	  "default": "drop",
+//	  "rules": [
+//	    {"name": "whales", "when": "valueUSD >= 1000000", "action": "publish"},
+//	    {"name": "stable-pairs", "when": "token0.stable || token1.stable", "action": "publish"}
+//	  ]
+//	}
+package filter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/internal/config"
+	"github.com/Synternet/swapscope/publisher/internal/expr"
+)
+
+type Action string
+
+const (
+	ActionPublish Action = "publish"
+	ActionDrop    Action = "drop"
+)
+
+type Rule struct {
+	Name   string `json:"name"`
+	When   string `json:"when"`
+	Action Action `json:"action"`
+
+	expression *expr.Expression
+}
+
+type Config struct {
+	Default Action `json:"default"`
+	Rules   []Rule `json:"rules"`
+}
+
+type Engine struct {
+	config atomic.Pointer[Config]
+	file   *config.File[Config] // Set if rules are loaded from file
+}
+
+// DefaultConfig mirrors the behaviour publisher had before rules became configurable:
+// only pairs with a well-known (native or stable) token are published and
+// liquidity operations additionally require both token prices to be known.
+func DefaultConfig() Config {
+	return Config{
+		Default: ActionPublish,
+		Rules: []Rule{
+			{
+				Name:   "no-well-known-token",
+				When:   "!(token0.native || token0.stable || token1.native || token1.stable)",
+				Action: ActionDrop,
+			},
+			{
+				Name:   "missing-price",
+				When:   "operation != 'swap' && (token0.priceUSD == 0 || token1.priceUSD == 0)",
+				Action: ActionDrop,
+			},
+		},
+	}
+}
+
+// New creates filter engine from given config.
+func New(cfg Config) (*Engine, error) {
+	ret := &Engine{}
+	if err := ret.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Default creates filter engine with DefaultConfig rules.
+func Default() *Engine {
+	ret, err := New(DefaultConfig())
+	if err != nil {
+		log.Panicln("Default publish filter rules are invalid:", err)
+	}
+	return ret
+}
+
+// Load creates filter engine from rules file. The file can be reloaded later with Reload or Watch.
+func Load(path string) (*Engine, error) {
+	ret := &Engine{}
+	ret.file = config.NewFile(path, "publish filter rules", ret.setConfig)
+	if err := ret.Reload(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (e *Engine) setConfig(cfg Config) error {
+	if cfg.Default == "" {
+		cfg.Default = ActionPublish
+	}
+	if err := cfg.Default.validate(); err != nil {
+		return fmt.Errorf("default action: %w", err)
+	}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if err := rule.Action.validate(); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		expression, err := expr.Compile(rule.When)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		rule.expression = expression
+	}
+	e.config.Store(&cfg)
+	return nil
+}
+
+// Reload re-reads the rules file. Currently active rules are kept if the new file is invalid.
+func (e *Engine) Reload() error {
+	if e.file == nil {
+		return nil
+	}
+	return e.file.Reload()
+}
+
+// Watch polls the rules file every interval and reloads it when it changes.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	if e.file == nil {
+		return
+	}
+	e.file.Watch(ctx, interval)
+}
+
+// Allow evaluates the rules against operation facts and reports whether the operation should be published.
+// Drop rules that fail to evaluate (e.g. divide by zero) drop the operation, other failing rules are skipped.
+func (e *Engine) Allow(facts expr.Env) bool {
+	cfg := e.config.Load()
+	for _, rule := range cfg.Rules {
+		matched, err := rule.expression.Bool(facts)
+		if err != nil {
+			log.Printf("Publish filter rule %q failed: %s", rule.Name, err.Error())
+			if rule.Action == ActionDrop {
+				return false
+			}
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if rule.Action == ActionDrop {
+			log.Printf("SKIP - publish filter rule %q. Tx: %v\n\n", rule.Name, facts["txHash"])
+			return false
+		}
+		return true
+	}
+	return cfg.Default == ActionPublish
+}
+
+func (a Action) validate() error {
+	if a != ActionPublish && a != ActionDrop {
+		return fmt.Errorf("unknown action %q (expected %q or %q)", a, ActionPublish, ActionDrop)
+	}
+	return nil
+}
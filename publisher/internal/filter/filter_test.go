@@ -0,0 +1,73 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/Synternet/swapscope/publisher/internal/expr"
+)
+
+func Test_DefaultAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		facts   expr.Env
+		trueRes bool
+	}{
+		{"stable pair addition", expr.Env{"operation": "add", "token0.native": true, "token1.stable": true, "token0.priceUSD": 1800.0, "token1.priceUSD": 1.0}, true},
+		{"long tail addition", expr.Env{"operation": "add", "token0.priceUSD": 0.1, "token1.priceUSD": 2.0}, false},
+		{"addition with missing price", expr.Env{"operation": "add", "token0.native": true, "token0.priceUSD": 1800.0, "token1.priceUSD": 0.0}, false},
+		{"swap without prices", expr.Env{"operation": "swap", "token1.native": true}, true},
+	}
+	f := Default()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := f.Allow(test.facts)
+			if res != test.trueRes {
+				t.Errorf("Allow(%v) = (%v); expected (%v)", test.facts, res, test.trueRes)
+			}
+		})
+	}
+}
+
+func Test_NewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"unknown default action", Config{Default: "ignore"}},
+		{"unknown rule action", Config{Rules: []Rule{{Name: "r", When: "true", Action: "alert"}}}},
+		{"invalid expression", Config{Rules: []Rule{{Name: "r", When: "valueUSD >", Action: ActionDrop}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := New(test.cfg); err == nil {
+				t.Errorf("New(%v) expected error", test.cfg)
+			}
+		})
+	}
+}
+
+func Test_FailingRuleAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  Action
+		trueRes bool
+	}{
+		{"failing drop rule drops", ActionDrop, false},
+		{"failing publish rule is skipped", ActionPublish, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := New(Config{Default: ActionDrop, Rules: []Rule{
+				{Name: "fee ratio", When: "valueUSD / feeUSD < 1000", Action: test.action},
+				{Name: "large", When: "valueUSD > 100", Action: ActionPublish},
+			}})
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			facts := expr.Env{"valueUSD": 1500.0, "feeUSD": 0.0}
+			if res := f.Allow(facts); res != test.trueRes {
+				t.Errorf("Allow(%v) = (%v); expected (%v)", facts, res, test.trueRes)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+)
+
+// migratePrimaryKey recreates primary key of the table if its columns differ from the given ones.
+// AutoMigrate adds new columns, but does not change primary key of an existing table, e.g. tables created before
+// chain ID was added to their key would keep rejecting the same address on another chain as a conflict.
+func migratePrimaryKey(dbCon *gorm.DB, table string, columns ...string) error {
+	var current []string
+	err := dbCon.Raw(`SELECT a.attname FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indrelid = ?::regclass AND i.indisprimary
+		ORDER BY array_position(i.indkey::int2[], a.attnum)`, table).Scan(&current).Error
+	if err != nil {
+		return err
+	}
+	if slices.Equal(current, columns) {
+		return nil
+	}
+	log.Printf("Migrating primary key of %s from (%s) to (%s)", table, strings.Join(current, ", "), strings.Join(columns, ", "))
+
+	return dbCon.Transaction(func(tx *gorm.DB) error {
+		var constraint string
+		err := tx.Raw("SELECT conname FROM pg_constraint WHERE conrelid = ?::regclass AND contype = 'p'", table).Scan(&constraint).Error
+		if err != nil {
+			return err
+		}
+		if constraint != "" {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", table, constraint)).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", table, strings.Join(columns, ", "))).Error
+	})
+}
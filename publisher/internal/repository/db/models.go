@@ -11,16 +11,21 @@ type Model struct {
 
 type Token struct {
 	Timestamp_added time.Time `gorm:"autoCreateTime:true"`
+	ChainID         int64     `gorm:"default:1"`
 	Address         string
 	Symbol          string
 	Name            string
 	Decimals        int
+	Flags           string
+	Checked         bool `gorm:"default:false"`
 }
 
 type Addition struct {
 	TimestampAdded    time.Time `gorm:"autoCreateTime:true"`
+	ChainID           int64     `gorm:"default:1"`
 	TimestampReceived time.Time
 	LPoolAddress      string
+	TokenID           string
 	Token0Symbol      string
 	Token1Symbol      string
 	Token0Amount      float64
@@ -29,13 +34,17 @@ type Addition struct {
 	UpperActualRatio  float64
 	Token0PriceUsd    float64
 	Token1PriceUsd    float64
+	Owner             string
+	Sender            string
 	TxHash            string
 }
 
 type Removal struct {
 	TimestampAdded    time.Time `gorm:"autoCreateTime:true"`
+	ChainID           int64     `gorm:"default:1"`
 	TimestampReceived time.Time
 	LPoolAddress      string
+	TokenID           string
 	Token0Symbol      string
 	Token1Symbol      string
 	Token0Amount      float64
@@ -44,23 +53,186 @@ type Removal struct {
 	UpperActualRatio  float64
 	Token0PriceUsd    float64
 	Token1PriceUsd    float64
+	Owner             string
+	Recipient         string
 	TxHash            string
 }
 
 type Swap struct {
 	TimestampAdded    time.Time `gorm:"autoCreateTime:true"`
+	ChainID           int64     `gorm:"default:1"`
 	TimestampReceived time.Time
 	LPoolAddress      string
 	TokenFromAddress  string
 	TokenFromAmount   float64
 	TokenToAddress    string
 	TokenToAmount     float64
+	ValueUSD          float64
+	ExecutionPrice    float64
+	PriceBefore       float64
+	PriceAfter        float64
+	PriceImpactBps    float64
+	FeeTier           int
+	FeeUSD            float64
+	Sender            string
+	Recipient         string
+	TxHash            string
+}
+
+type FlashLoan struct {
+	TimestampAdded    time.Time `gorm:"autoCreateTime:true"`
+	ChainID           int64     `gorm:"default:1"`
+	TimestampReceived time.Time
+	LPoolAddress      string
+	Token0Address     string
+	Token0Amount      float64
+	Token0Fee         float64
+	Token1Address     string
+	Token1Amount      float64
+	Token1Fee         float64
+	ValueUSD          float64
+	FeeUSD            float64
+	Sender            string
+	Recipient         string
+	Purpose           string
 	TxHash            string
 }
 
 type Pool struct {
 	Timestamp_added time.Time `gorm:"autoCreateTime:true"`
+	ChainID         int64     `gorm:"primaryKey;default:1"`
 	Address         string    `gorm:"primaryKey"`
 	Token0Address   string
 	Token1Address   string
+	Fee             int
+	FeeAPR          float64
+	Protocol        string
+	TickSpacing     int
+	Hooks           string
+}
+
+type LiquidityPosition struct {
+	TimestampUpdated time.Time `gorm:"autoUpdateTime:true"`
+	ChainID          int64     `gorm:"primaryKey;default:1"`
+	TokenID          string    `gorm:"primaryKey"`
+	Owner            string
+	LPoolAddress     string
+	LowerTick        int
+	UpperTick        int
+	Liquidity        string
+	Token0Collected  string
+	Token1Collected  string
+	Token0Owed       string
+	Token1Owed       string
+}
+
+type PositionLedger struct {
+	TimestampUpdated time.Time `gorm:"autoUpdateTime:true"`
+	ChainID          int64     `gorm:"primaryKey;default:1"`
+	TokenID          string    `gorm:"primaryKey"`
+	LPoolAddress     string
+	OpenedAt         time.Time
+	Token0Address    string
+	Token0Symbol     string
+	Token1Address    string
+	Token1Symbol     string
+	Token0Deposited  float64
+	Token1Deposited  float64
+	Token0Withdrawn  float64
+	Token1Withdrawn  float64
+	Token0Fees       float64
+	Token1Fees       float64
+	DepositedUSD     float64
+	WithdrawnUSD     float64
+	FeesUSD          float64
+}
+
+type PositionReport struct {
+	TimestampAdded     time.Time `gorm:"autoCreateTime:true"`
+	ChainID            int64     `gorm:"default:1"`
+	TokenID            string
+	Owner              string
+	LPoolAddress       string
+	OpenedAt           time.Time
+	Token0Address      string
+	Token0Symbol       string
+	Token1Address      string
+	Token1Symbol       string
+	Token0Deposited    float64
+	Token1Deposited    float64
+	Token0Withdrawn    float64
+	Token1Withdrawn    float64
+	Token0Fees         float64
+	Token1Fees         float64
+	DepositedUSD       float64
+	WithdrawnUSD       float64
+	FeesUSD            float64
+	ClosedAt           time.Time
+	HodlUSD            float64
+	ImpermanentLossUSD float64
+	ImpermanentLoss    float64
+	PnlUSD             float64
+	TxHash             string
+}
+
+type Candle struct {
+	TimestampAdded time.Time `gorm:"autoCreateTime:true"`
+	ChainID        int64     `gorm:"default:1"`
+	LPoolAddress   string
+	Interval       string
+	OpenTime       time.Time
+	CloseTime      time.Time
+	BaseSymbol     string
+	QuoteSymbol    string
+	Open           float64
+	High           float64
+	Low            float64
+	Close          float64
+	VolumeBase     float64
+	VolumeQuote    float64
+	VolumeUSD      float64
+	Trades         int
+}
+
+type LiquidityChange struct {
+	TimestampAdded time.Time `gorm:"autoCreateTime:true"`
+	ChainID        int64     `gorm:"primaryKey;default:1"`
+	TxHash         string    `gorm:"primaryKey"`
+	LogIndex       uint64    `gorm:"primaryKey"`
+	LPoolAddress   string    `gorm:"index"`
+	LowerTick      int
+	UpperTick      int
+	Liquidity      string
+}
+
+type OwedTokens struct {
+	TimestampUpdated time.Time `gorm:"autoUpdateTime:true"`
+	ChainID          int64     `gorm:"primaryKey;default:1"`
+	LPoolAddress     string    `gorm:"primaryKey"`
+	Owner            string    `gorm:"primaryKey"`
+	LowerTick        int       `gorm:"primaryKey;autoIncrement:false"`
+	UpperTick        int       `gorm:"primaryKey;autoIncrement:false"`
+	Token0Owed       string
+	Token1Owed       string
+}
+
+type WalletStats struct {
+	ChainID      int64  `gorm:"primaryKey;default:1"`
+	Address      string `gorm:"primaryKey"`
+	Window       string `gorm:"primaryKey"`
+	LiquidityUSD float64
+	FeesUSD      float64
+	VolumeUSD    float64
+	Pools        int
+	UpdatedAt    time.Time
+}
+
+type WalletBucket struct {
+	ChainID      int64     `gorm:"primaryKey;default:1"`
+	Address      string    `gorm:"primaryKey"`
+	Start        time.Time `gorm:"primaryKey"`
+	LiquidityUSD float64
+	FeesUSD      float64
+	VolumeUSD    float64
+	Pools        string
 }
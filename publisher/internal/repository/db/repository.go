@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/Synternet/swapscope/publisher/pkg/repository"
 	_ "github.com/lib/pq"
@@ -14,11 +15,12 @@ import (
 var _ repository.Repository = (*Repository)(nil)
 
 type Repository struct {
-	dbCon *gorm.DB
+	dbCon   *gorm.DB
+	chainID int64
 }
 
 func New(host string, port string, user string, password string, dbname string) (*Repository, error) {
-	ret := &Repository{}
+	ret := &Repository{chainID: 1}
 
 	dbCon, err := gorm.Open(postgres.New(postgres.Config{
 		DSN:                  fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname),
@@ -36,12 +38,38 @@ func New(host string, port string, user string, password string, dbname string)
 	dbCon.Table("eth_liq_adds_local").AutoMigrate(&Addition{})
 	dbCon.Table("eth_liq_removals_local").AutoMigrate(&Removal{})
 	dbCon.Table("eth_swaps_local").AutoMigrate(&Swap{})
+	dbCon.Table("eth_flash_loans_local").AutoMigrate(&FlashLoan{})
+	dbCon.Table("eth_positions_local").AutoMigrate(&LiquidityPosition{})
+	dbCon.Table("eth_position_ledgers_local").AutoMigrate(&PositionLedger{})
+	dbCon.Table("eth_position_reports_local").AutoMigrate(&PositionReport{})
+	dbCon.Table("eth_candles_local").AutoMigrate(&Candle{})
+	dbCon.Table("eth_liquidity_changes_local").AutoMigrate(&LiquidityChange{})
+	dbCon.Table("eth_wallet_stats_local").AutoMigrate(&WalletStats{})
+	dbCon.Table("eth_wallet_buckets_local").AutoMigrate(&WalletBucket{})
+	dbCon.Table("eth_owed_tokens_local").AutoMigrate(&OwedTokens{})
+
+	// Tables created before several chains were supported are keyed by address or token ID only
+	if err := migratePrimaryKey(dbCon, "eth_liq_pools_local", "chain_id", "address"); err != nil {
+		return nil, fmt.Errorf("failed to migrate primary key of pools: %w", err)
+	}
+	if err := migratePrimaryKey(dbCon, "eth_positions_local", "chain_id", "token_id"); err != nil {
+		return nil, fmt.Errorf("failed to migrate primary key of positions: %w", err)
+	}
 	return ret, nil
 }
 
+// WithChain returns a view of the repository scoped to the given chain ID.
+// All reads are filtered by and all writes are tagged with the chain ID.
+func (r *Repository) WithChain(chainID int64) *Repository {
+	return &Repository{
+		dbCon:   r.dbCon,
+		chainID: chainID,
+	}
+}
+
 func (r *Repository) GetToken(address string) (repository.Token, bool) {
 	var token Token
-	result := r.dbCon.Table("eth_tokens_local").Limit(1).Find(&token, "address = ?", address)
+	result := r.dbCon.Table("eth_tokens_local").Limit(1).Find(&token, "chain_id = ? AND address = ?", r.chainID, address)
 	isTokenFound := result.RowsAffected != 0
 	if result.Error != nil {
 		log.Println("Error fetching Token from DB:", result.Error)
@@ -51,12 +79,14 @@ func (r *Repository) GetToken(address string) (repository.Token, bool) {
 		Symbol:   token.Symbol,
 		Name:     token.Name,
 		Decimals: token.Decimals,
+		Flags:    token.Flags,
+		Checked:  token.Checked,
 	}, isTokenFound
 }
 
 func (r *Repository) GetPoolPairAddresses(liqPoolAddress string) (string, string, bool) {
 	var liqPool Pool
-	result := r.dbCon.Table("eth_liq_pools_local").Limit(1).Find(&liqPool, "address = ?", liqPoolAddress)
+	result := r.dbCon.Table("eth_liq_pools_local").Limit(1).Find(&liqPool, "chain_id = ? AND address = ?", r.chainID, liqPoolAddress)
 	isPoolFound := result.RowsAffected != 0
 	if result.Error != nil {
 		log.Println("Error fetching Liq. Pool from DB:", result.Error)
@@ -64,31 +94,165 @@ func (r *Repository) GetPoolPairAddresses(liqPoolAddress string) (string, string
 	return liqPool.Token0Address, liqPool.Token1Address, isPoolFound
 }
 
+func (r *Repository) GetPoolFee(liqPoolAddress string) (int, bool) {
+	var liqPool Pool
+	result := r.dbCon.Table("eth_liq_pools_local").Limit(1).Find(&liqPool, "chain_id = ? AND address = ? AND fee > 0", r.chainID, liqPoolAddress)
+	if result.Error != nil {
+		log.Println("Error fetching Liq. Pool fee from DB:", result.Error)
+	}
+	return liqPool.Fee, result.RowsAffected != 0
+}
+
+func (r *Repository) GetPoolProtocol(liqPoolAddress string) (string, bool) {
+	var liqPool Pool
+	result := r.dbCon.Table("eth_liq_pools_local").Limit(1).Find(&liqPool, "chain_id = ? AND address = ? AND protocol <> ''", r.chainID, liqPoolAddress)
+	if result.Error != nil {
+		log.Println("Error fetching Liq. Pool protocol from DB:", result.Error)
+	}
+	return liqPool.Protocol, result.RowsAffected != 0
+}
+
+func (r *Repository) GetPosition(tokenID string) (repository.LiquidityPosition, bool) {
+	var pos LiquidityPosition
+	result := r.dbCon.Table("eth_positions_local").Limit(1).Find(&pos, "chain_id = ? AND token_id = ?", r.chainID, tokenID)
+	isPositionFound := result.RowsAffected != 0
+	if result.Error != nil {
+		log.Println("Error fetching Position from DB:", result.Error)
+	}
+	return repository.LiquidityPosition{
+		TokenID:         pos.TokenID,
+		Owner:           pos.Owner,
+		LPoolAddress:    pos.LPoolAddress,
+		LowerTick:       pos.LowerTick,
+		UpperTick:       pos.UpperTick,
+		Liquidity:       pos.Liquidity,
+		Token0Collected: pos.Token0Collected,
+		Token1Collected: pos.Token1Collected,
+		Token0Owed:      pos.Token0Owed,
+		Token1Owed:      pos.Token1Owed,
+	}, isPositionFound
+}
+
+func (r *Repository) GetOpenPositions(lpAddress string) []repository.LiquidityPosition {
+	var positions []LiquidityPosition
+	result := r.dbCon.Table("eth_positions_local").Find(&positions, "chain_id = ? AND l_pool_address = ? AND liquidity NOT IN ('', '0')", r.chainID, lpAddress)
+	if result.Error != nil {
+		log.Println("Error fetching open Positions from DB:", result.Error)
+	}
+	res := make([]repository.LiquidityPosition, 0, len(positions))
+	for _, pos := range positions {
+		res = append(res, repository.LiquidityPosition{
+			TokenID:         pos.TokenID,
+			Owner:           pos.Owner,
+			LPoolAddress:    pos.LPoolAddress,
+			LowerTick:       pos.LowerTick,
+			UpperTick:       pos.UpperTick,
+			Liquidity:       pos.Liquidity,
+			Token0Collected: pos.Token0Collected,
+			Token1Collected: pos.Token1Collected,
+			Token0Owed:      pos.Token0Owed,
+			Token1Owed:      pos.Token1Owed,
+		})
+	}
+	return res
+}
+
+func (r *Repository) GetOwedTokens(lpAddress, owner string, lowerTick, upperTick int) (repository.OwedTokens, bool) {
+	var owed OwedTokens
+	result := r.dbCon.Table("eth_owed_tokens_local").Limit(1).Find(&owed, "chain_id = ? AND l_pool_address = ? AND owner = ? AND lower_tick = ? AND upper_tick = ?",
+		r.chainID, lpAddress, owner, lowerTick, upperTick)
+	isOwedFound := result.RowsAffected != 0
+	if result.Error != nil {
+		log.Println("Error fetching Owed Tokens from DB:", result.Error)
+	}
+	return repository.OwedTokens{
+		LPoolAddress: owed.LPoolAddress,
+		Owner:        owed.Owner,
+		LowerTick:    owed.LowerTick,
+		UpperTick:    owed.UpperTick,
+		Token0Owed:   owed.Token0Owed,
+		Token1Owed:   owed.Token1Owed,
+	}, isOwedFound
+}
+
+func (r *Repository) GetPositionLedger(tokenID string) (repository.PositionLedger, bool) {
+	var ledger PositionLedger
+	result := r.dbCon.Table("eth_position_ledgers_local").Limit(1).Find(&ledger, "chain_id = ? AND token_id = ?", r.chainID, tokenID)
+	isLedgerFound := result.RowsAffected != 0
+	if result.Error != nil {
+		log.Println("Error fetching Position Ledger from DB:", result.Error)
+	}
+	return repository.PositionLedger{
+		TokenID:         ledger.TokenID,
+		LPoolAddress:    ledger.LPoolAddress,
+		OpenedAt:        ledger.OpenedAt,
+		Token0Address:   ledger.Token0Address,
+		Token0Symbol:    ledger.Token0Symbol,
+		Token1Address:   ledger.Token1Address,
+		Token1Symbol:    ledger.Token1Symbol,
+		Token0Deposited: ledger.Token0Deposited,
+		Token1Deposited: ledger.Token1Deposited,
+		Token0Withdrawn: ledger.Token0Withdrawn,
+		Token1Withdrawn: ledger.Token1Withdrawn,
+		Token0Fees:      ledger.Token0Fees,
+		Token1Fees:      ledger.Token1Fees,
+		DepositedUSD:    ledger.DepositedUSD,
+		WithdrawnUSD:    ledger.WithdrawnUSD,
+		FeesUSD:         ledger.FeesUSD,
+	}, isLedgerFound
+}
+
 func (r *Repository) AddToken(token repository.Token) error {
 	newToken := Token{
+		ChainID:  r.chainID,
 		Address:  token.Address,
 		Symbol:   token.Symbol,
 		Name:     token.Name,
 		Decimals: token.Decimals,
+		Flags:    token.Flags,
+		Checked:  token.Checked,
 	}
 	result := r.dbCon.Table("eth_tokens_local").Create(&newToken)
 	return result.Error
 }
 
+func (r *Repository) SaveTokenFlags(address string, flags string) error {
+	result := r.dbCon.Table("eth_tokens_local").Where("chain_id = ? AND address = ?", r.chainID, address).
+		Updates(map[string]any{"flags": flags, "checked": true})
+	return result.Error
+}
+
 func (r *Repository) SavePool(pool repository.Pool) error {
 	newPool := Pool{
+		ChainID:       r.chainID,
 		Address:       pool.Address,
 		Token0Address: pool.Token0Address,
 		Token1Address: pool.Token1Address,
+		Fee:           pool.Fee,
+		Protocol:      pool.Protocol,
+		TickSpacing:   pool.TickSpacing,
+		Hooks:         pool.Hooks,
 	}
 	result := r.dbCon.Clauses(clause.OnConflict{DoNothing: true}).Table("eth_liq_pools_local").Create(&newPool)
 	return result.Error
 }
 
+func (r *Repository) SavePoolFee(liqPoolAddress string, fee int) error {
+	result := r.dbCon.Table("eth_liq_pools_local").Where("chain_id = ? AND address = ?", r.chainID, liqPoolAddress).Update("fee", fee)
+	return result.Error
+}
+
+func (r *Repository) SavePoolFeeAPR(liqPoolAddress string, feeAPR float64) error {
+	result := r.dbCon.Table("eth_liq_pools_local").Where("chain_id = ? AND address = ?", r.chainID, liqPoolAddress).Update("fee_apr", feeAPR)
+	return result.Error
+}
+
 func (r *Repository) SaveAddition(lpAdd repository.Addition) error {
 	add := Addition{
+		ChainID:           r.chainID,
 		TimestampReceived: lpAdd.TimestampReceived,
 		LPoolAddress:      lpAdd.LPoolAddress,
+		TokenID:           lpAdd.TokenID,
 		Token0Symbol:      lpAdd.Token0Symbol,
 		Token1Symbol:      lpAdd.Token1Symbol,
 		Token0Amount:      lpAdd.Token0Amount,
@@ -97,6 +261,8 @@ func (r *Repository) SaveAddition(lpAdd repository.Addition) error {
 		UpperActualRatio:  lpAdd.UpperRatio,
 		Token0PriceUsd:    lpAdd.Token0PriceUsd,
 		Token1PriceUsd:    lpAdd.Token1PriceUsd,
+		Owner:             lpAdd.Owner,
+		Sender:            lpAdd.Sender,
 		TxHash:            lpAdd.TxHash,
 	}
 	result := r.dbCon.Table("eth_liq_adds_local").Create(&add)
@@ -105,8 +271,10 @@ func (r *Repository) SaveAddition(lpAdd repository.Addition) error {
 
 func (r *Repository) SaveRemoval(lpRem repository.Removal) error {
 	remove := Removal{
+		ChainID:           r.chainID,
 		TimestampReceived: lpRem.TimestampReceived,
 		LPoolAddress:      lpRem.LPoolAddress,
+		TokenID:           lpRem.TokenID,
 		Token0Symbol:      lpRem.Token0Symbol,
 		Token1Symbol:      lpRem.Token1Symbol,
 		Token0Amount:      lpRem.Token0Amount,
@@ -115,6 +283,8 @@ func (r *Repository) SaveRemoval(lpRem repository.Removal) error {
 		UpperActualRatio:  lpRem.UpperRatio,
 		Token0PriceUsd:    lpRem.Token0PriceUsd,
 		Token1PriceUsd:    lpRem.Token1PriceUsd,
+		Owner:             lpRem.Owner,
+		Recipient:         lpRem.Recipient,
 		TxHash:            lpRem.TxHash,
 	}
 	result := r.dbCon.Table("eth_liq_removals_local").Create(&remove)
@@ -123,14 +293,230 @@ func (r *Repository) SaveRemoval(lpRem repository.Removal) error {
 
 func (r *Repository) SaveSwap(sw repository.Swap) error {
 	remove := Swap{
+		ChainID:           r.chainID,
 		TimestampReceived: sw.TimestampReceived,
 		LPoolAddress:      sw.LPoolAddress,
 		TokenFromAddress:  sw.TokenFromAddress,
 		TokenFromAmount:   sw.TokenFromAmount,
 		TokenToAddress:    sw.TokenToAddress,
 		TokenToAmount:     sw.TokenToAmount,
+		ValueUSD:          sw.ValueUSD,
+		ExecutionPrice:    sw.ExecutionPrice,
+		PriceBefore:       sw.PriceBefore,
+		PriceAfter:        sw.PriceAfter,
+		PriceImpactBps:    sw.PriceImpactBps,
+		FeeTier:           sw.FeeTier,
+		FeeUSD:            sw.FeeUSD,
+		Sender:            sw.Sender,
+		Recipient:         sw.Recipient,
 		TxHash:            sw.TxHash,
 	}
 	result := r.dbCon.Table("eth_swaps_local").Create(&remove)
 	return result.Error
 }
+
+func (r *Repository) SaveFlashLoan(fl repository.FlashLoan) error {
+	flash := FlashLoan{
+		ChainID:           r.chainID,
+		TimestampReceived: fl.TimestampReceived,
+		LPoolAddress:      fl.LPoolAddress,
+		Token0Address:     fl.Token0Address,
+		Token0Amount:      fl.Token0Amount,
+		Token0Fee:         fl.Token0Fee,
+		Token1Address:     fl.Token1Address,
+		Token1Amount:      fl.Token1Amount,
+		Token1Fee:         fl.Token1Fee,
+		ValueUSD:          fl.ValueUSD,
+		FeeUSD:            fl.FeeUSD,
+		Sender:            fl.Sender,
+		Recipient:         fl.Recipient,
+		Purpose:           fl.Purpose,
+		TxHash:            fl.TxHash,
+	}
+	result := r.dbCon.Table("eth_flash_loans_local").Create(&flash)
+	return result.Error
+}
+
+func (r *Repository) SavePosition(pos repository.LiquidityPosition) error {
+	position := LiquidityPosition{
+		ChainID:         r.chainID,
+		TokenID:         pos.TokenID,
+		Owner:           pos.Owner,
+		LPoolAddress:    pos.LPoolAddress,
+		LowerTick:       pos.LowerTick,
+		UpperTick:       pos.UpperTick,
+		Liquidity:       pos.Liquidity,
+		Token0Collected: pos.Token0Collected,
+		Token1Collected: pos.Token1Collected,
+		Token0Owed:      pos.Token0Owed,
+		Token1Owed:      pos.Token1Owed,
+	}
+	result := r.dbCon.Clauses(clause.OnConflict{UpdateAll: true}).Table("eth_positions_local").Create(&position)
+	return result.Error
+}
+
+func (r *Repository) SavePositionLedger(ledger repository.PositionLedger) error {
+	newLedger := PositionLedger{
+		ChainID:         r.chainID,
+		TokenID:         ledger.TokenID,
+		LPoolAddress:    ledger.LPoolAddress,
+		OpenedAt:        ledger.OpenedAt,
+		Token0Address:   ledger.Token0Address,
+		Token0Symbol:    ledger.Token0Symbol,
+		Token1Address:   ledger.Token1Address,
+		Token1Symbol:    ledger.Token1Symbol,
+		Token0Deposited: ledger.Token0Deposited,
+		Token1Deposited: ledger.Token1Deposited,
+		Token0Withdrawn: ledger.Token0Withdrawn,
+		Token1Withdrawn: ledger.Token1Withdrawn,
+		Token0Fees:      ledger.Token0Fees,
+		Token1Fees:      ledger.Token1Fees,
+		DepositedUSD:    ledger.DepositedUSD,
+		WithdrawnUSD:    ledger.WithdrawnUSD,
+		FeesUSD:         ledger.FeesUSD,
+	}
+	result := r.dbCon.Clauses(clause.OnConflict{UpdateAll: true}).Table("eth_position_ledgers_local").Create(&newLedger)
+	return result.Error
+}
+
+func (r *Repository) SavePositionReport(report repository.PositionReport) error {
+	newReport := PositionReport{
+		ChainID:            r.chainID,
+		TokenID:            report.TokenID,
+		Owner:              report.Owner,
+		LPoolAddress:       report.LPoolAddress,
+		OpenedAt:           report.OpenedAt,
+		Token0Address:      report.Token0Address,
+		Token0Symbol:       report.Token0Symbol,
+		Token1Address:      report.Token1Address,
+		Token1Symbol:       report.Token1Symbol,
+		Token0Deposited:    report.Token0Deposited,
+		Token1Deposited:    report.Token1Deposited,
+		Token0Withdrawn:    report.Token0Withdrawn,
+		Token1Withdrawn:    report.Token1Withdrawn,
+		Token0Fees:         report.Token0Fees,
+		Token1Fees:         report.Token1Fees,
+		DepositedUSD:       report.DepositedUSD,
+		WithdrawnUSD:       report.WithdrawnUSD,
+		FeesUSD:            report.FeesUSD,
+		ClosedAt:           report.ClosedAt,
+		HodlUSD:            report.HodlUSD,
+		ImpermanentLossUSD: report.ImpermanentLossUSD,
+		ImpermanentLoss:    report.ImpermanentLoss,
+		PnlUSD:             report.PnlUSD,
+		TxHash:             report.TxHash,
+	}
+	result := r.dbCon.Table("eth_position_reports_local").Create(&newReport)
+	return result.Error
+}
+
+func (r *Repository) SaveCandle(c repository.Candle) error {
+	newCandle := Candle{
+		ChainID:      r.chainID,
+		LPoolAddress: c.LPoolAddress,
+		Interval:     c.Interval,
+		OpenTime:     c.OpenTime,
+		CloseTime:    c.CloseTime,
+		BaseSymbol:   c.BaseSymbol,
+		QuoteSymbol:  c.QuoteSymbol,
+		Open:         c.Open,
+		High:         c.High,
+		Low:          c.Low,
+		Close:        c.Close,
+		VolumeBase:   c.VolumeBase,
+		VolumeQuote:  c.VolumeQuote,
+		VolumeUSD:    c.VolumeUSD,
+		Trades:       c.Trades,
+	}
+	result := r.dbCon.Table("eth_candles_local").Create(&newCandle)
+	return result.Error
+}
+
+func (r *Repository) GetTickLiquidity() []repository.TickLiquidity {
+	var ticks []repository.TickLiquidity
+	result := r.dbCon.Raw(`SELECT l_pool_address, tick, SUM(liquidity)::text AS liquidity FROM (
+			SELECT LOWER(l_pool_address) AS l_pool_address, lower_tick AS tick, liquidity::numeric AS liquidity
+			FROM eth_liquidity_changes_local WHERE chain_id = ?
+			UNION ALL
+			SELECT LOWER(l_pool_address), upper_tick, -liquidity::numeric
+			FROM eth_liquidity_changes_local WHERE chain_id = ?
+		) AS changes
+		GROUP BY l_pool_address, tick
+		HAVING SUM(liquidity) <> 0`, r.chainID, r.chainID).Scan(&ticks)
+	if result.Error != nil {
+		log.Println("Error fetching Tick Liquidity from DB:", result.Error)
+	}
+	return ticks
+}
+
+func (r *Repository) SaveLiquidityChange(change repository.LiquidityChange) (bool, error) {
+	newChange := LiquidityChange{
+		ChainID:      r.chainID,
+		TxHash:       change.TxHash,
+		LogIndex:     change.LogIndex,
+		LPoolAddress: change.LPoolAddress,
+		LowerTick:    change.LowerTick,
+		UpperTick:    change.UpperTick,
+		Liquidity:    change.Liquidity,
+	}
+	result := r.dbCon.Clauses(clause.OnConflict{DoNothing: true}).Table("eth_liquidity_changes_local").Create(&newChange)
+	return result.RowsAffected != 0, result.Error
+}
+
+func (r *Repository) SaveOwedTokens(owed repository.OwedTokens) error {
+	newOwed := OwedTokens{
+		ChainID:      r.chainID,
+		LPoolAddress: owed.LPoolAddress,
+		Owner:        owed.Owner,
+		LowerTick:    owed.LowerTick,
+		UpperTick:    owed.UpperTick,
+		Token0Owed:   owed.Token0Owed,
+		Token1Owed:   owed.Token1Owed,
+	}
+	result := r.dbCon.Clauses(clause.OnConflict{UpdateAll: true}).Table("eth_owed_tokens_local").Create(&newOwed)
+	return result.Error
+}
+
+func (r *Repository) SaveWalletStats(stats []repository.WalletStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	rows := make([]WalletStats, 0, len(stats))
+	for _, s := range stats {
+		rows = append(rows, WalletStats{
+			ChainID:      r.chainID,
+			Address:      s.Address,
+			Window:       s.Window,
+			LiquidityUSD: s.LiquidityUSD,
+			FeesUSD:      s.FeesUSD,
+			VolumeUSD:    s.VolumeUSD,
+			Pools:        s.Pools,
+			UpdatedAt:    s.UpdatedAt,
+		})
+	}
+	result := r.dbCon.Clauses(clause.OnConflict{UpdateAll: true}).Table("eth_wallet_stats_local").CreateInBatches(&rows, 500)
+	return result.Error
+}
+
+func (r *Repository) GetWalletBuckets(since time.Time) []repository.WalletBucket {
+	var buckets []repository.WalletBucket
+	result := r.dbCon.Table("eth_wallet_buckets_local").Order("start").Find(&buckets, "chain_id = ? AND start > ?", r.chainID, since)
+	if result.Error != nil {
+		log.Println("Error fetching Wallet Buckets from DB:", result.Error)
+	}
+	return buckets
+}
+
+func (r *Repository) SaveWalletBucket(bucket repository.WalletBucket) error {
+	newBucket := WalletBucket{
+		ChainID:      r.chainID,
+		Address:      bucket.Address,
+		Start:        bucket.Start,
+		LiquidityUSD: bucket.LiquidityUSD,
+		FeesUSD:      bucket.FeesUSD,
+		VolumeUSD:    bucket.VolumeUSD,
+		Pools:        bucket.Pools,
+	}
+	result := r.dbCon.Clauses(clause.OnConflict{UpdateAll: true}).Table("eth_wallet_buckets_local").Create(&newBucket)
+	return result.Error
+}
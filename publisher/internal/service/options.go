@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	svcnats "github.com/Synternet/pubsub-go/pubsub"
+	"github.com/Synternet/swapscope/publisher/internal/webhook"
 	"github.com/Synternet/swapscope/publisher/pkg/analytics"
 )
 
@@ -13,8 +14,9 @@ type Options struct {
 	prefix     string
 	natsSub    *svcnats.NatsService
 	natsPub    *svcnats.NatsService
-	analytics  analytics.Analytics
+	analytics  []analytics.Analytics
 	bufferSize int
+	webhooks   *webhook.Sink
 }
 
 func (o *Options) SetDefaults() {
@@ -63,12 +65,26 @@ func WithNATS(snSub *svcnats.NatsService, snPub *svcnats.NatsService) Option {
 	}
 }
 
-func WithAnalytics(a analytics.Analytics) Option {
+// WithWebhooks sets webhook sink that receives published messages in addition to NATS.
+func WithWebhooks(sink *webhook.Sink) Option {
 	return func(o *Options) error {
-		if a == nil {
-			return fmt.Errorf("analytics must not be nil")
+		if sink == nil {
+			return fmt.Errorf("webhook sink must not be nil")
+		}
+		o.webhooks = sink
+		return nil
+	}
+}
+
+// WithAnalytics adds analytics modules to the service. Can be used multiple times, e.g. one module per chain.
+func WithAnalytics(modules ...analytics.Analytics) Option {
+	return func(o *Options) error {
+		for _, a := range modules {
+			if a == nil {
+				return fmt.Errorf("analytics must not be nil")
+			}
+			o.analytics = append(o.analytics, a)
 		}
-		o.analytics = a
 		return nil
 	}
 }
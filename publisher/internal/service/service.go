@@ -54,6 +54,9 @@ func (s *Service) publish(msg any, subjects ...string) error {
 	}
 
 	log.Printf("Publishing to: %s\n\n", fullStreamName)
+	if s.webhooks != nil {
+		s.webhooks.Send(fullStreamName, messageJson)
+	}
 	return s.natsPub.Publish(s.ctx, fullStreamName, messageJson)
 }
 
@@ -100,17 +103,30 @@ func (s *Service) Serve() {
 	rungroup, groupCtx := errgroup.WithContext(s.ctx)
 	s.doneCtx = groupCtx
 
-	for subject, handler := range s.analytics.Handlers() {
-		s.natsSub.AddHandlerWithSubject(
-			subject,
-			s.makeBufferedHandler(rungroup, subject, handler),
-		)
+	for _, a := range s.analytics {
+		for subject, handler := range a.Handlers() {
+			s.natsSub.AddHandlerWithSubject(
+				subject,
+				s.makeBufferedHandler(rungroup, subject, handler),
+			)
+		}
+		if runner, ok := a.(analytics.Runner); ok {
+			rungroup.Go(func() error {
+				return runner.Run(groupCtx, s.publish)
+			})
+		}
 	}
 
 	rungroup.Go(func() error {
 		return s.natsPub.Serve(groupCtx)
 	})
 
+	if s.webhooks != nil {
+		rungroup.Go(func() error {
+			return s.webhooks.Run(groupCtx)
+		})
+	}
+
 	rungroup.Go(func() error {
 		return s.natsSub.Serve(groupCtx)
 	})
@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// retryQueue keeps batches until they are delivered, in FIFO order. The oldest batches are dropped when the queue is full.
+// If path is set, the queue is written to the file on every change and loaded on creation.
+type retryQueue struct {
+	mu      sync.Mutex
+	path    string
+	max     int
+	batches []Batch
+	removed uint64 // Number of batches removed from the queue, position of the head batch
+}
+
+func newRetryQueue(path string, max int) (*retryQueue, error) {
+	q := &retryQueue{path: path, max: max}
+	if path == "" {
+		return q, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retry queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &q.batches); err != nil {
+		return nil, fmt.Errorf("failed to parse retry queue: %w", err)
+	}
+	return q, nil
+}
+
+func (q *retryQueue) Push(batch Batch) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.batches = append(q.batches, batch)
+	if dropped := len(q.batches) - q.max; dropped > 0 {
+		log.Printf("Webhook retry queue is full, %d oldest batches dropped", dropped)
+		q.batches = q.batches[dropped:]
+		q.removed += uint64(dropped)
+	}
+	q.save()
+}
+
+// Peek returns the oldest batch and its position in the queue.
+func (q *retryQueue) Peek() (Batch, uint64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.batches) == 0 {
+		return Batch{}, 0, false
+	}
+	return q.batches[0], q.removed, true
+}
+
+// Pop removes the delivered batch, unless it was already dropped from the full queue while it was being delivered.
+func (q *retryQueue) Pop(position uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.batches) == 0 || position != q.removed {
+		return
+	}
+	q.batches = q.batches[1:]
+	q.removed++
+	q.save()
+}
+
+func (q *retryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.batches)
+}
+
+// save writes the queue to a temporary file and renames it, so that the queue file is never partially written.
+func (q *retryQueue) save() {
+	if q.path == "" {
+		return
+	}
+	data, err := json.Marshal(q.batches)
+	if err != nil {
+		log.Println("Failed to marshal webhook retry queue:", err)
+		return
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		log.Println("Failed to write webhook retry queue:", err)
+		return
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		log.Println("Failed to write webhook retry queue:", err)
+	}
+}
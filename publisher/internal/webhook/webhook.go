@@ -0,0 +1,311 @@
+// Package webhook delivers published messages to HTTP endpoints for consumers that can't use NATS.
+//
+// Endpoints are declared in a JSON file. Messages whose subject matches any of the endpoint subject patterns
+// (NATS wildcards: `*` matches a single token, `>` matches the rest) are POSTed in batches:
+//
+//	{
+//	  "queueDir": "/var/lib/swapscope/webhooks",
+//	  "endpoints": [
+//	    {"name": "alerts", "url": "https://example.org/hook", "secret": "...", "subjects": ["*.*.*.alerts.>"], "batchSize": 20, "batchInterval": "5s"}
+//	  ]
+//	}
+//
+// Request body is {"messages": [{"subject": ..., "data": ...}]} signed with HMAC-SHA256 of the endpoint secret
+// in the X-Signature-256 header (sha256=<hex>). Batches are delivered in order from a bounded queue: a failed batch
+// is retried with backoff before the next one is sent. The queue is persisted to queueDir (if set) so that
+// undelivered batches survive restarts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/internal/config"
+)
+
+const (
+	SignatureHeader = "X-Signature-256"
+
+	defaultBatchSize     = 50
+	defaultBatchInterval = 5 * time.Second
+	defaultMaxQueue      = 1000
+	incomingBufferSize   = 1000
+	initialBackoff       = time.Second
+	maxBackoff           = 5 * time.Minute
+)
+
+var endpointNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`) // Endpoint name is used in the queue file name
+
+type Endpoint struct {
+	Name          string          `json:"name"`
+	URL           string          `json:"url"`
+	Secret        string          `json:"secret"`
+	Subjects      []string        `json:"subjects"`
+	BatchSize     int             `json:"batchSize"`
+	BatchInterval config.Duration `json:"batchInterval"`
+}
+
+type Config struct {
+	QueueDir  string     `json:"queueDir"`
+	MaxQueue  int        `json:"maxQueue"` // Maximum number of undelivered batches kept in the queue of an endpoint
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+type Message struct {
+	Subject string          `json:"subject"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type Batch struct {
+	Messages []Message `json:"messages"`
+}
+
+type Sink struct {
+	client    *http.Client
+	endpoints []*endpoint
+}
+
+type endpoint struct {
+	Endpoint
+	client   *http.Client
+	incoming chan Message
+	queue    *retryQueue
+	queued   chan struct{} // Signals delivery that a batch was queued
+}
+
+// New creates webhook sink from given config.
+func New(cfg Config) (*Sink, error) {
+	if cfg.MaxQueue <= 0 {
+		cfg.MaxQueue = defaultMaxQueue
+	}
+	ret := &Sink{client: &http.Client{Timeout: 10 * time.Second}}
+	for _, e := range cfg.Endpoints {
+		if !endpointNamePattern.MatchString(e.Name) {
+			return nil, fmt.Errorf("endpoint %q: name must consist of letters, digits, '-' and '_'", e.Name)
+		}
+		if e.URL == "" || len(e.Subjects) == 0 {
+			return nil, fmt.Errorf("endpoint %q: url and subjects must be set", e.Name)
+		}
+		if e.BatchSize <= 0 {
+			e.BatchSize = defaultBatchSize
+		}
+		if e.BatchInterval <= 0 {
+			e.BatchInterval = config.Duration(defaultBatchInterval)
+		}
+		queuePath := ""
+		if cfg.QueueDir != "" {
+			queuePath = filepath.Join(cfg.QueueDir, e.Name+".queue.json")
+		}
+		queue, err := newRetryQueue(queuePath, cfg.MaxQueue)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %q: %w", e.Name, err)
+		}
+		ret.endpoints = append(ret.endpoints, &endpoint{
+			Endpoint: e,
+			client:   ret.client,
+			incoming: make(chan Message, incomingBufferSize),
+			queue:    queue,
+			queued:   make(chan struct{}, 1),
+		})
+	}
+	return ret, nil
+}
+
+// Load creates webhook sink from config file.
+func Load(path string) (*Sink, error) {
+	cfg, err := config.Read[Config](path, "webhooks")
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// Send queues message for every endpoint whose subject patterns match. It never blocks - messages are dropped
+// if the endpoint can't keep up.
+func (s *Sink) Send(subject string, data []byte) {
+	for _, e := range s.endpoints {
+		if !e.matches(subject) {
+			continue
+		}
+		select {
+		case e.incoming <- Message{Subject: subject, Data: data}:
+		default:
+			log.Printf("Webhook %q buffer overflow, message of %s dropped", e.Name, subject)
+		}
+	}
+}
+
+// Run delivers messages until the context is done.
+func (s *Sink) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, e := range s.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			e.run(ctx)
+		}(e)
+	}
+	wg.Wait()
+	return nil
+}
+
+func (e *endpoint) matches(subject string) bool {
+	for _, pattern := range e.Subjects {
+		if matchSubject(pattern, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// run batches incoming messages into the queue and delivers queued batches until the context is done.
+func (e *endpoint) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		e.deliver(ctx)
+	}()
+	e.batch(ctx)
+	wg.Wait()
+}
+
+// batch queues incoming messages in batches of BatchSize, or every BatchInterval. Delivery does not block it,
+// so incoming messages are drained even if the endpoint is down. Messages still incoming when the context is done
+// are queued too, so that they are delivered on the next start if the queue is persisted.
+func (e *endpoint) batch(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(e.BatchInterval))
+	defer ticker.Stop()
+
+	var pending []Message
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case msg := <-e.incoming:
+					pending = append(pending, msg)
+				default:
+					e.enqueue(pending)
+					return
+				}
+			}
+		case msg := <-e.incoming:
+			pending = append(pending, msg)
+			if len(pending) < e.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		e.enqueue(pending)
+		pending = nil
+	}
+}
+
+func (e *endpoint) enqueue(messages []Message) {
+	for len(messages) > 0 {
+		size := min(len(messages), e.BatchSize)
+		e.queue.Push(Batch{Messages: messages[:size]})
+		messages = messages[size:]
+	}
+	select {
+	case e.queued <- struct{}{}:
+	default:
+	}
+}
+
+// deliver posts queued batches in order. Failed batch is retried with backoff and blocks the batches queued after it.
+func (e *endpoint) deliver(ctx context.Context) {
+	backoff := initialBackoff
+	for {
+		batch, position, found := e.queue.Peek()
+		if !found {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.queued:
+			}
+			continue
+		}
+		if err := e.post(ctx, batch); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Webhook %q delivery of %d messages failed, retry in %s: %s", e.Name, len(batch.Messages), backoff, err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			continue
+		}
+		e.queue.Pop(position)
+		backoff = initialBackoff
+	}
+}
+
+func (e *endpoint) post(ctx context.Context, batch Batch) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(e.Secret, body))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns hex encoded HMAC-SHA256 of the body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// matchSubject matches subject against NATS style pattern: `*` matches a single token, `>` matches one or more tokens.
+func matchSubject(pattern, subject string) bool {
+	patternTokens, subjectTokens := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && !strings.EqualFold(token, subjectTokens[i])) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+func min[T int | time.Duration](a, b T) T {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Synternet/swapscope/publisher/internal/config"
+)
+
+func Test_matchSubject(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		trueRes bool
+	}{
+		{"synternet.analytics.ethereum.swap.*", "synternet.analytics.ethereum.swap.0x88e6", true},
+		{"synternet.analytics.*.alerts.>", "synternet.analytics.arbitrum.alerts.whale-removal", true},
+		{"synternet.analytics.*.alerts.>", "synternet.analytics.arbitrum.alerts", false},
+		{"synternet.analytics.ethereum.swap.*", "synternet.analytics.ethereum.swap", false},
+		{"synternet.analytics.ethereum.add", "synternet.analytics.ethereum.add.0x88e6", false},
+		{"Synternet.Analytics.>", "synternet.analytics.ethereum.add.0x88e6", true},
+	}
+	for _, test := range tests {
+		if res := matchSubject(test.pattern, test.subject); res != test.trueRes {
+			t.Errorf("matchSubject(%v, %v) = (%v); expected (%v)", test.pattern, test.subject, res, test.trueRes)
+		}
+	}
+}
+
+func Test_SinkDelivery(t *testing.T) {
+	var requests atomic.Int32
+	received := make(chan Batch, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 { // First attempt fails
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if signature := r.Header.Get(SignatureHeader); signature != "sha256="+Sign("secret", body) {
+			t.Errorf("signature = (%v); expected (%v)", signature, "sha256="+Sign("secret", body))
+		}
+		var batch Batch
+		if err := json.Unmarshal(body, &batch); err != nil {
+			t.Errorf("failed to parse body: %s", err)
+		}
+		received <- batch
+	}))
+	defer server.Close()
+
+	sink, err := New(Config{Endpoints: []Endpoint{{
+		Name:          "test",
+		URL:           server.URL,
+		Secret:        "secret",
+		Subjects:      []string{"prefix.*.alerts.>"},
+		BatchSize:     2,
+		BatchInterval: config.Duration(time.Hour),
+	}}})
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sink.Run(ctx)
+
+	sink.Send("prefix.ethereum.swap.0x1", []byte(`{"skipped":true}`))
+	sink.Send("prefix.ethereum.alerts.whale", []byte(`{"n":1}`))
+	sink.Send("prefix.ethereum.alerts.whale", []byte(`{"n":2}`))
+
+	select {
+	case batch := <-received:
+		if len(batch.Messages) != 2 || string(batch.Messages[1].Data) != `{"n":2}` {
+			t.Errorf("delivered batch = (%+v); expected 2 alert messages", batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("batch was not delivered")
+	}
+}
+
+func Test_retryQueuePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.queue.json")
+	q, err := newRetryQueue(path, 2)
+	if err != nil {
+		t.Fatalf("newRetryQueue(%v) failed: %s", path, err)
+	}
+	for _, subject := range []string{"a", "b", "c"} {
+		q.Push(Batch{Messages: []Message{{Subject: subject, Data: json.RawMessage(`{}`)}}})
+	}
+
+	loaded, err := newRetryQueue(path, 2)
+	if err != nil {
+		t.Fatalf("newRetryQueue(%v) failed: %s", path, err)
+	}
+	if loaded.Len() != 2 {
+		t.Fatalf("loaded queue length = (%d); expected (2)", loaded.Len())
+	}
+	if head, _, _ := loaded.Peek(); head.Messages[0].Subject != "b" {
+		t.Errorf("queue head = (%v); expected (b) - oldest batch should be dropped", head.Messages[0].Subject)
+	}
+}
+
+func Test_SinkShutdownQueuesIncoming(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := New(Config{QueueDir: dir, Endpoints: []Endpoint{{
+		Name:          "test",
+		URL:           "http://127.0.0.1:0",
+		Subjects:      []string{">"},
+		BatchSize:     2,
+		BatchInterval: config.Duration(time.Hour),
+	}}})
+	if err != nil {
+		t.Fatalf("New() failed: %s", err)
+	}
+	for _, subject := range []string{"a", "b", "c"} {
+		sink.Send(subject, []byte(`{}`))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink.Run(ctx)
+
+	q, err := newRetryQueue(filepath.Join(dir, "test.queue.json"), defaultMaxQueue)
+	if err != nil {
+		t.Fatalf("newRetryQueue() failed: %s", err)
+	}
+	var subjects []string
+	for batch, position, found := q.Peek(); found; batch, position, found = q.Peek() {
+		for _, msg := range batch.Messages {
+			subjects = append(subjects, msg.Subject)
+		}
+		q.Pop(position)
+	}
+	if len(subjects) != 3 || subjects[0] != "a" || subjects[2] != "c" {
+		t.Errorf("queued subjects = (%v); expected ([a b c])", subjects)
+	}
+}
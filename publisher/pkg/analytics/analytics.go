@@ -1,6 +1,9 @@
 package analytics
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Message struct {
 	Timestamp time.Time
@@ -16,3 +19,9 @@ type Analytics interface {
 	// It is expected for the service to subscribe to these subjects and call the handler.
 	Handlers() map[string]Handler
 }
+
+// Runner is implemented by analytics modules that also publish on their own schedule, e.g. periodic snapshots.
+type Runner interface {
+	// Run blocks until the context is done. It is expected for the service to run it alongside the handlers.
+	Run(ctx context.Context, sender Sender) error
+}
@@ -1,14 +1,46 @@
 package repository
 
+import "time"
+
 type Repository interface {
 	// GetToken returns the latest token record for the given token address
 	GetToken(address string) (Token, bool)
 	// GetPoolPairAddresses returns the addresses of the tokens that are used in the liquidity pool
 	GetPoolPairAddresses(lpAddress string) (string, string, bool)
+	// GetPoolFee returns fee tier of the liquidity pool, if known
+	GetPoolFee(lpAddress string) (int, bool)
+	// GetPoolProtocol returns protocol of the liquidity pool, if known
+	GetPoolProtocol(lpAddress string) (string, bool)
+	// GetPosition returns the position NFT with the given token ID
+	GetPosition(tokenID string) (LiquidityPosition, bool)
+	// GetOpenPositions returns position NFTs of the liquidity pool that still have liquidity
+	GetOpenPositions(lpAddress string) []LiquidityPosition
+	// GetPositionLedger returns the ledger of the open position NFT with the given token ID
+	GetPositionLedger(tokenID string) (PositionLedger, bool)
+	// GetTickLiquidity returns net liquidity of initialized ticks of all pools, summed up from stored liquidity changes
+	GetTickLiquidity() []TickLiquidity
+	// GetOwedTokens returns tokens owed to the owner of the pool tick range
+	GetOwedTokens(lpAddress, owner string, lowerTick, upperTick int) (OwedTokens, bool)
+	// GetWalletBuckets returns hourly wallet activity buckets started after the given time
+	GetWalletBuckets(since time.Time) []WalletBucket
 
 	AddToken(newToken Token) error
+	// SaveTokenFlags stores reputation flags of the token and marks it as checked
+	SaveTokenFlags(address string, flags string) error
 	SavePool(pool Pool) error
+	SavePoolFee(lpAddress string, fee int) error
+	SavePoolFeeAPR(lpAddress string, feeAPR float64) error
 	SaveAddition(add Addition) error
 	SaveRemoval(rem Removal) error
 	SaveSwap(sw Swap) error
+	SaveFlashLoan(flash FlashLoan) error
+	SavePosition(pos LiquidityPosition) error
+	SavePositionLedger(ledger PositionLedger) error
+	SavePositionReport(report PositionReport) error
+	SaveCandle(c Candle) error
+	// SaveLiquidityChange stores the change and reports whether it was new (not stored before, e.g. by a replayed log)
+	SaveLiquidityChange(change LiquidityChange) (bool, error)
+	SaveOwedTokens(owed OwedTokens) error
+	SaveWalletStats(stats []WalletStats) error
+	SaveWalletBucket(bucket WalletBucket) error
 }
@@ -13,17 +13,74 @@ type Token struct {
 	Name        string
 	Decimals    int
 	TotalSupply float64
+	Flags       string // Comma separated reputation flags of spam and scam tokens, empty for reputable tokens
+	Checked     bool   // Reputation was checked. Tokens stored before reputation checks are not flagged yet
 }
 
 type Pool struct {
 	Address       string
 	Token0Address string
 	Token1Address string
+	Fee           int     // Fee tier in hundredths of a bip, 0 if unknown
+	FeeAPR        float64 // Rolling 24h fee APR estimate, 0 if unknown
+	Protocol      string  // e.g. uniswap-v3, empty for pools recorded before protocols were tracked
+	TickSpacing   int     // Uniswap V4 pool key, 0 for other pools
+	Hooks         string  // Uniswap V4 hooks contract, empty if none or not a V4 pool
+}
+
+// LiquidityPosition is a Uniswap V3 position NFT of the positions manager.
+// Liquidity and collected amounts are raw (not scaled by decimals) integers in decimal notation.
+type LiquidityPosition struct {
+	TokenID         string
+	Owner           string
+	LPoolAddress    string
+	LowerTick       int
+	UpperTick       int
+	Liquidity       string
+	Token0Collected string
+	Token1Collected string
+	Token0Owed      string // Withdrawn by DecreaseLiquidity and not collected yet
+	Token1Owed      string
+}
+
+// PositionLedger accumulates deposits, withdrawals and fees of an open position NFT.
+// Token amounts are scaled by decimals, USD values are taken at the time of each operation.
+type PositionLedger struct {
+	TokenID         string
+	LPoolAddress    string
+	OpenedAt        time.Time
+	Token0Address   string
+	Token0Symbol    string
+	Token1Address   string
+	Token1Symbol    string
+	Token0Deposited float64
+	Token1Deposited float64
+	Token0Withdrawn float64
+	Token1Withdrawn float64
+	Token0Fees      float64
+	Token1Fees      float64
+	DepositedUSD    float64
+	WithdrawnUSD    float64
+	FeesUSD         float64
+}
+
+// PositionReport is the result of a closed position NFT.
+// HODL value and impermanent loss are valued at the prices of position exit.
+type PositionReport struct {
+	PositionLedger
+	Owner              string
+	ClosedAt           time.Time
+	HodlUSD            float64
+	ImpermanentLossUSD float64
+	ImpermanentLoss    float64
+	PnlUSD             float64
+	TxHash             string
 }
 
 type Addition struct {
 	TimestampReceived time.Time
 	LPoolAddress      string
+	TokenID           string
 	Token0Symbol      string
 	Token1Symbol      string
 	Token0Amount      float64
@@ -32,12 +89,15 @@ type Addition struct {
 	UpperRatio        float64
 	Token0PriceUsd    float64
 	Token1PriceUsd    float64
+	Owner             string
+	Sender            string
 	TxHash            string
 }
 
 type Removal struct {
 	TimestampReceived time.Time
 	LPoolAddress      string
+	TokenID           string
 	Token0Symbol      string
 	Token1Symbol      string
 	Token0Amount      float64
@@ -46,6 +106,8 @@ type Removal struct {
 	UpperRatio        float64
 	Token0PriceUsd    float64
 	Token1PriceUsd    float64
+	Owner             string
+	Recipient         string
 	TxHash            string
 }
 
@@ -56,5 +118,101 @@ type Swap struct {
 	TokenFromAmount   float64
 	TokenToAddress    string
 	TokenToAmount     float64
+	ValueUSD          float64
+	ExecutionPrice    float64
+	PriceBefore       float64
+	PriceAfter        float64
+	PriceImpactBps    float64
+	FeeTier           int
+	FeeUSD            float64
+	Sender            string
+	Recipient         string
+	TxHash            string
+}
+
+// FlashLoan is a flash loan of pool tokens. Amounts are borrowed amounts, fees are paid on top of them.
+type FlashLoan struct {
+	TimestampReceived time.Time
+	LPoolAddress      string
+	Token0Address     string
+	Token0Amount      float64
+	Token0Fee         float64
+	Token1Address     string
+	Token1Amount      float64
+	Token1Fee         float64
+	ValueUSD          float64
+	FeeUSD            float64
+	Sender            string
+	Recipient         string
+	Purpose           string
 	TxHash            string
 }
+
+// Candle is OHLCV aggregate of pool swaps during one interval.
+type Candle struct {
+	LPoolAddress string
+	Interval     string
+	OpenTime     time.Time
+	CloseTime    time.Time
+	BaseSymbol   string
+	QuoteSymbol  string
+	Open         float64
+	High         float64
+	Low          float64
+	Close        float64
+	VolumeBase   float64
+	VolumeQuote  float64
+	VolumeUSD    float64
+	Trades       int
+}
+
+// LiquidityChange is liquidity added (Mint) or removed (Burn, negative) in a tick range of a pool.
+// Liquidity is a raw integer in decimal notation.
+type LiquidityChange struct {
+	LPoolAddress string
+	TxHash       string
+	LogIndex     uint64
+	LowerTick    int
+	UpperTick    int
+	Liquidity    string
+}
+
+// TickLiquidity is net liquidity change of a pool when the price crosses the tick upwards: liquidity added at
+// the tick as the lower tick of ranges minus liquidity added at it as the upper tick. Raw integer in decimal notation.
+type TickLiquidity struct {
+	LPoolAddress string
+	Tick         int
+	Liquidity    string
+}
+
+// OwedTokens are tokens withdrawn by Burn from a tick range of a pool owned directly (not via positions manager)
+// and not collected yet. Amounts are raw integers in decimal notation, in pool token order.
+type OwedTokens struct {
+	LPoolAddress string
+	Owner        string
+	LowerTick    int
+	UpperTick    int
+	Token0Owed   string
+	Token1Owed   string
+}
+
+// WalletStats is rolling activity of a wallet over a window, e.g. "24h" or "7d".
+type WalletStats struct {
+	Address      string
+	Window       string
+	LiquidityUSD float64
+	FeesUSD      float64
+	VolumeUSD    float64
+	Pools        int
+	UpdatedAt    time.Time
+}
+
+// WalletBucket is activity of a wallet during one hour starting at Start, wallet stats windows are summed up from them.
+type WalletBucket struct {
+	Address      string
+	Start        time.Time
+	LiquidityUSD float64
+	FeesUSD      float64
+	VolumeUSD    float64
+	Pools        string // Comma separated addresses of the pools touched
+}
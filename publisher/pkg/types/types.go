@@ -6,18 +6,28 @@ import (
 
 type AdditionMessage struct {
 	Timestamp         time.Time       `json:"timestamp"`
+	ChainID           int64           `json:"chainId"`
+	Protocol          string          `json:"protocol"`
 	Address           string          `json:"address"`
+	TokenID           string          `json:"tokenId,omitempty"`
 	LowerTokenRatio   float64         `json:"lowerTokenRatio"`
 	CurrentTokenRatio float64         `json:"currentTokenRatio"`
 	UpperTokenRatio   float64         `json:"upperTokenRatio"`
 	ValueAddedUSD     float64         `json:"totalValueUSD"`
 	Pair              [2]TokenMessage `json:"pair"`
+	Owner             string          `json:"owner"`
+	Sender            string          `json:"sender"`
 	TxHash            string          `json:"txHash"`
+	JIT               bool            `json:"jit,omitempty"`
+	FlashLoan         bool            `json:"flashLoan,omitempty"`
 }
 
 type RemovalMessage struct {
 	Timestamp         time.Time       `json:"timestamp"`
+	ChainID           int64           `json:"chainId"`
+	Protocol          string          `json:"protocol"`
 	Address           string          `json:"address"`
+	TokenID           string          `json:"tokenId,omitempty"`
 	LowerTokenRatio   float64         `json:"lowerTokenRatio"`
 	CurrentTokenRatio float64         `json:"currentTokenRatio"`
 	UpperTokenRatio   float64         `json:"upperTokenRatio"`
@@ -25,20 +35,293 @@ type RemovalMessage struct {
 	ValueEarnedUSD    float64         `json:"totalEarnedUSD"`
 	Pair              [2]TokenMessage `json:"pair"`
 	Earned            [2]TokenMessage `json:"earned"`
+	Owner             string          `json:"owner"`
+	Recipient         string          `json:"recipient"`
 	TxHash            string          `json:"txHash"`
+	JIT               bool            `json:"jit,omitempty"`
+	FlashLoan         bool            `json:"flashLoan,omitempty"`
+}
+
+type FeeCollectionMessage struct {
+	Timestamp         time.Time       `json:"timestamp"`
+	ChainID           int64           `json:"chainId"`
+	Protocol          string          `json:"protocol"`
+	Address           string          `json:"address"`
+	TokenID           string          `json:"tokenId,omitempty"`
+	LowerTokenRatio   float64         `json:"lowerTokenRatio"`
+	CurrentTokenRatio float64         `json:"currentTokenRatio"`
+	UpperTokenRatio   float64         `json:"upperTokenRatio"`
+	ValueCollectedUSD float64         `json:"totalValueUSD"`
+	Fees              [2]TokenMessage `json:"fees"`
+	Owner             string          `json:"owner"`
+	TxHash            string          `json:"txHash"`
+}
+
+type PositionClosedMessage struct {
+	Timestamp          time.Time       `json:"timestamp"`
+	ChainID            int64           `json:"chainId"`
+	Address            string          `json:"address"`
+	TokenID            string          `json:"tokenId"`
+	Owner              string          `json:"owner,omitempty"`
+	OpenedAt           time.Time       `json:"openedAt"`
+	DurationSeconds    int64           `json:"durationSeconds"`
+	DepositedUSD       float64         `json:"depositedValueUSD"`
+	WithdrawnUSD       float64         `json:"withdrawnValueUSD"`
+	FeesEarnedUSD      float64         `json:"feesEarnedUSD"`
+	HodlUSD            float64         `json:"hodlValueUSD"`
+	ImpermanentLossUSD float64         `json:"impermanentLossUSD"`
+	ImpermanentLoss    float64         `json:"impermanentLoss"`
+	PnlUSD             float64         `json:"pnlUSD"`
+	Deposited          [2]TokenMessage `json:"deposited"`
+	Withdrawn          [2]TokenMessage `json:"withdrawn"`
+	Fees               [2]TokenMessage `json:"fees"`
+	TxHash             string          `json:"txHash"`
+}
+
+type PositionRangeMessage struct {
+	Timestamp   time.Time `json:"timestamp"`
+	ChainID     int64     `json:"chainId"`
+	Address     string    `json:"address"`
+	TokenID     string    `json:"tokenId"`
+	Owner       string    `json:"owner,omitempty"`
+	LowerTick   int       `json:"lowerTick"`
+	UpperTick   int       `json:"upperTick"`
+	CurrentTick int       `json:"currentTick"`
+	InRange     bool      `json:"inRange"`
+	TxHash      string    `json:"txHash"`
 }
 
 type SwapMessage struct {
-	Timestamp time.Time    `json:"timestamp"`
-	Address   string       `json:"address"`
+	Timestamp time.Time        `json:"timestamp"`
+	ChainID   int64            `json:"chainId"`
+	Protocol  string           `json:"protocol"`
+	Address   string           `json:"address"`
+	TxHash    string           `json:"txHash"`
+	From      TokenMessage     `json:"from"`
+	To        TokenMessage     `json:"to"`
+	ValueUSD  float64          `json:"totalValueUSD"`
+	Price     SwapPriceMessage `json:"price"`
+	FeeTier   int              `json:"feeTier,omitempty"`
+	Fee       TokenMessage     `json:"fee"`
+	FeeUSD    float64          `json:"feeUSD"`
+	Sender    string           `json:"sender"`
+	Recipient string           `json:"recipient"`
+	JIT       bool             `json:"jit,omitempty"`
+	FlashLoan bool             `json:"flashLoan,omitempty"`
+}
+
+// FlashMessage is a flash loan of pool tokens. Purpose tells what the loan funded in its transaction.
+type FlashMessage struct {
+	Timestamp  time.Time       `json:"timestamp"`
+	ChainID    int64           `json:"chainId"`
+	Protocol   string          `json:"protocol"`
+	Address    string          `json:"address"`
+	TxHash     string          `json:"txHash"`
+	Borrowed   [2]TokenMessage `json:"borrowed"`
+	Fees       [2]TokenMessage `json:"fees"`
+	ValueUSD   float64         `json:"totalValueUSD"`
+	FeeUSD     float64         `json:"feeUSD"`
+	Sender     string          `json:"sender"`
+	Recipient  string          `json:"recipient"`
+	Purpose    string          `json:"purpose,omitempty"`
+	Operations []string        `json:"operations"`
+}
+
+// SwapPriceMessage holds prices of base token in quote token.
+type SwapPriceMessage struct {
+	Base      string  `json:"base"`
+	Quote     string  `json:"quote"`
+	Execution float64 `json:"execution"`
+	Before    float64 `json:"poolBefore"`
+	After     float64 `json:"poolAfter"`
+	ImpactBps float64 `json:"impactBps"`
+}
+
+type JITMessage struct {
+	Timestamp    time.Time       `json:"timestamp"`
+	ChainID      int64           `json:"chainId"`
+	Address      string          `json:"address"`
+	BlockNumber  uint64          `json:"blockNumber"`
+	TokenID      string          `json:"tokenId,omitempty"`
+	LowerTick    int             `json:"lowerTick"`
+	UpperTick    int             `json:"upperTick"`
+	LiquidityUSD float64         `json:"liquidityUSD"`
+	SwapsUSD     float64         `json:"swapsValueUSD"`
+	FeesUSD      float64         `json:"feesCapturedUSD"`
+	Fees         [2]TokenMessage `json:"fees"`
+	AddTxHash    string          `json:"addTxHash"`
+	SwapTxHashes []string        `json:"swapTxHashes"`
+	RemoveTxHash string          `json:"removeTxHash"`
+}
+
+type RebalanceMessage struct {
+	Timestamp    time.Time       `json:"timestamp"`
+	ChainID      int64           `json:"chainId"`
+	Address      string          `json:"address"`
+	Owner        string          `json:"owner"`
+	BlockNumber  uint64          `json:"blockNumber"`
+	Blocks       uint64          `json:"blocks"` // Blocks between the removal and the addition
+	OldRange     RangeMessage    `json:"oldRange"`
+	NewRange     RangeMessage    `json:"newRange"`
+	RemovedUSD   float64         `json:"removedValueUSD"`
+	AddedUSD     float64         `json:"addedValueUSD"`
+	FeesUSD      float64         `json:"feesCollectedUSD"`
+	Fees         [2]TokenMessage `json:"fees"`
+	RemoveTxHash string          `json:"removeTxHash"`
+	AddTxHash    string          `json:"addTxHash"`
+}
+
+type RangeMessage struct {
+	TokenID    string  `json:"tokenId,omitempty"`
+	LowerTick  int     `json:"lowerTick"`
+	UpperTick  int     `json:"upperTick"`
+	LowerRatio float64 `json:"lowerTokenRatio"`
+	UpperRatio float64 `json:"upperTokenRatio"`
+}
+
+type SandwichMessage struct {
+	Timestamp         time.Time        `json:"timestamp"`
+	ChainID           int64            `json:"chainId"`
+	Address           string           `json:"address"`
+	BlockNumber       uint64           `json:"blockNumber"`
+	Attacker          string           `json:"attacker"`
+	FrontRun          SwapLegMessage   `json:"frontRun"`
+	Victims           []SwapLegMessage `json:"victims"`
+	BackRun           SwapLegMessage   `json:"backRun"`
+	AttackerProfit    TokenMessage     `json:"attackerProfit"`
+	AttackerProfitUSD float64          `json:"attackerProfitUSD"`
+	VictimLossUSD     float64          `json:"victimLossUSD"`
+}
+
+type SwapLegMessage struct {
 	TxHash    string       `json:"txHash"`
+	Recipient string       `json:"recipient"`
 	From      TokenMessage `json:"from"`
 	To        TokenMessage `json:"to"`
 }
 
+// RouteMessage is a swap route of a transaction - swaps of several pools in log order.
+// Kind is arbitrage if the route starts and ends with the same token, and aggregator otherwise.
+type RouteMessage struct {
+	Timestamp   time.Time         `json:"timestamp"`
+	ChainID     int64             `json:"chainId"`
+	BlockNumber uint64            `json:"blockNumber"`
+	TxHash      string            `json:"txHash"`
+	Kind        string            `json:"kind"`
+	Hops        []RouteHopMessage `json:"hops"`
+	Path        []string          `json:"path"` // Token symbols in hop order
+	Input       TokenMessage      `json:"input"`
+	Output      TokenMessage      `json:"output"`
+	ValueUSD    float64           `json:"totalValueUSD"`
+	Profit      TokenMessage      `json:"profit"` // Output minus input, arbitrage only
+	ProfitUSD   float64           `json:"profitUSD"`
+	Sender      string            `json:"sender"`
+	Recipient   string            `json:"recipient"`
+	FlashLoan   bool              `json:"flashLoan,omitempty"`
+}
+
+type RouteHopMessage struct {
+	Address  string       `json:"address"`
+	Protocol string       `json:"protocol"`
+	From     TokenMessage `json:"from"`
+	To       TokenMessage `json:"to"`
+	ValueUSD float64      `json:"valueUSD"`
+}
+
+type CandleMessage struct {
+	ChainID     int64     `json:"chainId"`
+	Address     string    `json:"address"`
+	Interval    string    `json:"interval"`
+	OpenTime    time.Time `json:"openTime"`
+	CloseTime   time.Time `json:"closeTime"`
+	Base        string    `json:"base"`
+	Quote       string    `json:"quote"`
+	Open        float64   `json:"open"`
+	High        float64   `json:"high"`
+	Low         float64   `json:"low"`
+	Close       float64   `json:"close"`
+	VolumeBase  float64   `json:"volumeBase"`
+	VolumeQuote float64   `json:"volumeQuote"`
+	VolumeUSD   float64   `json:"volumeUSD"`
+	Trades      int       `json:"trades"`
+}
+
+type PoolStatsMessage struct {
+	Timestamp           time.Time                `json:"timestamp"`
+	ChainID             int64                    `json:"chainId"`
+	Address             string                   `json:"address"`
+	InRangeLiquidityUSD float64                  `json:"inRangeLiquidityUSD"`
+	Windows             []PoolStatsWindowMessage `json:"windows"`
+}
+
+type PoolStatsWindowMessage struct {
+	Window              string  `json:"window"`
+	NetLiquidityFlowUSD float64 `json:"netLiquidityFlowUSD"`
+	LiquidityAddedUSD   float64 `json:"liquidityAddedUSD"`
+	LiquidityRemovedUSD float64 `json:"liquidityRemovedUSD"`
+	Additions           int     `json:"additions"`
+	Removals            int     `json:"removals"`
+	Swaps               int     `json:"swaps"`
+	VolumeUSD           float64 `json:"volumeUSD"`
+	FeesUSD             float64 `json:"feesUSD"`
+	FeeAPR              float64 `json:"feeAPR"`
+	UniqueLPs           int     `json:"uniqueLPs"`
+}
+
+type DepthMessage struct {
+	Timestamp time.Time           `json:"timestamp"`
+	ChainID   int64               `json:"chainId"`
+	Address   string              `json:"address"`
+	Base      string              `json:"base"`
+	Quote     string              `json:"quote"`
+	Ranges    []DepthRangeMessage `json:"ranges"`
+}
+
+type DepthRangeMessage struct {
+	LowerTick  int     `json:"lowerTick"`
+	UpperTick  int     `json:"upperTick"`
+	LowerPrice float64 `json:"lowerPrice"`
+	UpperPrice float64 `json:"upperPrice"`
+	Liquidity  string  `json:"liquidity"`
+}
+
+type AlertMessage struct {
+	Timestamp   time.Time `json:"timestamp"`
+	ChainID     int64     `json:"chainId"`
+	Rule        string    `json:"rule"`
+	Description string    `json:"description,omitempty"`
+	Group       string    `json:"group,omitempty"`
+	Count       int       `json:"count"`
+	Operation   string    `json:"operation"`
+	TxHash      string    `json:"txHash"`
+	Message     any       `json:"message"`
+}
+
 type TokenMessage struct {
-	Symbol  string  `json:"symbol"`
-	Address string  `json:"address,omitempty"`
-	Amount  float64 `json:"amount"`
-	Price   float64 `json:"priceUSD,omitempty"`
+	Symbol  string   `json:"symbol"`
+	Address string   `json:"address,omitempty"`
+	Amount  float64  `json:"amount"`
+	Price   float64  `json:"priceUSD,omitempty"`
+	Flags   []string `json:"flags,omitempty"` // Reputation flags of suspicious tokens
+}
+
+type LeaderboardMessage struct {
+	Timestamp time.Time                  `json:"timestamp"`
+	ChainID   int64                      `json:"chainId"`
+	Metric    string                     `json:"metric"`
+	Windows   []LeaderboardWindowMessage `json:"windows"`
+}
+
+type LeaderboardWindowMessage struct {
+	Window  string                    `json:"window"`
+	Entries []LeaderboardEntryMessage `json:"entries"`
+}
+
+type LeaderboardEntryMessage struct {
+	Rank         int     `json:"rank"`
+	Address      string  `json:"address"`
+	LiquidityUSD float64 `json:"liquidityUSD"`
+	FeesUSD      float64 `json:"feesUSD"`
+	VolumeUSD    float64 `json:"volumeUSD"`
+	Pools        int     `json:"pools"`
 }